@@ -310,7 +310,7 @@ func newActionHandler(rt *RestTrigger, handler *OptimizedHandler, method, url st
 		serverSpan.SetTag("http.method", method)
 		serverSpan.SetTag("http.url", url)
 
-		ctx := opentracing.ContextWithSpan(context.Background(), serverSpan)
+		ctx := opentracing.ContextWithSpan(r.Context(), serverSpan)
 
 		c := cors.New(REST_CORS_PREFIX, log)
 		c.WriteCorsActualRequestHeaders(w)
@@ -351,33 +351,17 @@ func newActionHandler(rt *RestTrigger, handler *OptimizedHandler, method, url st
 			}
 		}
 
-		// get query params
-		queryValues := r.URL.Query()
-		queryParams := make(map[string]string, len(queryValues))
-
-		for key, value := range queryValues {
-			queryParams[key] = strings.Join(value, ",")
-		}
-
-		// get headers
-		header := make(map[string]interface{})
-		for key, value := range r.Header {
-			//If header has single value, then add to map as a string
-			//otherwise add as an array
-			if len(value) == 1 {
-				header[key] = value[0]
-			} else {
-				header[key] = value
-			}
-		}
+		queryParams, queryValues, header := requestValues(r)
 
 		data := map[string]interface{}{
-			"params":      pathParams,
-			"pathParams":  pathParams,
-			"queryParams": queryParams,
-			"header":      header,
-			"content":     content,
-			"tracing":     ctx,
+			"params":       pathParams,
+			"pathParams":   pathParams,
+			"queryParams":  queryParams,
+			"queryValues":  queryValues,
+			"header":       header,
+			"headerValues": header,
+			"content":      content,
+			"tracing":      ctx,
 		}
 
 		//pick action based on dispatch condition
@@ -507,6 +491,12 @@ func newActionHandler(rt *RestTrigger, handler *OptimizedHandler, method, url st
 				} else {
 					w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 				}
+				for key, values := range util.ReplyHeaders(object) {
+					w.Header().Del(key)
+					for _, value := range values {
+						w.Header().Add(key, value)
+					}
+				}
 				w.WriteHeader(replyCode)
 
 				data, err := util.Marshal(replyData)
@@ -536,6 +526,38 @@ func newActionHandler(rt *RestTrigger, handler *OptimizedHandler, method, url st
 
 ////////////////////////////////////////////////////////////////////////////////////////
 // Utils
+
+// requestValues returns the query params of a request with the values of a
+// repeated query param joined, as well as the query params and headers with
+// the values of a repeated one kept as an array.
+func requestValues(r *http.Request) (queryParams map[string]string, queryValues, header map[string]interface{}) {
+	// get query params
+	values := r.URL.Query()
+	queryParams = make(map[string]string, len(values))
+	queryValues = make(map[string]interface{}, len(values))
+	for key, value := range values {
+		queryParams[key] = strings.Join(value, ",")
+		if len(value) == 1 {
+			queryValues[key] = value[0]
+		} else {
+			queryValues[key] = value
+		}
+	}
+
+	// get headers
+	header = make(map[string]interface{})
+	for key, value := range r.Header {
+		// If header has single value, then add to map as a string
+		// otherwise add as an array
+		if len(value) == 1 {
+			header[key] = value[0]
+		} else {
+			header[key] = value
+		}
+	}
+	return queryParams, queryValues, header
+}
+
 func handlerIsValid(handler *OptimizedHandler) bool {
 	if handler.settings == nil {
 		return false
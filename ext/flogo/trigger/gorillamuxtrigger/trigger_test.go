@@ -9,13 +9,18 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
 
 	"io/ioutil"
 
+	"github.com/TIBCOSoftware/flogo-contrib/action/flow/test"
 	"github.com/TIBCOSoftware/flogo-lib/core/action"
+	"github.com/TIBCOSoftware/flogo-lib/core/activity"
 	"github.com/TIBCOSoftware/flogo-lib/core/data"
 	"github.com/TIBCOSoftware/flogo-lib/core/trigger"
+	"github.com/TIBCOSoftware/mashling/ext/flogo/activity/rest"
 )
 
 var testJsonMetadata = getJSONMetadata()
@@ -192,3 +197,55 @@ func BenchmarkHandlerOk(b *testing.B) {
 	}
 
 }
+
+func TestRequestValues(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/pets?status=ava&tag=a&tag=b", nil)
+	r.Header.Add("Accept", "application/json")
+	r.Header.Add("X-Tag", "a")
+	r.Header.Add("X-Tag", "b")
+	queryParams, queryValues, header := requestValues(r)
+	if !reflect.DeepEqual(queryParams, map[string]string{"status": "ava", "tag": "a,b"}) {
+		t.Fatalf("repeated query params should be joined but are %v", queryParams)
+	}
+	if !reflect.DeepEqual(queryValues, map[string]interface{}{"status": "ava", "tag": []string{"a", "b"}}) {
+		t.Fatalf("repeated query params should be arrays but are %v", queryValues)
+	}
+	if header["Accept"] != "application/json" || !reflect.DeepEqual(header["X-Tag"], []string{"a", "b"}) {
+		t.Fatalf("repeated headers should be arrays but are %v", header)
+	}
+}
+
+// TestRestMapping maps the queryParams output of the trigger to the
+// queryParams input of the rest activity, as v1 recipes do.
+func TestRestMapping(t *testing.T) {
+	var query map[string][]string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer backend.Close()
+
+	md := trigger.NewMetadata(testJsonMetadata)
+	queryParams, _, _ := requestValues(httptest.NewRequest(http.MethodGet, "/pets?status=ava&tag=a&tag=b", nil))
+	output, err := data.NewAttribute("queryParams", md.Output["queryParams"].Type(), queryParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	activityMetadata, err := ioutil.ReadFile("../../activity/rest/activity.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	amd := activity.NewMetadata(string(activityMetadata))
+	tc := test.NewTestActivityContext(amd)
+	tc.SetInput("method", "GET")
+	tc.SetInput("uri", backend.URL+"/pets")
+	tc.SetInput("queryParams", output.Value())
+	if _, err = rest.NewActivity(amd).Eval(tc); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(query, map[string][]string{"status": {"ava"}, "tag": {"a,b"}}) {
+		t.Fatalf("the query params should be passed to the rest activity but are %v", query)
+	}
+}
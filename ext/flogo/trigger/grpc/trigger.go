@@ -16,6 +16,7 @@ import (
 	"github.com/TIBCOSoftware/flogo-lib/core/trigger"
 	"github.com/TIBCOSoftware/mashling/lib/util"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 var addr string
@@ -265,7 +266,7 @@ func (t *GRPCTrigger) CallHandler(grpcData map[string]interface{}) (int, interfa
 			actID := action.Get(hand.ActionId)
 			context := trigger.NewContextWithData(context.Background(), &trigger.ContextData{Attrs: startAttrs, HandlerCfg: hand})
 			replyCode, replyData, err := t.runner.Run(context, actID, hand.ActionId, nil)
-			return replyCode, replyData, err
+			return replyCode, reply(grpcData, replyData), err
 		}
 	}
 
@@ -276,10 +277,34 @@ func (t *GRPCTrigger) CallHandler(grpcData map[string]interface{}) (int, interfa
 			actID := action.Get(hand.ActionId)
 			context := trigger.NewContextWithData(context.Background(), &trigger.ContextData{Attrs: startAttrs, HandlerCfg: hand})
 			replyCode, replyData, err := t.runner.Run(context, actID, hand.ActionId, nil)
-			return replyCode, replyData, err
+			return replyCode, reply(grpcData, replyData), err
 		}
 	}
 
 	log.Error("Dispatch not found")
 	return 0, nil, errors.New("Dispatch not found")
 }
+
+// reply sets the reply headers as response header metadata of unary calls and
+// returns the reply data without its meta keys.
+func reply(grpcData map[string]interface{}, replyData interface{}) interface{} {
+	object, ok := replyData.(map[string]interface{})
+	if !ok {
+		return replyData
+	}
+	if ctx, ok := grpcData["contextdata"].(context.Context); ok {
+		if headers := util.ReplyHeaders(object); len(headers) > 0 {
+			md := metadata.MD{}
+			for key, values := range headers {
+				md[strings.ToLower(key)] = values
+			}
+			if err := grpc.SetHeader(ctx, md); err != nil {
+				log.Error("unable to set reply headers: ", err)
+			}
+		}
+	}
+	if body, ok := object[util.MetaBody]; ok {
+		return body
+	}
+	return util.Clean(object)
+}
@@ -70,7 +70,7 @@ func create(command *cobra.Command, args []string) {
 			case *gwerrors.MissingDependency:
 				log.Println("Missing dependencies found: ", strings.Join(e.MissingDependencies, " "))
 				deps = append(deps, e.MissingDependencies...)
-			case *gwerrors.UndefinedReference:
+			case *gwerrors.UndefinedReference, *gwerrors.InvalidDefinition:
 				log.Fatalf("%s: %s", e.Type(), e.Details())
 			default:
 				log.Fatalf("Do not know how to handle error type %T!\n", e)
@@ -0,0 +1,65 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	traceCommand.Flags().StringVarP(&traceHost, "host", "H", "localhost", "the hostname where the mashling gateway is running")
+	traceCommand.Flags().StringVarP(&tracePort, "ping-port", "P", "9090", "the ping service port of the mashling gateway")
+	traceCommand.Flags().StringVarP(&traceSecret, "secret", "s", os.Getenv("MASHLING_TRACE_SECRET"), "the trace secret of the mashling gateway, defaults to MASHLING_TRACE_SECRET")
+	cliCommand.AddCommand(traceCommand)
+}
+
+var (
+	traceHost   string
+	tracePort   string
+	traceSecret string
+)
+
+var traceCommand = &cobra.Command{
+	Use:   "trace [trace id]",
+	Short: "Prints request traces of a running gateway",
+	Long:  `Prints the trace with the given ID, or all recent traces, from the ping service of a running mashling gateway. The trace ID of a request is returned in the X-Mashling-Trace-Id response header. The traces are only served to requests that present the trace secret of the gateway`,
+	Args:  cobra.MaximumNArgs(1),
+	Run:   trace,
+}
+
+func trace(command *cobra.Command, args []string) {
+	url := fmt.Sprintf("http://%s:%s/traces", traceHost, tracePort)
+	if len(args) == 1 {
+		url += "/" + args[0]
+	}
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		log.Fatal("unable to fetch traces: ", err)
+	}
+	request.Header.Set("X-Mashling-Trace", traceSecret)
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		log.Fatal("unable to fetch traces: ", err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		log.Fatal("unable to read traces: ", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		log.Fatalf("unable to fetch traces: %s: %s", response.Status, bytes.TrimSpace(body))
+	}
+	var indented bytes.Buffer
+	if err = json.Indent(&indented, body, "", "  "); err != nil {
+		log.Fatal("invalid traces: ", err)
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", indented.String())
+}
@@ -26,7 +26,7 @@ func validate(command *cobra.Command, args []string) {
 		log.Println("Invalid configuration file!:", err)
 		for _, errd := range gateway.Errors() {
 			switch e := errd.(type) {
-			case *gwerrors.UndefinedReference:
+			case *gwerrors.UndefinedReference, *gwerrors.InvalidDefinition:
 				log.Printf("%s: %s", e.Type(), e.Details())
 			case *gwerrors.MissingDependency:
 				log.Println("Missing dependencies found: ", strings.Join(e.MissingDependencies, " "))
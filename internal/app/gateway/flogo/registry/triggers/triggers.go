@@ -99,7 +99,7 @@ func extFlogoTriggerEftlTriggerJson() (*asset, error) {
 	return a, nil
 }
 
-var _extFlogoTriggerGorillamuxtriggerTriggerJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xb4\x96\xcf\x6f\xea\x38\x10\xc7\xef\xfc\x15\x56\xce\xb4\xb4\x7b\x5a\xa1\xd5\x6a\xcb\x8f\x96\x6a\xdb\x57\x44\xd2\x53\xd5\xc3\x90\x0c\x89\xf5\x1c\x3b\x1d\x8f\x4b\x51\xc5\xff\xfe\x94\x38\xbc\x82\x1a\x28\x22\x7d\x17\x02\x9e\x7c\x3f\xfe\x7a\xc6\xf6\xf0\xde\x11\x22\xd0\x90\x63\xd0\x17\x01\xcb\x79\x6c\xce\x52\x60\x5c\xc2\xea\x8c\xd0\x72\xd0\x2d\xe3\xbc\x2a\xaa\xf8\x42\x99\xd4\xf4\x99\x64\x9a\x22\xf9\x10\xe1\xa2\x8c\xa4\x92\x33\x37\x3f\x8f\x4d\xde\x8b\x6e\x07\xc3\x87\xd0\x2c\x78\x09\x84\xbd\x1c\x6c\xa6\xa4\x4e\x7b\xf8\xc6\xbd\x4a\xdf\xab\xf5\xbd\xd4\x90\x54\x0a\x72\xf7\xb6\x43\x7c\x45\xb2\xd2\xe8\x92\x7a\x71\x7e\x71\x7e\x59\x5b\x90\xac\x2a\x0f\x33\x8c\x51\xbe\xa2\xb8\xaf\xc1\x62\x12\x45\x53\x71\x8f\xd6\x42\x8a\xfe\x5d\x70\x9c\x19\xaa\x5e\x86\x1c\x6d\x26\xa6\x46\x49\x9b\x21\xb3\x14\xff\x50\xe1\x7f\xfc\x57\x2d\xb6\x74\xfc\xaf\x57\x25\x68\x63\x92\x05\xd7\x73\x87\x32\x2f\x14\x8a\xd9\x38\x8c\x44\xe4\xfd\x89\x85\x21\xb1\x59\x90\xa8\xd3\xe4\xc5\xb6\x84\xeb\xd4\x06\x7d\xf1\xd4\x11\x42\x88\xf7\xea\x73\x2b\xb7\x85\x21\x9f\xcd\x6a\x74\x93\x51\xa9\x19\x37\x2b\xaf\x02\x84\x2f\x4e\x12\x26\x41\x5f\x30\x39\xac\x86\xd7\xdd\x66\x24\x13\xc4\xdb\xda\x0d\xd4\x32\x49\x9d\x36\x32\x17\xa0\xec\x31\xd0\xb1\x4e\x0a\x23\x75\x83\xe3\x6f\x80\x47\xe6\x27\xea\x3f\x42\x1e\xe1\xdc\xa5\x9f\xc9\x73\x63\x14\x82\x6e\x85\x0e\x21\xc7\xb0\x80\x06\xdf\xdf\x41\xbf\x1d\x5d\xfe\xf5\xf7\x40\x36\xe4\xbb\x1d\x1d\x35\xcc\x15\x46\x77\xe1\x7e\xf0\x41\xbd\x45\x7a\x45\x1a\x62\xd3\xde\xad\xeb\x75\x84\xfe\x7f\x5c\x9d\x26\xf7\xf6\x87\x4a\xa2\xe6\x2b\xc7\xd9\x69\x14\x26\x67\x39\x64\x43\x78\x9a\x7e\x0e\x56\xc6\xe5\xf4\xd7\x52\x9d\x88\x50\x09\x14\x13\x63\x4f\xcc\x62\xa9\x9e\x36\xde\x1f\xc7\xaa\x07\x60\x5b\x38\x1f\x48\x9d\x8c\x7e\xb4\xd3\x4f\xc1\xda\xa5\xa1\xe4\x74\xca\xa3\x45\xba\x96\x8a\x0f\x5c\x79\x5f\x32\x6e\xc8\xb8\xa2\x0d\x64\x69\x1f\x8b\x94\x20\xc1\xd9\xe6\x18\x1e\xc6\x74\x84\x78\xae\x3a\x84\x71\x5c\x38\x3e\xd4\x20\x80\x20\xb7\x9f\x71\xf5\xf8\x41\x57\x05\x70\x36\x6d\xa1\x7f\x71\x48\xab\x36\x80\x0c\x21\x69\x4a\xe9\x31\xda\xd8\x68\xc6\xa6\x56\x03\x7a\xf5\xd5\xc1\x86\x78\xa7\x65\x1c\xad\x5c\xda\xd8\x68\x8d\x71\xd5\xed\x0f\xc8\x7f\x97\x2f\x03\x9d\x28\x2c\xff\x54\x78\xd6\xe7\x8e\xff\x31\xcb\xd6\x3c\x39\x72\x66\x3e\xf6\xc8\xfe\x6e\xb7\x7d\xb1\x0b\xdf\xfb\xb7\x42\xa0\x94\x59\xfa\xc8\x53\x70\x33\x8e\x82\xae\x08\xa6\x0f\xa1\x7f\x3e\xfa\xc7\x55\x34\x9c\x94\x5f\x46\xe3\xbb\x71\x34\x0e\x9e\x6b\xf5\xba\xbb\xdf\x5d\xb9\x6d\x4e\xf3\x76\x04\x1c\x1c\x9b\xdb\x64\x86\x85\x5a\x35\xcd\xb1\xd3\x7e\x0e\x93\x9c\xc5\x0a\x33\xa9\x6b\xd0\x8e\x36\x34\x3a\x91\x3b\x75\xdf\x73\x76\x7d\xf9\x85\x28\x33\xb9\xee\xac\x3b\xbf\x02\x00\x00\xff\xff\x86\x68\x16\x0b\x2b\x0b\x00\x00")
+var _extFlogoTriggerGorillamuxtriggerTriggerJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xb5\x96\x4d\x53\xdb\x30\x10\x86\xef\xfc\x0a\x8d\xcf\x81\x40\x4f\x1d\xa6\xd3\x29\xf9\x28\x61\x0a\x25\x13\x9b\x5e\x18\x0e\xb2\xbd\xb1\xd5\xca\x92\x59\xad\x09\x19\x26\xff\xbd\xb2\xe5\x94\x64\x48\x4c\xc6\x2e\x17\xdb\xd2\xfa\x7d\x76\xf5\xb9\xfb\x72\xc4\x98\xa7\x78\x06\xde\x39\xf3\x48\x84\x91\x3e\x4e\x38\xc1\x82\x2f\x8f\x11\x0c\x79\xbd\xd2\x4e\xcb\xbc\xb2\xcf\xa5\x4e\xf4\x39\xa1\x48\x12\x40\x67\x42\x98\x97\x96\x44\x50\x5a\x84\x27\x91\xce\xfa\xc1\xd5\x60\x78\xeb\xeb\x39\x2d\x38\x42\x3f\xe3\x26\x95\x42\x25\x7d\x78\xa6\x7e\xa5\xef\xd7\xfa\x7e\xa2\x51\x48\xc9\xb3\xe2\x79\x8b\xf8\x04\x68\x84\x56\x25\xf5\xf4\xe4\xf4\xe4\xac\x0e\x41\x90\xac\x62\x98\x41\x04\xe2\x09\xd8\x4d\x0d\x66\x93\x20\x98\xb2\x1b\x30\x86\x27\xe0\xfe\xe5\x05\xa5\x1a\xab\x9f\xed\xc0\x4c\xca\xa6\x5a\x0a\x93\x02\x91\x60\x5f\x30\x77\x8d\x6f\xd5\x60\xcb\x88\xbf\x3a\x55\x0c\x26\x42\x91\x53\xed\xdb\x17\x59\x2e\x81\xcd\xc6\x7e\xc0\x02\x17\x1f\x9b\x6b\x64\xeb\x01\xb1\x7a\x9a\x9c\xd8\x94\x70\x95\x18\xab\xbc\xb7\x6d\xc6\x5e\xaa\xe7\xc6\xdc\xe6\x1a\xdd\x6c\x56\xbd\xeb\x19\x15\x8a\x60\x3d\xf2\xca\x80\xf0\x58\x08\x84\xd8\x1a\x09\x0b\xa8\xba\x57\xbd\xdd\x48\x42\x1e\x6d\x6a\xd7\x50\x63\xe7\x53\x25\x3b\x99\x73\x2e\xcd\x21\xd0\xb1\x8a\x73\x6d\x83\xfb\x10\x78\xa0\xff\x80\xfa\x10\xf2\x08\xc2\x22\x79\x4b\x0e\xb5\x96\xc0\x55\x27\xb4\x6f\x5b\x7e\xce\xd5\xc7\xd0\xaf\x46\x67\x9f\x3e\x0f\x04\xfd\x6f\x3a\x28\x1e\x4a\x08\xae\xfd\xfd\xe0\x46\xbd\x01\xb4\xe7\x71\x08\xb8\x7f\x27\x1c\xa0\xff\x01\xcb\x76\x72\x17\xfe\x50\x0a\x50\x74\x61\x4f\x75\x3b\x8a\x3d\x48\x86\x7c\xd2\x08\xed\xf4\x21\x37\x22\x2a\xdd\x7f\x17\xb2\x25\x42\xc6\x3c\x9f\x68\x43\xed\xd5\x53\x8d\x1d\xd4\x03\x6e\x3a\x44\x3e\x10\x2a\x1e\xfd\xec\xa6\x9f\x72\x63\x16\x1a\xe3\xf6\x94\x3b\xbb\x99\xec\x0a\x50\xc3\x95\xf7\x2e\xe3\x12\x75\x91\x77\x81\x2c\xcc\x5d\x9e\x20\x8f\x61\xb6\x3e\x86\xcd\x18\xfb\x7c\xa8\x32\x84\x2e\x28\x2f\xa8\x29\x41\x70\xe4\x99\x79\x8b\xab\xfb\x1b\xa3\xca\x39\xa5\xd3\x0e\xfa\xc7\x02\x70\xd9\x19\xf0\x8b\xcb\x02\x76\x00\x74\xf8\x1b\x22\x6a\x06\xa4\x60\xe7\x14\xdb\x39\x77\xda\x2e\xde\x23\x6d\xf3\xf0\xae\x6c\xc7\xd5\xd2\x7b\xf7\xfa\xde\xca\x5a\x07\x2b\x17\xc6\x7a\x55\x36\xb4\xb2\xe0\x68\x90\xff\xdb\x41\x29\x57\xb1\x84\xb2\xae\x71\xac\xb7\x45\xc7\xab\x97\x0d\x3f\x19\xd8\x6a\xe8\x75\x9b\xee\x4f\xb8\x9b\xb9\x85\xb9\xf2\x63\xc3\xc4\xa5\xd4\x0b\x67\xb9\xf7\x2e\xc7\x81\xd7\x63\xde\xf4\xd6\x77\xef\x3b\xf7\xba\x08\x86\x93\xf2\x63\x34\xbe\x1e\x07\x63\xef\xa1\x56\xaf\x7a\xfb\xa3\x2b\x77\x6e\xbb\xd8\x0e\x80\xdb\x42\x50\x5f\xc5\x33\xc8\xe5\x72\x97\x8f\xad\x0c\xd8\x4c\x2a\x0c\x54\x98\x49\xbd\x06\xdd\x68\x43\xad\x62\xb1\xb5\xee\x7b\xae\x0f\xb7\xfc\x76\x03\x1c\x95\x5f\xab\xa3\xbf\x5e\x7b\x87\xee\xae\x0b\x00\x00")
 
 func extFlogoTriggerGorillamuxtriggerTriggerJsonBytes() ([]byte, error) {
 	return bindataRead(
@@ -114,7 +114,7 @@ func extFlogoTriggerGorillamuxtriggerTriggerJson() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "ext/flogo/trigger/gorillamuxtrigger/trigger.json", size: 2859, mode: os.FileMode(509), modTime: time.Unix(1535605435, 0)}
+	info := bindataFileInfo{name: "ext/flogo/trigger/gorillamuxtrigger/trigger.json", size: 2990, mode: os.FileMode(509), modTime: time.Unix(1535605435, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -356,7 +356,13 @@ var registryClientTemplate = template.Must(template.New("").Parse(`// This file
 	func {{.MethodName}}(client pb.{{$serviceName}}Client, values interface{}) map[string]interface{} {
 		req := &pb.{{.MethodReqName}}{}
 		grpcsupport.AssignStructValues(req, values)
-		res, err := client.{{.MethodName}}(context.Background(), req)
+		ctx := context.Background()
+		if valuesMap, ok := values.(map[string]interface{}); ok {
+			if valuesCtx, ok := valuesMap["Context"].(context.Context); ok {
+				ctx = valuesCtx
+			}
+		}
+		res, err := client.{{.MethodName}}(ctx, req)
 		b, errMarshl := json.Marshal(res)
 		if errMarshl != nil {
 			log.Println("Error: ", errMarshl)
@@ -48,3 +48,20 @@ func (e *UndefinedReference) Type() string {
 func (e *UndefinedReference) Details() string {
 	return fmt.Sprintf("%s reference %s from %s is undefined", e.ReferenceType, e.Reference, e.ReferencedFrom)
 }
+
+// InvalidDefinition is an error for a configuration component that is not defined correctly.
+type InvalidDefinition struct {
+	DefinitionType string
+	DefinedIn      string
+	Reason         string
+}
+
+//Type is an error when an invalid definition is found.
+func (e *InvalidDefinition) Type() string {
+	return "Invalid definition found"
+}
+
+//Details returns the invalid definition details.
+func (e *InvalidDefinition) Details() string {
+	return fmt.Sprintf("%s definition in %s is invalid: %s", e.DefinitionType, e.DefinedIn, e.Reason)
+}
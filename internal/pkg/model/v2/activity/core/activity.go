@@ -1,19 +1,15 @@
 package Core
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"reflect"
 	"strconv"
 	"strings"
 
 	"github.com/TIBCOSoftware/flogo-lib/core/activity"
 	"github.com/TIBCOSoftware/flogo-lib/logger"
-	mservice "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service"
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
-	"github.com/TIBCOSoftware/mashling/pkg/strings"
 )
 
 var log = logger.GetLogger("activity-mashling-core")
@@ -40,7 +36,7 @@ func (a *MashlingCore) Eval(context activity.Context) (done bool, err error) {
 	if payload == nil {
 		log.Info("Executing mashling-core with empty payload.")
 	} else {
-		log.Info("Executing mashling-core with payload: ", payload)
+		log.Debug("Executing mashling-core with payload: ", payload)
 	}
 	identifier := context.GetInput("identifier").(string)
 	instance := context.GetInput("instance").(string)
@@ -52,91 +48,40 @@ func (a *MashlingCore) Eval(context activity.Context) (done bool, err error) {
 	log.Debug("Executing mashling-core with routes: ", rawRoutes)
 	log.Debug("Executing mashling-core with services: ", rawServices)
 
-	// Parse routes
-	var routes []types.Route
-	var routesJSON json.RawMessage
-	routesJSON, err = json.Marshal(rawRoutes)
+	dispatch, err := dispatches.Lookup(identifier, rawRoutes, rawServices)
 	if err != nil {
-		log.Error("error loading routes")
-		return false, err
-	}
-	err = json.Unmarshal(routesJSON, &routes)
-	if err != nil {
-		log.Error("error parsing routes")
+		log.Error("error compiling dispatch")
 		return false, err
 	}
 
-	// Parse services
-	var services []types.Service
-	var servicesJSON json.RawMessage
-	servicesJSON, err = json.Marshal(rawServices)
-	if err != nil {
-		log.Error("error loading services")
-		return false, err
-	}
-	err = json.Unmarshal(servicesJSON, &services)
+	// Contains all elements of request along with the conditional VM setup with defaults.
+	exec, err := newExecution(requestContext(payload), dispatch, payload, false)
 	if err != nil {
-		log.Error("error parsing services")
 		return false, err
 	}
-	// Create services map
-	serviceMap := make(map[string]types.Service)
-	for _, service := range services {
-		serviceMap[service.Name] = service
-	}
+	defer exec.trace.finish()
+	defer exec.release()
 
 	// Route to be executed once it is identified by the conditional evaluation.
-	var routeToExecute *types.Route
-
-	// Setup conditional VM with defaults.
-	vmDefaults := make(map[string]interface{})
-	if payload != nil {
-		vmDefaults["payload"] = payload
-	}
-	vmDefaults["async"] = false
-	// Add ENV flags to the vmDefaults
-	envFlags := make(map[string]string)
-	for _, e := range os.Environ() {
-		pair := strings.Split(e, "=")
-		envFlags[pair[0]] = pair[1]
-	}
-	vmDefaults["env"] = envFlags
-	vm, err := mservice.NewVM(vmDefaults)
-	if err != nil {
-		return false, err
-	}
-
-	// Evaluate route conditions to select which one to execute.
-	for _, route := range routes {
-		var truthiness bool
-		truthiness, err = evaluateTruthiness(route.Condition, vm)
-		if err != nil {
-			continue
-		}
-		if truthiness {
-			log.Info("route identified via conditional evaluation to true: ", route.Condition)
-			routeToExecute = &route
-			break
-		}
-	}
-	// Contains all elements of request: right now just payload, environment flags and service instances.
-	executionContext := make(map[string]interface{})
-	executionContext["payload"] = &payload
-	executionContext["env"] = envFlags
+	routeToExecute := dispatch.selectRoute(exec.vm, exec.trace)
 
 	// Execute the identified route if it exists and handle the async option.
 	if routeToExecute != nil {
 		if routeToExecute.Async {
 			log.Info("executing route asynchronously")
-			vmDefaults["async"] = true
-			asyncVM, vmerr := mservice.NewVM(vmDefaults)
-			if vmerr != nil {
-				return false, vmerr
+			async, asyncCtx := asyncs.start()
+			asyncExec, eerr := newExecution(asyncCtx, dispatch, payload, true)
+			if eerr != nil {
+				asyncs.finish(async, eerr, false)
+				return false, eerr
 			}
-			go executeRoute(routeToExecute, serviceMap, &executionContext, asyncVM)
-			vm.SetPrimitiveInVM("async", true)
+			asyncExec.trace = exec.trace
+			asyncExec.setAsync(async)
+			go asyncExec.executeAsync(routeToExecute, async)
+			exec.vm.SetPrimitiveInVM("async", true)
+			exec.setAsync(async)
 		} else {
-			err = executeRoute(routeToExecute, serviceMap, &executionContext, vm)
+			err = exec.executeRoute(routeToExecute)
 		}
 		if err != nil {
 			log.Error("error executing route: ", err)
@@ -148,14 +93,27 @@ func (a *MashlingCore) Eval(context activity.Context) (done bool, err error) {
 	replyHandler := context.FlowDetails().ReplyHandler()
 
 	if replyHandler != nil && routeToExecute != nil {
-		for _, response := range routeToExecute.Responses {
+		// An exceeded deadline or a step with a dedicated error response
+		// replaces the route responses.
+		responses := routeToExecute.Responses
+		if exec.timedOut() {
+			timeoutResponse := DefaultTimeoutResponse
+			if routeToExecute.OnTimeout != nil {
+				timeoutResponse = *routeToExecute.OnTimeout
+			}
+			responses = []types.Response{timeoutResponse}
+		} else if stepErr, ok := err.(*StepError); ok && stepErr.Response != nil {
+			responses = []types.Response{*stepErr.Response}
+		}
+		for _, response := range responses {
 			var truthiness bool
-			truthiness, err = evaluateTruthiness(response.Condition, vm)
+			truthiness, err = exec.evaluate(response.Condition)
+			exec.trace.response(response.Condition, truthiness, err)
 			if err != nil {
 				continue
 			}
 			if truthiness {
-				output, oErr := translateMappings(&executionContext, map[string]interface{}{"code": response.Output.Code})
+				output, oErr := exec.translate(map[string]interface{}{"code": response.Output.Code})
 				if oErr != nil {
 					return false, oErr
 				}
@@ -180,24 +138,11 @@ func (a *MashlingCore) Eval(context activity.Context) (done bool, err error) {
 					log.Info("Code contents is not found or not an integer, default response code is 200")
 					code = 200
 				}
-				// Translate data mappings
-				var data interface{}
-				nestedData, ok := response.Output.Data.(map[string]interface{})
-				if ok {
-					data, oErr = translateMappings(&executionContext, nestedData)
-					if oErr != nil {
-						return false, oErr
-					}
-				} else {
-					interimData, dErr := translateMappings(&executionContext, map[string]interface{}{"data": response.Output.Data})
-					if dErr != nil {
-						return false, dErr
-					}
-					data, ok = interimData["data"]
-					if !ok {
-						return false, errors.New("cannot extract data from response output")
-					}
+				data, oErr := exec.output(response.Output)
+				if oErr != nil {
+					return false, oErr
 				}
+				exec.trace.reply(code)
 				replyHandler.Reply(code, data, nil)
 				return true, err
 			}
@@ -207,105 +152,56 @@ func (a *MashlingCore) Eval(context activity.Context) (done bool, err error) {
 	return true, err
 }
 
-func executeRoute(route *types.Route, services map[string]types.Service, executionContext *map[string]interface{}, vm *mservice.VM) (err error) {
-	for _, step := range route.Steps {
-		var truthiness bool
-		truthiness, err = evaluateTruthiness(step.Condition, vm)
-		if err != nil {
-			return err
-		}
-		if truthiness {
-			err = invokeService(services[step.Service], executionContext, step.Input, vm)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
-}
-
-func evaluateTruthiness(condition string, vm *mservice.VM) (truthy bool, err error) {
-	if condition == "" {
-		log.Info("condition was empty and thus evaluates to true")
-		return true, nil
-	}
-	truthy, err = vm.EvaluateToBool(condition)
-	if err != nil {
-		log.Infof("condition evaluation causes error so is false: %s", condition)
-		return false, err
-	}
-	log.Infof("condition evaluated to %t: %s", truthy, condition)
-	return truthy, err
-}
-
-func invokeService(serviceDef types.Service, executionContext *map[string]interface{}, input map[string]interface{}, vm *mservice.VM) (err error) {
-	log.Info("invoking service type: ", serviceDef.Type)
-	serviceInstance, err := mservice.Initialize(serviceDef)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		vmErr := vm.SetInVM(serviceDef.Name, serviceInstance)
-		if vmErr != nil {
-			err = vmErr
-		}
-	}()
-	(*executionContext)[serviceDef.Name] = &serviceInstance
-	values, mErr := translateMappings(executionContext, input)
-	if mErr != nil {
-		return mErr
-	}
-	err = serviceInstance.UpdateRequest(values)
-	if err != nil {
-		return err
-	}
-	err = serviceInstance.Execute()
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
+// translateMappings resolves the templates of mapping values, including those
+// nested in objects and arrays, against the execution context.
 func translateMappings(executionContext *map[string]interface{}, mappings map[string]interface{}) (values map[string]interface{}, err error) {
 	values = make(map[string]interface{})
 	if len(mappings) == 0 {
 		return values, err
 	}
 	for fullKey, v := range mappings {
-		var convertedValue interface{}
-		switch value := v.(type) {
-		case string:
-			if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
-				// this is a variable so we need to evaluate it.
-				value = strings.Replace(value, "${", "", 1)
-				convertedValue, err = getValueFromDotNotation(*executionContext, util.TrimSuffix(value, "}"))
-				if err != nil {
-					return values, err
-				}
-			} else {
-				convertedValue = value
-			}
-		default:
-			convertedValue = value
+		values[fullKey], err = translateValue(*executionContext, v)
+		if err != nil {
+			return values, err
 		}
-		values[fullKey] = convertedValue
 	}
 	return expandMap(values), err
 }
 
-func getValueFromDotNotation(rootObject interface{}, fullPropertyName string) (interface{}, error) {
-	dotNames := strings.Split(fullPropertyName, ".")
-	var err error
-	for _, subPropertyName := range dotNames {
-		rootObject, err = getProperty(rootObject, subPropertyName)
+func translateValue(executionContext map[string]interface{}, v interface{}) (interface{}, error) {
+	switch value := v.(type) {
+	case string:
+		if !strings.Contains(value, "${") {
+			return value, nil
+		}
+		t, err := parseTemplate(value)
 		if err != nil {
-			return nil, err
+			// A value that only looks like a template, like a shell or
+			// JavaScript snippet, is kept as it is.
+			log.Debugf("keeping mapping value as it is: %v", err)
+			return value, nil
 		}
-		if rootObject == nil {
-			return nil, nil
+		return t.evaluate(executionContext)
+	case map[string]interface{}:
+		translated := make(map[string]interface{}, len(value))
+		for key, element := range value {
+			var err error
+			if translated[key], err = translateValue(executionContext, element); err != nil {
+				return nil, err
+			}
+		}
+		return translated, nil
+	case []interface{}:
+		translated := make([]interface{}, len(value))
+		for i, element := range value {
+			var err error
+			if translated[i], err = translateValue(executionContext, element); err != nil {
+				return nil, err
+			}
 		}
+		return translated, nil
 	}
-	return rootObject, nil
+	return v, nil
 }
 
 func getProperty(obj interface{}, property string) (interface{}, error) {
@@ -331,16 +227,26 @@ func getProperty(obj interface{}, property string) (interface{}, error) {
 	if !(objKind == reflect.Struct || objKind == reflect.Ptr) {
 		return nil, errors.New("can only get property fields from struct interfaces")
 	}
-	property = strings.Title(property)
 	var objValue reflect.Value
 	if objKind == reflect.Ptr {
 		objValue = reflect.ValueOf(obj).Elem()
 	} else {
 		objValue = reflect.ValueOf(obj)
 	}
-	propertyField := objValue.FieldByName(property)
+	propertyField := objValue.FieldByName(strings.Title(property))
+	if !propertyField.IsValid() {
+		// Fall back to the JSON name of a field, like etag for ETag.
+		objType := objValue.Type()
+		for i := 0; i < objType.NumField(); i++ {
+			field := objType.Field(i)
+			if name := strings.Split(field.Tag.Get("json"), ",")[0]; name == property && field.PkgPath == "" {
+				propertyField = objValue.Field(i)
+				break
+			}
+		}
+	}
 	if !propertyField.IsValid() {
-		return nil, fmt.Errorf("%s type has no property named %s", objKind, property)
+		return nil, fmt.Errorf("%s type has no property named %s", objKind, strings.Title(property))
 	}
 	return propertyField.Interface(), nil
 }
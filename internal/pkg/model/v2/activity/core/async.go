@@ -0,0 +1,319 @@
+package Core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// AsyncRunning is the status of an async execution that has not completed.
+	AsyncRunning = "running"
+	// AsyncSucceeded is the status of an async execution that completed.
+	AsyncSucceeded = "succeeded"
+	// AsyncFailed is the status of an async execution that failed.
+	AsyncFailed = "failed"
+	// AsyncHistory is the number of completed async executions that are kept.
+	AsyncHistory = 1000
+	// DefaultShutdownTimeout is how long a shutdown waits for async executions.
+	DefaultShutdownTimeout = 30 * time.Second
+	// DeadLetterTimeout is how long a dead letter sink waits for its broker.
+	DeadLetterTimeout = 10 * time.Second
+)
+
+// AsyncExecution is the status of the execution of an async route. Its ID is
+// available to the responses of the request as asyncId.
+type AsyncExecution struct {
+	ID           string     `json:"id"`
+	Status       string     `json:"status"`
+	Error        string     `json:"error,omitempty"`
+	DeadLettered bool       `json:"deadLettered,omitempty"`
+	Start        time.Time  `json:"start"`
+	End          *time.Time `json:"end,omitempty"`
+}
+
+// asyncTracker keeps track of the async executions in flight and of the
+// recently completed ones. Async executions run with its context, which is
+// canceled when a shutdown gives up waiting for them.
+type asyncTracker struct {
+	executions map[string]*AsyncExecution
+	completed  []string
+	inFlight   sync.WaitGroup
+	ctx        context.Context
+	cancel     context.CancelFunc
+	sync.Mutex
+}
+
+var asyncs = newAsyncTracker()
+
+func newAsyncTracker() *asyncTracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &asyncTracker{executions: make(map[string]*AsyncExecution), ctx: ctx, cancel: cancel}
+}
+
+// start registers a new async execution and returns it along with the
+// context it runs with.
+func (a *asyncTracker) start() (*AsyncExecution, context.Context) {
+	id := make([]byte, 8)
+	rand.Read(id)
+	execution := &AsyncExecution{ID: hex.EncodeToString(id), Status: AsyncRunning, Start: time.Now()}
+	a.Lock()
+	defer a.Unlock()
+	a.executions[execution.ID] = execution
+	a.inFlight.Add(1)
+	return execution, a.ctx
+}
+
+// finish records the outcome of an async execution.
+func (a *asyncTracker) finish(execution *AsyncExecution, err error, deadLettered bool) {
+	a.Lock()
+	defer a.Unlock()
+	end := time.Now()
+	execution.End = &end
+	execution.Status = AsyncSucceeded
+	if err != nil {
+		execution.Status = AsyncFailed
+		execution.Error = err.Error()
+		execution.DeadLettered = deadLettered
+	}
+	a.completed = append(a.completed, execution.ID)
+	if len(a.completed) > AsyncHistory {
+		delete(a.executions, a.completed[0])
+		a.completed = a.completed[1:]
+	}
+	a.inFlight.Done()
+}
+
+// LookupAsync returns a copy of the status of an async execution.
+func LookupAsync(id string) (AsyncExecution, bool) {
+	asyncs.Lock()
+	defer asyncs.Unlock()
+	execution, ok := asyncs.executions[id]
+	if !ok {
+		return AsyncExecution{}, false
+	}
+	return *execution, true
+}
+
+// WaitAsync waits for the async executions in flight to complete. If they do
+// not complete within the timeout they are canceled, which fails them, and
+// it waits up to the timeout again for them to stop. Executions that are
+// still running after that are left behind.
+func WaitAsync(timeout time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		asyncs.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+	}
+	asyncs.Lock()
+	cancel := asyncs.cancel
+	asyncs.ctx, asyncs.cancel = context.WithCancel(context.Background())
+	asyncs.Unlock()
+	cancel()
+	select {
+	case <-done:
+		return fmt.Errorf("async executions did not complete within %s and were canceled", timeout)
+	case <-time.After(timeout):
+	}
+	return fmt.Errorf("async executions did not complete within %s and did not stop when canceled", timeout)
+}
+
+// AsyncHandler serves the status of an async execution at its root followed
+// by the execution ID.
+func AsyncHandler(root string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		execution, ok := LookupAsync(strings.Trim(strings.TrimPrefix(r.URL.Path, root), "/"))
+		if !ok {
+			http.Error(w, `{"error":"execution not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(execution)
+	})
+}
+
+// ValidateDeadLetter checks the settings of a dead letter sink.
+func ValidateDeadLetter(route types.Route) error {
+	if !route.Async {
+		return errors.New("only an async route can have a dead letter sink")
+	}
+	deadLetter := route.DeadLetter
+	sinks := 0
+	for _, set := range []bool{deadLetter.Service != "", deadLetter.File != "", deadLetter.Kafka != nil, deadLetter.MQTT != nil} {
+		if set {
+			sinks++
+		}
+	}
+	if sinks != 1 {
+		return errors.New("a dead letter sink needs one of a service, a file, a kafka or an mqtt topic")
+	}
+	for _, topic := range []*types.DeadLetterTopic{deadLetter.Kafka, deadLetter.MQTT} {
+		if topic != nil && (topic.Brokers == "" || topic.Topic == "") {
+			return errors.New("a dead letter topic needs brokers and a topic")
+		}
+	}
+	return nil
+}
+
+// executeAsync executes an async route and hands a failure to the dead
+// letter sink of the route.
+func (e *execution) executeAsync(route *types.Route, async *AsyncExecution) {
+	defer e.release()
+	err := e.executeRoute(route)
+	deadLettered := false
+	if err != nil {
+		log.Errorf("error executing async route %s: %v", async.ID, err)
+		if route.DeadLetter != nil {
+			if dlErr := e.deadLetter(route.DeadLetter, async, err); dlErr != nil {
+				log.Errorf("unable to dead letter async execution %s: %v", async.ID, dlErr)
+			} else {
+				deadLettered = true
+			}
+		}
+	}
+	e.trace.finish()
+	asyncs.finish(async, err, deadLettered)
+}
+
+// setAsync makes the ID of an async execution available to conditions and
+// mappings as asyncId.
+func (e *execution) setAsync(async *AsyncExecution) {
+	e.Lock()
+	defer e.Unlock()
+	e.context["asyncId"] = async.ID
+	e.vm.SetPrimitiveInVM("asyncId", async.ID)
+}
+
+// deadLetter hands a failed async execution to a dead letter sink. A service
+// sees the failure as error, a file gets a JSON record per line and a topic a
+// JSON record per message.
+func (e *execution) deadLetter(deadLetter *types.DeadLetter, async *AsyncExecution, err error) error {
+	details := newStepError("", "", err).Details()
+	if deadLetter.Service != "" {
+		sink := e.deadLetterExecution()
+		defer sink.release()
+		_, err = sink.invokeService(deadLetter.Service, deadLetter.Service, deadLetter.Input, result{name: "error", value: details})
+		return err
+	}
+	e.Lock()
+	payload := e.context["payload"]
+	e.Unlock()
+	record, err := json.Marshal(map[string]interface{}{
+		"id":      async.ID,
+		"time":    time.Now(),
+		"error":   details,
+		"payload": payload,
+	})
+	if err != nil {
+		return err
+	}
+	switch {
+	case deadLetter.Kafka != nil:
+		return publishKafka(deadLetter.Kafka, record)
+	case deadLetter.MQTT != nil:
+		return publishMQTT(deadLetter.MQTT, async.ID, record)
+	}
+	deadLetterFiles.Lock()
+	defer deadLetterFiles.Unlock()
+	file, err := os.OpenFile(deadLetter.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(record, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// deadLetterExecution returns an execution of the dead letter service of a
+// failed route. It has a copy of the values of the route and does not use its
+// context, which may be done.
+func (e *execution) deadLetterExecution() *execution {
+	e.Lock()
+	defer e.Unlock()
+	values := make(map[string]interface{}, len(e.context))
+	for name, value := range e.context {
+		values[name] = value
+	}
+	return &execution{
+		ctx: context.Background(),
+		executionState: &executionState{
+			dispatch: e.dispatch,
+			context:  values,
+			trace:    e.trace,
+		},
+	}
+}
+
+// deadLetterFiles serializes the appends to dead letter files.
+var deadLetterFiles sync.Mutex
+
+// publishKafka publishes a dead letter record to a Kafka topic. Failures are
+// rare, so every record has its own producer.
+func publishKafka(topic *types.DeadLetterTopic, record []byte) error {
+	config := sarama.NewConfig()
+	config.Net.DialTimeout = DeadLetterTimeout
+	config.Net.ReadTimeout = DeadLetterTimeout
+	config.Net.WriteTimeout = DeadLetterTimeout
+	config.Producer.Return.Successes = true
+	if topic.User != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = topic.User
+		config.Net.SASL.Password = topic.Password
+	}
+	producer, err := sarama.NewSyncProducer(strings.Split(topic.Brokers, ","), config)
+	if err != nil {
+		return err
+	}
+	_, _, err = producer.SendMessage(&sarama.ProducerMessage{Topic: topic.Topic, Value: sarama.ByteEncoder(record)})
+	if closeErr := producer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// publishMQTT publishes a dead letter record to an MQTT topic with at least
+// once delivery. Failures are rare, so every record has its own client.
+func publishMQTT(topic *types.DeadLetterTopic, id string, record []byte) error {
+	options := mqtt.NewClientOptions()
+	options.AddBroker(topic.Brokers)
+	options.SetClientID("mashling-dead-letter-" + id)
+	options.SetUsername(topic.User)
+	options.SetPassword(topic.Password)
+	options.SetConnectTimeout(DeadLetterTimeout)
+	options.SetWriteTimeout(DeadLetterTimeout)
+	options.SetAutoReconnect(false)
+	client := mqtt.NewClient(options)
+	if err := waitMQTT(client.Connect()); err != nil {
+		return err
+	}
+	defer client.Disconnect(250)
+	return waitMQTT(client.Publish(topic.Topic, 1, false, record))
+}
+
+// waitMQTT waits for an MQTT operation to complete within the dead letter
+// timeout.
+func waitMQTT(token mqtt.Token) error {
+	if !token.WaitTimeout(DeadLetterTimeout) {
+		return fmt.Errorf("mqtt broker did not respond within %s", DeadLetterTimeout)
+	}
+	return token.Error()
+}
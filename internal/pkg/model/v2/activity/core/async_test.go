@@ -0,0 +1,217 @@
+package Core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+)
+
+// startAsync starts the first route of an execution the way an async route is
+// started, but waits for it to complete.
+func startAsync(exec *execution, payload interface{}) (*AsyncExecution, func()) {
+	async, ctx := asyncs.start()
+	asyncExec, _ := newExecution(ctx, exec.dispatch, payload, true)
+	asyncExec.setAsync(async)
+	route := &exec.dispatch.Routes[0]
+	return async, func() { asyncExec.executeAsync(route, async) }
+}
+
+func TestAsyncDeadLetterFile(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+	file := filepath.Join(t.TempDir(), "failed.log")
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "async": true,
+  "steps": [{"service": "users"}],
+  "deadLetter": {"file": "`+file+`"}
+}]`, map[string]string{"users": "fail=true"})
+	async, run := startAsync(exec, map[string]interface{}{"id": 1.0})
+	run()
+
+	status, ok := LookupAsync(async.ID)
+	if !ok || status.Status != AsyncFailed || !status.DeadLettered || status.End == nil {
+		t.Fatalf("execution should have failed and been dead lettered but is %+v", status)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record map[string]interface{}
+	if err = json.Unmarshal(content, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["id"] != async.ID || record["payload"].(map[string]interface{})["id"] != 1.0 {
+		t.Fatalf("record should have the execution ID and payload but is %v", record)
+	}
+	if details := record["error"].(map[string]interface{}); details["service"] != "users" {
+		t.Fatalf("record should have the error of the users service but is %v", details)
+	}
+}
+
+func TestAsyncDeadLetterService(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+	received := make(chan string, 1)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Path
+	}))
+	defer sink.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "async": true,
+  "steps": [{"service": "users"}],
+  "deadLetter": {"service": "sink", "input": {"pathParams.service": "${error.service}", "pathParams.id": "${asyncId}"}}
+}]`, map[string]string{"users": "fail=true"}, map[string]interface{}{
+		"name":     "sink",
+		"type":     "http",
+		"settings": map[string]interface{}{"url": sink.URL + "/:service/:id", "method": "GET"},
+	})
+	async, run := startAsync(exec, nil)
+	run()
+
+	select {
+	case got := <-received:
+		if got != "/users/"+async.ID {
+			t.Fatalf("sink should receive the failed service and execution ID but got %q", got)
+		}
+	default:
+		t.Fatal("sink should have been invoked")
+	}
+	if status, _ := LookupAsync(async.ID); !status.DeadLettered {
+		t.Fatalf("execution should have been dead lettered but is %+v", status)
+	}
+}
+
+func TestAsyncDeadLetterKafka(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("failures", 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t),
+	})
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "async": true,
+  "steps": [{"service": "users"}],
+  "deadLetter": {"kafka": {"brokers": "`+broker.Addr()+`", "topic": "failures"}}
+}]`, map[string]string{"users": "fail=true"})
+	async, run := startAsync(exec, nil)
+	run()
+
+	if status, _ := LookupAsync(async.ID); !status.DeadLettered {
+		t.Fatalf("execution should have been dead lettered but is %+v", status)
+	}
+	produced := false
+	for _, exchange := range broker.History() {
+		if _, ok := exchange.Request.(*sarama.ProduceRequest); ok {
+			produced = true
+		}
+	}
+	if !produced {
+		t.Fatal("the record should have been published to the kafka topic")
+	}
+}
+
+func TestAsyncDeadLetterMQTTUnavailable(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "async": true,
+  "steps": [{"service": "users"}],
+  "deadLetter": {"mqtt": {"brokers": "tcp://`+address+`", "topic": "failures"}}
+}]`, map[string]string{"users": "fail=true"})
+	async, run := startAsync(exec, nil)
+	run()
+
+	if status, _ := LookupAsync(async.ID); status.Status != AsyncFailed || status.DeadLettered {
+		t.Fatalf("execution should have failed without being dead lettered but is %+v", status)
+	}
+}
+
+func TestWaitAsync(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "async": true,
+  "steps": [{"service": "slow"}]
+}]`, map[string]string{"slow": "delay=1s"})
+	async, run := startAsync(exec, nil)
+	go run()
+
+	err := WaitAsync(50 * time.Millisecond)
+	if err == nil {
+		t.Fatal("waiting should time out")
+	}
+	if status, _ := LookupAsync(async.ID); status.Status != AsyncFailed {
+		t.Fatalf("a canceled execution should have failed but is %+v", status)
+	}
+	if err = WaitAsync(time.Second); err != nil {
+		t.Fatalf("nothing should be in flight but got %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	AsyncHandler("/executions").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/executions/"+async.ID, nil))
+	if !strings.Contains(recorder.Body.String(), `"status":"failed"`) {
+		t.Fatalf("execution status should be served but got %s", recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	AsyncHandler("/executions").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/executions/unknown", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("an unknown execution should not be found but got %d", recorder.Code)
+	}
+
+	// An execution that ignores the cancellation is left behind.
+	stuck, _ := asyncs.start()
+	defer asyncs.finish(stuck, nil, false)
+	start := time.Now()
+	if err = WaitAsync(50 * time.Millisecond); err == nil || time.Since(start) > time.Second {
+		t.Fatalf("waiting should give up on a stuck execution but got %v after %s", err, time.Since(start))
+	}
+}
+
+func TestValidateDeadLetter(t *testing.T) {
+	for _, route := range []types.Route{
+		{DeadLetter: &types.DeadLetter{File: "failed.log"}},
+		{Async: true, DeadLetter: &types.DeadLetter{}},
+		{Async: true, DeadLetter: &types.DeadLetter{File: "failed.log", Service: "sink"}},
+		{Async: true, DeadLetter: &types.DeadLetter{File: "failed.log", Kafka: &types.DeadLetterTopic{Brokers: "localhost:9092", Topic: "failures"}}},
+		{Async: true, DeadLetter: &types.DeadLetter{MQTT: &types.DeadLetterTopic{Topic: "failures"}}},
+	} {
+		if ValidateDeadLetter(route) == nil {
+			t.Fatalf("dead letter sink of %+v should be invalid", route)
+		}
+	}
+	if err := ValidateDeadLetter(types.Route{Async: true, DeadLetter: &types.DeadLetter{Service: "sink"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateDeadLetter(types.Route{Async: true, DeadLetter: &types.DeadLetter{MQTT: &types.DeadLetterTopic{Brokers: "tcp://localhost:1883", Topic: "failures"}}}); err != nil {
+		t.Fatal(err)
+	}
+}
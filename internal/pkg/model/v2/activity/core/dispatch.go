@@ -0,0 +1,217 @@
+package Core
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	mservice "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service"
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+)
+
+// Dispatch is the compiled execution plan of a single action. It is built once
+// from the routes and services inputs and reused across requests.
+type Dispatch struct {
+	Routes     []types.Route
+	Services   map[string]types.Service
+	Factories  map[string]mservice.Factory
+	Conditions map[string]*mservice.Program
+	Env        map[string]string
+}
+
+// Compile parses the raw routes and services of an action into a Dispatch.
+func Compile(rawRoutes, rawServices []interface{}) (*Dispatch, error) {
+	dispatch := &Dispatch{
+		Services:   make(map[string]types.Service),
+		Factories:  make(map[string]mservice.Factory),
+		Conditions: make(map[string]*mservice.Program),
+		Env:        environment(),
+	}
+
+	// Parse routes
+	routesJSON, err := json.Marshal(rawRoutes)
+	if err != nil {
+		log.Error("error loading routes")
+		return nil, err
+	}
+	err = json.Unmarshal(routesJSON, &dispatch.Routes)
+	if err != nil {
+		log.Error("error parsing routes")
+		return nil, err
+	}
+
+	// Parse services
+	var services []types.Service
+	servicesJSON, err := json.Marshal(rawServices)
+	if err != nil {
+		log.Error("error loading services")
+		return nil, err
+	}
+	err = json.Unmarshal(servicesJSON, &services)
+	if err != nil {
+		log.Error("error parsing services")
+		return nil, err
+	}
+	for _, service := range services {
+		dispatch.Services[service.Name] = service
+		dispatch.Factories[service.Name], err = factories.Lookup(service)
+		if err != nil {
+			log.Error("error starting service: ", service.Name)
+			return nil, err
+		}
+	}
+
+	// Precompile every condition so requests only have to run them.
+	for _, route := range dispatch.Routes {
+		dispatch.compileCondition(route.Condition)
+		dispatch.compileSteps(route.Steps)
+		for _, response := range route.Responses {
+			dispatch.compileCondition(response.Condition)
+		}
+		if route.OnTimeout != nil {
+			dispatch.compileCondition(route.OnTimeout.Condition)
+		}
+	}
+	return dispatch, nil
+}
+
+func (d *Dispatch) compileSteps(steps []types.Step) {
+	for _, step := range steps {
+		d.compileCondition(step.Condition)
+		if step.Parallel != nil {
+			for _, parallelStep := range step.Parallel.Steps {
+				d.compileSteps([]types.Step{{ParallelStep: parallelStep}})
+			}
+		}
+		if step.Retry != nil {
+			d.compileCondition(step.Retry.On)
+		}
+		if step.OnError != nil && step.OnError.Response != nil {
+			d.compileCondition(step.OnError.Response.Condition)
+		}
+	}
+}
+
+func (d *Dispatch) compileCondition(condition string) {
+	if condition == "" {
+		return
+	}
+	if _, exists := d.Conditions[condition]; exists {
+		return
+	}
+	d.Conditions[condition] = mservice.Compile("condition", condition)
+}
+
+// newVM sets up a conditional VM with the request defaults.
+func (d *Dispatch) newVM(payload interface{}, async bool) (*mservice.VM, error) {
+	vmDefaults := make(map[string]interface{})
+	if payload != nil {
+		vmDefaults["payload"] = payload
+	}
+	vmDefaults["async"] = async
+	vmDefaults["env"] = d.Env
+	return mservice.NewVM(vmDefaults)
+}
+
+// selectRoute evaluates route conditions to select which one to execute.
+func (d *Dispatch) selectRoute(vm *mservice.VM, trace *Trace) *types.Route {
+	for i := range d.Routes {
+		truthiness, err := d.evaluateTruthiness(d.Routes[i].Condition, vm)
+		trace.route(d.Routes[i].Condition, truthiness, err)
+		if err != nil {
+			continue
+		}
+		if truthiness {
+			log.Info("route identified via conditional evaluation to true: ", d.Routes[i].Condition)
+			return &d.Routes[i]
+		}
+	}
+	return nil
+}
+
+func (d *Dispatch) evaluateTruthiness(condition string, vm *mservice.VM) (truthy bool, err error) {
+	if condition == "" {
+		log.Debug("condition was empty and thus evaluates to true")
+		return true, nil
+	}
+	if program, ok := d.Conditions[condition]; ok {
+		truthy, err = vm.EvaluateProgramToBool(program)
+	} else {
+		truthy, err = vm.EvaluateToBool(condition)
+	}
+	if err != nil {
+		log.Debugf("condition evaluation causes error so is false: %s", condition)
+		return false, err
+	}
+	log.Debugf("condition evaluated to %t: %s", truthy, condition)
+	return truthy, err
+}
+
+// environment takes a snapshot of the ENV flags.
+func environment() map[string]string {
+	envFlags := make(map[string]string)
+	for _, e := range os.Environ() {
+		pair := strings.SplitN(e, "=", 2)
+		if len(pair) == 2 {
+			envFlags[pair[0]] = pair[1]
+		}
+	}
+	return envFlags
+}
+
+// Dispatches holds the compiled Dispatch of each action keyed by identifier.
+type Dispatches struct {
+	dispatches map[string]*Dispatch
+	sync.RWMutex
+}
+
+var dispatches = Dispatches{
+	dispatches: make(map[string]*Dispatch),
+}
+
+// Lookup returns the Dispatch for the identified action, compiling it from the
+// raw routes and services if it has not been registered yet.
+func (d *Dispatches) Lookup(identifier string, rawRoutes, rawServices []interface{}) (*Dispatch, error) {
+	d.RLock()
+	dispatch := d.dispatches[identifier]
+	d.RUnlock()
+
+	if dispatch != nil {
+		return dispatch, nil
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	if dispatch = d.dispatches[identifier]; dispatch != nil {
+		return dispatch, nil
+	}
+	dispatch, err := Compile(rawRoutes, rawServices)
+	if err != nil {
+		return nil, err
+	}
+	d.dispatches[identifier] = dispatch
+	return dispatch, nil
+}
+
+// Register compiles and stores the Dispatch for the identified action.
+func Register(identifier string, rawRoutes, rawServices []interface{}) error {
+	dispatch, err := Compile(rawRoutes, rawServices)
+	if err != nil {
+		return err
+	}
+	dispatches.Lock()
+	dispatches.dispatches[identifier] = dispatch
+	dispatches.Unlock()
+	return nil
+}
+
+// Reset discards every compiled Dispatch, closes the service factories and
+// forgets the metrics of their HTTP services.
+func Reset() {
+	dispatches.Lock()
+	dispatches.dispatches = make(map[string]*Dispatch)
+	dispatches.Unlock()
+	factories.Close()
+	mservice.ResetHTTPMetrics()
+}
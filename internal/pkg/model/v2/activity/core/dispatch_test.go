@@ -0,0 +1,157 @@
+package Core
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/TIBCOSoftware/flogo-lib/logger"
+)
+
+const (
+	testRoutes = `[
+  {
+    "if": "payload.pathParams.petId >= 8 && payload.pathParams.petId <= 15",
+    "steps": [
+      {"service": "PetStorePets", "input": {"method": "GET", "pathParams.id": "${payload.pathParams.petId}"}}
+    ],
+    "responses": [
+      {"if": "PetStorePets.response.body.status == 'available'", "error": false, "output": {"code": 200, "data": "${PetStorePets.response.body}"}}
+    ]
+  },
+  {
+    "if": "payload.pathParams.petId == 20 || env.PETS_ENABLED == 'true'",
+    "steps": [
+      {"if": "payload.pathParams.petId == 20", "service": "PetStorePets", "input": {"method": "GET"}}
+    ]
+  },
+  {
+    "steps": [
+      {"service": "PetStorePets", "input": {"method": "GET"}}
+    ],
+    "responses": [
+      {"error": true, "output": {"code": 404, "data": {"error": "not found"}}}
+    ]
+  }
+]`
+	testServices = `[
+  {"name": "PetStorePets", "type": "http", "settings": {"url": "http://petstore.swagger.io/v2/pet/:id"}}
+]`
+)
+
+func testInputs(t testing.TB) (routes, services []interface{}) {
+	err := json.Unmarshal([]byte(testRoutes), &routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal([]byte(testServices), &services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routes, services
+}
+
+func testPayload(petID float64) interface{} {
+	return map[string]interface{}{
+		"pathParams": map[string]interface{}{"petId": petID},
+	}
+}
+
+func TestCompile(t *testing.T) {
+	routes, services := testInputs(t)
+	dispatch, err := Compile(routes, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dispatch.Routes) != 3 {
+		t.Fatalf("there should be 3 routes but there are %d", len(dispatch.Routes))
+	}
+	if _, ok := dispatch.Services["PetStorePets"]; !ok {
+		t.Fatal("PetStorePets service should be in the service map")
+	}
+	if len(dispatch.Conditions) != 4 {
+		t.Fatalf("there should be 4 compiled conditions but there are %d", len(dispatch.Conditions))
+	}
+
+	test := func(petID float64, route int) {
+		vm, err := dispatch.newVM(testPayload(petID), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		selected := dispatch.selectRoute(vm, nil)
+		if selected != &dispatch.Routes[route] {
+			t.Fatalf("pet %v should select route %d", petID, route)
+		}
+	}
+	test(9, 0)
+	test(20, 1)
+	test(1, 2)
+}
+
+func TestDispatchesLookup(t *testing.T) {
+	defer Reset()
+	routes, services := testInputs(t)
+	a, err := dispatches.Lookup("test", routes, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := dispatches.Lookup("test", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Fatal("dispatch should only be compiled once")
+	}
+	Reset()
+	c, err := dispatches.Lookup("test", routes, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == c {
+		t.Fatal("dispatch should be recompiled after a reset")
+	}
+}
+
+// BenchmarkDispatchPerRequest measures the previous behavior where routes and
+// services are parsed and the environment is copied for every request.
+func BenchmarkDispatchPerRequest(b *testing.B) {
+	log.SetLogLevel(logger.ErrorLevel)
+	defer log.SetLogLevel(logger.InfoLevel)
+	routes, services := testInputs(b)
+	payload := testPayload(20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dispatch, err := Compile(routes, services)
+		if err != nil {
+			b.Fatal(err)
+		}
+		vm, err := dispatch.newVM(payload, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if dispatch.selectRoute(vm, nil) == nil {
+			b.Fatal("a route should be selected")
+		}
+	}
+}
+
+// BenchmarkDispatchPrecompiled measures requests against a Dispatch compiled once.
+func BenchmarkDispatchPrecompiled(b *testing.B) {
+	log.SetLogLevel(logger.ErrorLevel)
+	defer log.SetLogLevel(logger.InfoLevel)
+	routes, services := testInputs(b)
+	payload := testPayload(20)
+	dispatch, err := Compile(routes, services)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm, err := dispatch.newVM(payload, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if dispatch.selectRoute(vm, nil) == nil {
+			b.Fatal("a route should be selected")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package Core
+
+import (
+	"fmt"
+	"net"
+
+	mservice "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service"
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+)
+
+const (
+	// ErrorTypeTimeout is the type of an error caused by a timeout.
+	ErrorTypeTimeout = "timeout"
+	// ErrorTypeNetwork is the type of an error caused by the network.
+	ErrorTypeNetwork = "network"
+	// ErrorTypeScriptTimeout is the type of an error caused by a script that
+	// exceeded its time limit.
+	ErrorTypeScriptTimeout = "scriptTimeout"
+	// ErrorTypeScriptMemory is the type of an error caused by a script that
+	// exceeded its memory limit.
+	ErrorTypeScriptMemory = "scriptMemory"
+	// ErrorTypeCircuitOpen is the type of an error caused by a call that failed
+	// fast because the circuit breaker of its upstream is open.
+	ErrorTypeCircuitOpen = "circuitOpen"
+	// ErrorTypeService is the type of any other service error.
+	ErrorTypeService = "service"
+)
+
+// StepError is the error of a failed step. Its details are exposed to later
+// conditions and mappings as error.step, error.service, error.message and
+// error.type.
+type StepError struct {
+	Step     string
+	Service  string
+	Err      error
+	Response *types.Response
+}
+
+func newStepError(step, service string, err error) *StepError {
+	if stepErr, ok := err.(*StepError); ok {
+		return &StepError{Step: stepErr.Step, Service: stepErr.Service, Err: stepErr.Err, Response: stepErr.Response}
+	}
+	return &StepError{Step: step, Service: service, Err: err}
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("error executing service %s: %v", e.Service, e.Err)
+}
+
+// Type classifies the underlying error.
+func (e *StepError) Type() string {
+	switch e.Err.(type) {
+	case *mservice.TimeoutError:
+		return ErrorTypeScriptTimeout
+	case *mservice.MemoryError:
+		return ErrorTypeScriptMemory
+	case *mservice.CircuitOpenError:
+		return ErrorTypeCircuitOpen
+	}
+	if netErr, ok := e.Err.(net.Error); ok {
+		if netErr.Timeout() {
+			return ErrorTypeTimeout
+		}
+		return ErrorTypeNetwork
+	}
+	return ErrorTypeService
+}
+
+// Details returns the error as it is exposed to conditions and mappings.
+func (e *StepError) Details() map[string]interface{} {
+	return map[string]interface{}{
+		"step":    e.Step,
+		"service": e.Service,
+		"message": e.Err.Error(),
+		"type":    e.Type(),
+	}
+}
@@ -0,0 +1,388 @@
+package Core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mservice "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service"
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+	"github.com/TIBCOSoftware/mashling/lib/util"
+)
+
+// reserved are the names of the execution context that a step cannot use.
+var reserved = map[string]bool{
+	"payload": true,
+	"env":     true,
+	"async":   true,
+	"asyncId": true,
+	"error":   true,
+}
+
+// IsReserved reports whether a step name is reserved by the execution context.
+func IsReserved(name string) bool {
+	return reserved[name]
+}
+
+// StepName returns the name the results of a step are kept under.
+func StepName(step types.Step) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	return step.Service
+}
+
+const (
+	// WaitAll continues a route once every step of a parallel group has completed.
+	WaitAll = "all"
+	// WaitFirst continues a route once the first step of a parallel group has succeeded.
+	WaitFirst = "first"
+)
+
+// DefaultTimeoutResponse is returned when a route exceeds its deadline and
+// has no on timeout response.
+var DefaultTimeoutResponse = types.Response{
+	Error: true,
+	Output: types.Output{
+		Code: 504,
+		Data: map[string]interface{}{"error": "gateway timeout"},
+	},
+}
+
+// execution contains all elements of a request: right now just payload,
+// environment flags, service instances and the conditional VM. It is safe for
+// concurrent use by the steps of a parallel group. Services are executed with
+// its context, which carries the request and route deadlines.
+type execution struct {
+	ctx context.Context
+	*executionState
+}
+
+// executionState is the state that the branches of a parallel group share
+// with the execution of their route.
+type executionState struct {
+	dispatch  *Dispatch
+	context   map[string]interface{}
+	vm        *mservice.VM
+	trace     *Trace
+	releasers []mservice.Releaser
+	sync.Mutex
+}
+
+// result is a service instance or error details waiting to be committed to
+// the execution.
+type result struct {
+	name  string
+	value interface{}
+}
+
+// requestContext returns the context a trigger attached to the payload: the
+// tracing context of the REST trigger or the call context of the gRPC trigger.
+// It is done when the client goes away or its deadline is exceeded.
+func requestContext(payload interface{}) context.Context {
+	if p, ok := payload.(map[string]interface{}); ok {
+		if ctx, ok := p["tracing"].(context.Context); ok {
+			return ctx
+		}
+		if grpcData, ok := p["grpcData"].(map[string]interface{}); ok {
+			if ctx, ok := grpcData["contextdata"].(context.Context); ok {
+				return ctx
+			}
+		}
+	}
+	return context.Background()
+}
+
+func newExecution(ctx context.Context, dispatch *Dispatch, payload interface{}, async bool) (*execution, error) {
+	vm, err := dispatch.newVM(payload, async)
+	if err != nil {
+		return nil, err
+	}
+	e := &execution{
+		ctx: ctx,
+		executionState: &executionState{
+			dispatch: dispatch,
+			context:  make(map[string]interface{}),
+			vm:       vm,
+		},
+	}
+	e.context["payload"] = &payload
+	e.context["env"] = dispatch.Env
+	if traceRequested(payload) {
+		e.trace = newTrace()
+	}
+	return e, nil
+}
+
+// branch returns an execution that shares the state of e and executes its
+// services with ctx.
+func (e *execution) branch(ctx context.Context) *execution {
+	return &execution{ctx: ctx, executionState: e.executionState}
+}
+
+// evaluate evaluates a condition in the VM of the execution.
+func (e *execution) evaluate(condition string) (truthy bool, err error) {
+	e.Lock()
+	defer e.Unlock()
+	return e.dispatch.evaluateTruthiness(condition, e.vm)
+}
+
+// translate resolves mappings against the execution context and any results
+// that have not been committed yet.
+func (e *execution) translate(mappings map[string]interface{}, pending ...result) (values map[string]interface{}, err error) {
+	e.Lock()
+	defer e.Unlock()
+	if len(pending) == 0 {
+		return translateMappings(&e.context, mappings)
+	}
+	context := make(map[string]interface{}, len(e.context)+len(pending))
+	for name, value := range e.context {
+		context[name] = value
+	}
+	for _, r := range pending {
+		context[r.name] = r.value
+	}
+	return translateMappings(&context, mappings)
+}
+
+// output translates the data of a response output into the reply for the
+// trigger, with the content type, headers and trace ID attached.
+func (e *execution) output(output types.Output) (data interface{}, err error) {
+	if nestedData, ok := output.Data.(map[string]interface{}); ok {
+		data, err = e.translate(nestedData)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		interimData, err := e.translate(map[string]interface{}{"data": output.Data})
+		if err != nil {
+			return nil, err
+		}
+		data, ok = interimData["data"]
+		if !ok {
+			return nil, errors.New("cannot extract data from response output")
+		}
+	}
+	if output.ContentType != "" || len(output.Headers) > 0 {
+		data, err = e.reply(output, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return e.trace.attach(data), nil
+}
+
+// reply wraps translated response data together with the translated content
+// type and headers of the output in the meta keys understood by the triggers.
+// Without a content type, data that is the body of a service keeps its own.
+func (e *execution) reply(output types.Output, data interface{}) (interface{}, error) {
+	values, err := e.translate(map[string]interface{}{"contentType": output.ContentType})
+	if err != nil {
+		return nil, err
+	}
+	headers, err := e.translate(output.Headers)
+	if err != nil {
+		return nil, err
+	}
+	reply := map[string]interface{}{
+		util.MetaBody:    data,
+		util.MetaHeaders: headers,
+	}
+	if contentType, ok := values["contentType"].(string); ok && contentType != "" {
+		reply[util.MetaMIME] = contentType
+	} else if body, ok := data.(map[string]interface{}); ok {
+		if mime, ok := body[util.MetaMIME]; ok {
+			reply[util.MetaMIME] = mime
+		}
+	}
+	return reply, nil
+}
+
+// commit makes service instances and errors visible to later conditions and
+// mappings.
+func (e *execution) commit(results []result) (err error) {
+	e.Lock()
+	defer e.Unlock()
+	for _, r := range results {
+		value := r.value
+		e.context[r.name] = &value
+		vmErr := e.vm.SetInVM(r.name, value)
+		if vmErr != nil {
+			err = vmErr
+		}
+	}
+	return err
+}
+
+// executeRoute executes the steps of a route within the route timeout.
+func (e *execution) executeRoute(route *types.Route) (err error) {
+	if route.Timeout != "" {
+		timeout, err := time.ParseDuration(route.Timeout)
+		if err != nil {
+			return err
+		}
+		var cancel context.CancelFunc
+		e.ctx, cancel = context.WithTimeout(e.ctx, timeout)
+		defer cancel()
+	}
+	for _, step := range route.Steps {
+		if err = e.ctx.Err(); err != nil {
+			return err
+		}
+		results, sErr := e.executeStep(step)
+		err = e.commit(results)
+		if sErr != nil {
+			return sErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// release releases the resources that the services of the route hold until
+// it finishes.
+func (e *execution) release() {
+	e.Lock()
+	releasers := e.releasers
+	e.releasers = nil
+	e.Unlock()
+	for _, releaser := range releasers {
+		releaser.Release()
+	}
+}
+
+// timedOut reports whether the deadline of the request or route was exceeded.
+func (e *execution) timedOut() bool {
+	return e.ctx.Err() == context.DeadlineExceeded
+}
+
+func (e *execution) executeStep(step types.Step) (results []result, err error) {
+	truthiness, err := e.evaluate(step.Condition)
+	e.trace.step(StepName(step), step.Service, step.Condition, truthiness, err)
+	if err != nil {
+		return e.handleError(step, nil, err)
+	}
+	if !truthiness {
+		return nil, nil
+	}
+	switch {
+	case step.Parallel != nil:
+		results, err = e.executeParallel(step.Parallel)
+	case step.Foreach != nil:
+		results, err = e.executeForeach(step)
+	default:
+		results, err = e.invokeStep(step)
+	}
+	if err != nil {
+		return e.handleError(step, results, err)
+	}
+	return results, nil
+}
+
+// handleError applies the error policy of a failed step. The fallback service
+// is tried first and sees the error of the step. If it fails too, or there is
+// no fallback, the step either jumps to its error response, continues or
+// aborts the route.
+func (e *execution) handleError(step types.Step, results []result, err error) ([]result, error) {
+	stepErr := newStepError(StepName(step), step.Service, err)
+	log.Error("error executing step: ", stepErr)
+	results = append(results, result{name: "error", value: stepErr.Details()})
+	policy := step.OnError
+	if policy == nil {
+		return results, stepErr
+	}
+	if policy.Service != "" {
+		fallbackResults, fallbackErr := e.invokeService(policy.Service, policy.Service, policy.Input, results...)
+		results = append(results, fallbackResults...)
+		if fallbackErr == nil {
+			return results, nil
+		}
+		stepErr = newStepError(policy.Service, policy.Service, fallbackErr)
+		log.Error("error executing fallback: ", stepErr)
+		results = append(results, result{name: "error", value: stepErr.Details()})
+	}
+	if policy.Response != nil {
+		stepErr.Response = policy.Response
+		return results, stepErr
+	}
+	if policy.Continue {
+		return results, nil
+	}
+	return results, stepErr
+}
+
+// executeParallel runs the steps of a parallel group concurrently. With WaitAll
+// the results of every step are returned along with the first error. With
+// WaitFirst only the results of the first step to succeed are returned; the
+// remaining steps are canceled and waited for, so that none of them uses the
+// execution after the route has finished.
+func (e *execution) executeParallel(parallel *types.Parallel) (results []result, err error) {
+	type outcome struct {
+		results []result
+		err     error
+	}
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+	branch := e.branch(ctx)
+	outcomes := make(chan outcome, len(parallel.Steps))
+	for _, step := range parallel.Steps {
+		go func(step types.ParallelStep) {
+			stepResults, stepErr := branch.executeStep(types.Step{ParallelStep: step})
+			outcomes <- outcome{results: stepResults, err: stepErr}
+		}(step)
+	}
+	for i := range parallel.Steps {
+		o := <-outcomes
+		if parallel.Wait == WaitFirst && o.err == nil && len(o.results) > 0 {
+			cancel()
+			for range parallel.Steps[i+1:] {
+				<-outcomes
+			}
+			return o.results, nil
+		}
+		results = append(results, o.results...)
+		if o.err != nil && err == nil {
+			err = o.err
+		}
+	}
+	return results, err
+}
+
+// invokeService executes the named service and returns its instance as a
+// result kept under the given step name.
+func (e *execution) invokeService(service, name string, input map[string]interface{}, pending ...result) (results []result, err error) {
+	serviceDef := e.dispatch.Services[service]
+	factory, ok := e.dispatch.Factories[service]
+	if !ok {
+		return nil, fmt.Errorf("unknown service: %s", service)
+	}
+	log.Info("invoking service type: ", serviceDef.Type)
+	serviceInstance, err := factory.New()
+	if err != nil {
+		return nil, err
+	}
+	if releaser, ok := serviceInstance.(mservice.Releaser); ok {
+		e.Lock()
+		e.releasers = append(e.releasers, releaser)
+		e.Unlock()
+	}
+	results = []result{{name: name, value: serviceInstance}}
+	start := time.Now()
+	values, err := e.translate(input, pending...)
+	if err != nil {
+		e.trace.invocation(name, service, start, input, nil, err)
+		return results, err
+	}
+	err = serviceInstance.UpdateRequest(values)
+	if err != nil {
+		e.trace.invocation(name, service, start, values, nil, err)
+		return results, err
+	}
+	err = serviceInstance.Execute(e.ctx)
+	e.trace.invocation(name, service, start, values, serviceInstance, err)
+	return results, err
+}
@@ -0,0 +1,661 @@
+package Core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mservice "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service"
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+	"github.com/TIBCOSoftware/mashling/lib/util"
+)
+
+// newTestBackend serves /<name>?delay=<duration> and replies with {"name": "<name>"}.
+func newTestBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if delay, err := time.ParseDuration(r.URL.Query().Get("delay")); err == nil {
+			time.Sleep(delay)
+		}
+		if r.URL.Query().Get("fail") == "true" {
+			hj, _ := w.(http.Hijacker)
+			conn, _, _ := hj.Hijack()
+			conn.Close()
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, `{"name": "`+strings.TrimPrefix(r.URL.Path, "/")+`"}`)
+	}))
+}
+
+// newTestExecution compiles the routes against http services named after the
+// backend paths with the given queries, plus any extra raw service definitions,
+// and returns an execution.
+func newTestExecution(t *testing.T, backend string, routes string, services map[string]string, extra ...interface{}) *execution {
+	var rawRoutes, rawServices []interface{}
+	err := json.Unmarshal([]byte(routes), &rawRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, query := range services {
+		rawServices = append(rawServices, map[string]interface{}{
+			"name":     name,
+			"type":     "http",
+			"settings": map[string]interface{}{"url": backend + "/" + name + "?" + query, "method": "GET"},
+		})
+	}
+	rawServices = append(rawServices, extra...)
+	dispatch, err := Compile(rawRoutes, rawServices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec, err := newExecution(context.Background(), dispatch, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exec
+}
+
+func responseName(t *testing.T, exec *execution, service string) string {
+	instance, ok := exec.context[service].(*interface{})
+	if !ok {
+		return ""
+	}
+	body, _ := (*instance).(*mservice.HTTP).Response.Body.(map[string]interface{})
+	name, _ := body["name"].(string)
+	return name
+}
+
+func TestExecuteParallelAll(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"parallel": {"steps": [
+      {"service": "users"},
+      {"service": "orders"},
+      {"if": "false", "service": "skipped"}
+    ]}},
+    {"if": "users.response.body.name == 'users' && orders.response.body.name == 'orders'", "service": "summary"}
+  ]
+}]`, map[string]string{"users": "delay=200ms", "orders": "delay=200ms", "skipped": "", "summary": ""})
+
+	start := time.Now()
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 400*time.Millisecond {
+		t.Fatalf("parallel steps should run concurrently but took %s", elapsed)
+	}
+	for _, service := range []string{"users", "orders", "summary"} {
+		if name := responseName(t, exec, service); name != service {
+			t.Fatalf("response of %s should be available but is %q", service, name)
+		}
+	}
+	if _, ok := exec.context["skipped"]; ok {
+		t.Fatal("skipped step should not have a response")
+	}
+}
+
+func TestExecuteParallelFirst(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"parallel": {"wait": "first", "steps": [
+      {"service": "broken"},
+      {"service": "fast"},
+      {"service": "slow"}
+    ]}}
+  ]
+}]`, map[string]string{"broken": "fail=true", "fast": "delay=50ms", "slow": "delay=500ms"})
+
+	start := time.Now()
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Fatalf("route should continue after the first success but took %s", elapsed)
+	}
+	if name := responseName(t, exec, "fast"); name != "fast" {
+		t.Fatalf("response of fast should be available but is %q", name)
+	}
+	for _, service := range []string{"broken", "slow"} {
+		if _, ok := exec.context[service]; ok {
+			t.Fatalf("response of %s should not be available", service)
+		}
+	}
+}
+
+func TestExecuteParallelError(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"parallel": {"steps": [
+      {"service": "broken"},
+      {"service": "users"}
+    ]}},
+    {"service": "summary"}
+  ]
+}]`, map[string]string{"broken": "fail=true", "users": "", "summary": ""})
+
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err == nil {
+		t.Fatal("a failing step should fail the parallel group")
+	}
+	if name := responseName(t, exec, "users"); name != "users" {
+		t.Fatalf("response of users should be available but is %q", name)
+	}
+	if _, ok := exec.context["summary"]; ok {
+		t.Fatal("steps after a failed parallel group should not be executed")
+	}
+}
+
+// fallbackService echoes the error of the failed step in its result.
+var fallbackService = map[string]interface{}{
+	"name":     "fallback",
+	"type":     "js",
+	"settings": map[string]interface{}{"script": "result.failed = parameters.failed; result.message = parameters.message"},
+}
+
+func errorDetails(t *testing.T, exec *execution) map[string]interface{} {
+	details, ok := exec.context["error"].(*interface{})
+	if !ok {
+		t.Fatal("error details should be available")
+	}
+	return (*details).(map[string]interface{})
+}
+
+func TestExecuteStepContinueOnError(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"service": "broken", "onError": {"continue": true}},
+    {"if": "error.service == 'broken' && error.type == 'network'", "service": "users"}
+  ]
+}]`, map[string]string{"broken": "fail=true", "users": ""})
+
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := responseName(t, exec, "users"); name != "users" {
+		t.Fatalf("route should continue after the error but users response is %q", name)
+	}
+	if details := errorDetails(t, exec); details["message"] == "" {
+		t.Fatal("error message should be available")
+	}
+}
+
+func TestExecuteStepFallback(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"service": "broken", "onError": {"service": "fallback", "input": {"parameters.failed": "${error.service}", "parameters.message": "${error.message}"}}},
+    {"if": "fallback.response.result.failed == 'broken'", "service": "users"}
+  ]
+}]`, map[string]string{"broken": "fail=true", "users": ""}, fallbackService)
+
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := responseName(t, exec, "users"); name != "users" {
+		t.Fatalf("route should continue after the fallback but users response is %q", name)
+	}
+	fallback, ok := exec.context["fallback"].(*interface{})
+	if !ok {
+		t.Fatal("fallback response should be available")
+	}
+	result := (*fallback).(*mservice.JS).Response.Result
+	if result["message"] != errorDetails(t, exec)["message"] {
+		t.Fatalf("fallback should see the error message but got %v", result["message"])
+	}
+}
+
+func TestExecuteStepErrorResponse(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"service": "broken", "onError": {"continue": true, "response": {"error": true, "output": {"code": 503, "data": "${error.message}"}}}},
+    {"service": "users"}
+  ]
+}]`, map[string]string{"broken": "fail=true", "users": ""})
+
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	stepErr, ok := err.(*StepError)
+	if !ok {
+		t.Fatalf("route should fail with a step error but got %v", err)
+	}
+	if stepErr.Service != "broken" || stepErr.Response == nil || stepErr.Response.Output.Code != 503 {
+		t.Fatalf("step error should carry the dedicated response of broken but is %+v", stepErr)
+	}
+	if _, ok := exec.context["users"]; ok {
+		t.Fatal("steps after a dedicated error response should not be executed")
+	}
+}
+
+func TestExecuteParallelErrorResponse(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"parallel": {"steps": [
+      {"service": "broken", "onError": {"response": {"error": true, "output": {"code": 502}}}},
+      {"service": "users"}
+    ]}}
+  ]
+}]`, map[string]string{"broken": "fail=true", "users": ""})
+
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	stepErr, ok := err.(*StepError)
+	if !ok || stepErr.Service != "broken" || stepErr.Response == nil {
+		t.Fatalf("parallel group should fail with the step error of broken but got %v", err)
+	}
+	if details := errorDetails(t, exec); details["service"] != "broken" {
+		t.Fatalf("error service should be broken but is %v", details["service"])
+	}
+}
+
+func TestExecuteStepNames(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	echo := map[string]interface{}{
+		"name":     "echo",
+		"type":     "js",
+		"settings": map[string]interface{}{"script": "result.value = parameters.value"},
+	}
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"name": "getUser", "service": "echo", "input": {"parameters.value": "user"}},
+    {"name": "getOrders", "service": "echo", "input": {"parameters.value": "orders"}},
+    {"if": "getUser.response.result.value == 'user' && getOrders.response.result.value == 'orders'", "service": "users"}
+  ]
+}]`, map[string]string{"users": ""}, echo)
+
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := responseName(t, exec, "users"); name != "users" {
+		t.Fatalf("named steps should keep separate results but users response is %q", name)
+	}
+	if _, ok := exec.context["echo"]; ok {
+		t.Fatal("results of named steps should not be kept under the service name")
+	}
+}
+
+func TestExecutionReply(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{"steps": [{"service": "users"}]}]`, map[string]string{"users": ""})
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := exec.reply(types.Output{
+		ContentType: "text/plain",
+		Headers:     map[string]interface{}{"Location": "${users.response.body.name}", "Cache-Control": "no-cache"},
+	}, "created")
+	if err != nil {
+		t.Fatal(err)
+	}
+	object := reply.(map[string]interface{})
+	if object[util.MetaMIME] != "text/plain" || object[util.MetaBody] != "created" {
+		t.Fatalf("reply should carry the content type and data but is %v", object)
+	}
+	headers := util.ReplyHeaders(object)
+	if headers["Location"][0] != "users" || headers["Cache-Control"][0] != "no-cache" {
+		t.Fatalf("reply headers should be translated but are %v", headers)
+	}
+}
+
+var (
+	image = []byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0xff}
+	feed  = `<feed><entry id="1">first</entry></feed>`
+)
+
+// newContentBackend serves a PNG image at /image, an XML feed at /feed and
+// {"name": "<name>"} at any other path.
+func newContentBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(image)
+		case "/feed":
+			w.Header().Set("Content-Type", "application/xml")
+			io.WriteString(w, feed)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"name": "`+strings.TrimPrefix(r.URL.Path, "/")+`"}`)
+		}
+	}))
+}
+
+func TestExecutionReplyPassThrough(t *testing.T) {
+	defer Reset()
+	backend := newContentBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{"steps": [{"service": "image"}, {"service": "feed"}]}]`, map[string]string{"image": "", "feed": ""})
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		service, mime string
+		body          []byte
+	}{
+		{"image", "image/png", image},
+		{"feed", "application/xml", []byte(feed)},
+	} {
+		values, err := exec.translate(map[string]interface{}{"data": "${" + test.service + ".response.body}"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply, err := exec.reply(types.Output{Headers: map[string]interface{}{"X-Custom": "custom"}}, values["data"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		object := reply.(map[string]interface{})
+		if object[util.MetaMIME] != test.mime {
+			t.Fatalf("reply of %s should keep the content type %s but has %v", test.service, test.mime, object[util.MetaMIME])
+		}
+		if headers := util.ReplyHeaders(object); headers["X-Custom"][0] != "custom" {
+			t.Fatalf("reply of %s should carry the custom header but has %v", test.service, headers)
+		}
+		data, err := util.Marshal(reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.service == "feed" {
+			var expected, actual interface{}
+			util.XMLUnmarshal([]byte(feed), &expected)
+			if err = util.XMLUnmarshal(data, &actual); err != nil {
+				t.Fatalf("reply of feed should be XML but is %s", data)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("reply of feed should be %s but is %s", feed, data)
+			}
+		} else if !bytes.Equal(data, test.body) {
+			t.Fatalf("reply of %s should be passed through but is %q", test.service, data)
+		}
+	}
+}
+
+func TestResetHTTPMetrics(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{"steps": [{"service": "users"}]}]`, map[string]string{"users": ""})
+	if err := exec.executeRoute(&exec.dispatch.Routes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if metrics := mservice.HTTPTransportMetrics()["users"]; metrics.Requests != 1 {
+		t.Fatalf("metrics should count the request of users but are %+v", metrics)
+	}
+	Reset()
+	if _, ok := mservice.HTTPTransportMetrics()["users"]; ok {
+		t.Fatal("a reset should forget the metrics of the services")
+	}
+}
+
+func TestExecuteRouteTimeout(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "timeout": "100ms",
+  "steps": [
+    {"service": "slow"},
+    {"service": "users"}
+  ]
+}]`, map[string]string{"slow": "delay=500ms", "users": ""})
+
+	start := time.Now()
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err == nil {
+		t.Fatal("route should fail once its timeout is exceeded")
+	}
+	if elapsed := time.Since(start); elapsed >= 400*time.Millisecond {
+		t.Fatalf("route should be cancelled after its timeout but took %s", elapsed)
+	}
+	if !exec.timedOut() {
+		t.Fatal("execution should report the exceeded deadline")
+	}
+	if details := errorDetails(t, exec); details["type"] != ErrorTypeTimeout {
+		t.Fatalf("error type should be timeout but is %v", details["type"])
+	}
+	if _, ok := exec.context["users"]; ok {
+		t.Fatal("steps after the timeout should not be executed")
+	}
+}
+
+func TestExecuteRouteCancel(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{"steps": [{"service": "slow"}]}]`, map[string]string{"slow": "delay=500ms"})
+	ctx, cancel := context.WithCancel(context.Background())
+	exec.ctx = ctx
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err == nil {
+		t.Fatal("route should fail once the request is cancelled")
+	}
+	if elapsed := time.Since(start); elapsed >= 400*time.Millisecond {
+		t.Fatalf("route should stop when the request is cancelled but took %s", elapsed)
+	}
+	if exec.timedOut() {
+		t.Fatal("a cancelled request is not a timeout")
+	}
+}
+
+func TestExecuteStepScriptTimeout(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	spin := map[string]interface{}{
+		"name":     "spin",
+		"type":     "js",
+		"settings": map[string]interface{}{"script": "while (true) {}", "timeout": "50ms"},
+	}
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"service": "spin", "onError": {"continue": true}},
+    {"if": "error.type == 'scriptTimeout'", "service": "users"}
+  ]
+}]`, map[string]string{"users": ""}, spin)
+
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := responseName(t, exec, "users"); name != "users" {
+		t.Fatalf("a script timeout should be exposed as its own error type but users response is %q", name)
+	}
+}
+
+func TestExecuteCache(t *testing.T) {
+	defer Reset()
+	var calls, revalidations int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&revalidations, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"name": "users"}`)
+	}))
+	defer backend.Close()
+
+	cache := map[string]interface{}{"name": "cache", "type": "cache", "settings": map[string]interface{}{}}
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"service": "cache", "input": {"key": "users:${payload.id}"}},
+    {"if": "!cache.hit", "service": "users", "input": {"headers.If-None-Match": "${cache.etag}"}},
+    {"if": "!cache.hit", "service": "cache", "input": {"operation": "store", "key": "users:${payload.id}", "response": "${users.response}"}}
+  ]
+}]`, map[string]string{"users": ""}, cache)
+
+	for i := 0; i < 2; i++ {
+		exec, err := newExecution(context.Background(), exec.dispatch, map[string]interface{}{"id": 1.0}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = exec.executeRoute(&exec.dispatch.Routes[0]); err != nil {
+			t.Fatal(err)
+		}
+		instance := (*exec.context["cache"].(*interface{})).(*mservice.Cache)
+		if name := instance.Response["body"].(map[string]interface{})["name"]; name != "users" {
+			t.Fatalf("the cached response should be used but is %v", instance.Response)
+		}
+	}
+	if calls != 2 || revalidations != 1 {
+		t.Fatalf("the second request should revalidate the cached response but the backend was called %d times", calls)
+	}
+}
+
+func TestExecuteRateLimiterRelease(t *testing.T) {
+	defer Reset()
+	limiter := map[string]interface{}{"name": "limiter", "type": "ratelimiter", "settings": map[string]interface{}{
+		"limit":     "1",
+		"algorithm": "concurrency",
+	}}
+	dispatch := newTestExecution(t, "", `[{
+  "steps": [
+    {"service": "limiter", "input": {"token": "sally"}}
+  ]
+}]`, nil, limiter).dispatch
+
+	limitReached := func(exec *execution) bool {
+		if err := exec.executeRoute(&exec.dispatch.Routes[0]); err != nil {
+			t.Fatal(err)
+		}
+		return (*exec.context["limiter"].(*interface{})).(*mservice.RateLimiter).LimitReached
+	}
+	var executions []*execution
+	for i := 0; i < 3; i++ {
+		exec, err := newExecution(context.Background(), dispatch, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		executions = append(executions, exec)
+	}
+	if limitReached(executions[0]) || !limitReached(executions[1]) {
+		t.Fatal("a second route in flight should reach the limit")
+	}
+	executions[1].release()
+	executions[0].release()
+	if limitReached(executions[2]) {
+		t.Fatal("a finished route should release its request in flight")
+	}
+}
+
+func TestExecuteParallelFirstRelease(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	limiter := map[string]interface{}{"name": "limiter", "type": "ratelimiter", "settings": map[string]interface{}{
+		"limit":     "1",
+		"algorithm": "concurrency",
+	}}
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"parallel": {"wait": "first", "steps": [
+      {"service": "fast"},
+      {"service": "broken", "retry": {"attempts": 2, "delay": "100ms"}, "onError": {"service": "limiter", "input": {"token": "sally"}}}
+    ]}}
+  ]
+}]`, map[string]string{"fast": "delay=50ms", "broken": "fail=true"}, limiter)
+
+	if err := exec.executeRoute(&exec.dispatch.Routes[0]); err != nil {
+		t.Fatal(err)
+	}
+	exec.release()
+	time.Sleep(200 * time.Millisecond)
+
+	exec, err := newExecution(context.Background(), exec.dispatch, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exec.release()
+	results, err := exec.invokeService("limiter", "limiter", map[string]interface{}{"token": "sally"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].value.(*mservice.RateLimiter).LimitReached {
+		t.Fatal("the canceled steps of a parallel group should release their requests in flight")
+	}
+}
+
+func TestExecuteResilience(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	failing := map[string]interface{}{"name": "failing", "type": "http", "settings": map[string]interface{}{
+		"url":        backend.URL + "/failing?fail=true",
+		"method":     "GET",
+		"resilience": map[string]interface{}{"threshold": 1.0},
+	}}
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"service": "failing"}
+  ]
+}]`, nil, failing)
+
+	for _, errType := range []string{ErrorTypeNetwork, ErrorTypeCircuitOpen} {
+		exec, err := newExecution(context.Background(), exec.dispatch, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = exec.executeRoute(&exec.dispatch.Routes[0])
+		if stepErr, ok := err.(*StepError); !ok || stepErr.Type() != errType {
+			t.Fatalf("the step should fail with a %s error but got %v", errType, err)
+		}
+	}
+}
@@ -0,0 +1,909 @@
+package Core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A mapping value is a template. A template that is exactly one ${expression}
+// resolves to the value of the expression. Expressions embedded in a longer
+// string are interpolated and $${ escapes a literal ${. An embedded path whose
+// first name is not in the execution context, like ${HOME} in a shell snippet,
+// is kept as it is.
+//
+// An expression is a path into the execution context, a literal, or a call of
+// a builtin function:
+//
+//	users.response.body.items[0].id       array index, negative from the end
+//	users.response.body.items[*].id       every element
+//	users.response.body.items[1:3]        a slice
+//	users..id                             every id at any depth
+//	items[?(@.price < 10 && @.stock)]     a filter
+//	payload.query.limit ?? 10             a default value
+//	upper(payload.pathParams.name)        a function call
+//
+// Comparisons (==, !=, <, <=, >, >=) and the logical operators && and || can be
+// used anywhere, but are mostly useful in filters.
+
+// expression is a parsed mapping expression.
+type expression interface {
+	evaluate(s scope) (interface{}, error)
+}
+
+// scope is what an expression is evaluated against. The current node is the
+// array element a filter is applied to, referred to as @.
+type scope struct {
+	root    interface{}
+	current interface{}
+}
+
+// template is a parsed mapping value. The sources are the embedded
+// expressions as they were written.
+type template struct {
+	texts       []string
+	expressions []expression
+	sources     []string
+}
+
+var templates sync.Map
+
+// parseTemplate parses a mapping value. Parsed templates are cached.
+func parseTemplate(value string) (*template, error) {
+	if cached, ok := templates.Load(value); ok {
+		return cached.(*template), nil
+	}
+	t := &template{}
+	text := ""
+	p := &parser{input: value}
+	for p.pos < len(p.input) {
+		switch {
+		case strings.HasPrefix(p.input[p.pos:], "$${"):
+			text += "${"
+			p.pos += 3
+		case strings.HasPrefix(p.input[p.pos:], "${"):
+			start := p.pos
+			p.pos += 2
+			e, err := p.parseExpression()
+			if err != nil {
+				return nil, fmt.Errorf("invalid expression in %q: %v", value, err)
+			}
+			p.skipSpace()
+			if !p.consume("}") {
+				return nil, fmt.Errorf("invalid expression in %q: expected } at %d", value, p.pos)
+			}
+			t.texts = append(t.texts, text)
+			t.expressions = append(t.expressions, e)
+			t.sources = append(t.sources, p.input[start:p.pos])
+			text = ""
+		default:
+			text += p.input[p.pos : p.pos+1]
+			p.pos++
+		}
+	}
+	t.texts = append(t.texts, text)
+	templates.Store(value, t)
+	return t, nil
+}
+
+// evaluate resolves a template against the execution context.
+func (t *template) evaluate(root interface{}) (interface{}, error) {
+	s := scope{root: root}
+	if len(t.expressions) == 0 {
+		return t.texts[0], nil
+	}
+	if len(t.expressions) == 1 && t.texts[0] == "" && t.texts[1] == "" {
+		return t.expressions[0].evaluate(s)
+	}
+	var b strings.Builder
+	for i, e := range t.expressions {
+		b.WriteString(t.texts[i])
+		if !defined(e, root) {
+			b.WriteString(t.sources[i])
+			continue
+		}
+		value, err := e.evaluate(s)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(stringify(value))
+	}
+	b.WriteString(t.texts[len(t.texts)-1])
+	return b.String(), nil
+}
+
+// defined reports whether an expression is not a path or a path whose first
+// name is in the execution context.
+func defined(e expression, root interface{}) bool {
+	p, ok := e.(*path)
+	if !ok || p.relative || len(p.segments) == 0 {
+		return true
+	}
+	f, ok := p.segments[0].(*field)
+	context, isContext := root.(map[string]interface{})
+	if !ok || !isContext {
+		return true
+	}
+	_, ok = context[f.name]
+	return ok
+}
+
+// parser is a recursive descent parser of expressions.
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.input) && strings.ContainsRune(" \t\r\n", rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *parser) peek(token string) bool {
+	p.skipSpace()
+	return strings.HasPrefix(p.input[p.pos:], token)
+}
+
+func (p *parser) consume(token string) bool {
+	if p.peek(token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at %d", fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *parser) parseExpression() (expression, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expression, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{left: left, right: right}
+	}
+	return left, nil
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func (p *parser) parseComparison() (expression, error) {
+	left, err := p.parseCoalesce()
+	if err != nil {
+		return nil, err
+	}
+	for _, operator := range operators {
+		if p.consume(operator) {
+			right, err := p.parseCoalesce()
+			if err != nil {
+				return nil, err
+			}
+			return &comparison{operator: operator, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseCoalesce() (expression, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("??") {
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &coalesce{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (expression, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	c := p.input[p.pos]
+	switch {
+	case c == '(':
+		p.pos++
+		e, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+		return e, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &literal{value: s}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case c == '@':
+		p.pos++
+		segments, err := p.parseSegments()
+		if err != nil {
+			return nil, err
+		}
+		return &path{relative: true, segments: segments}, nil
+	}
+	name := p.parseName()
+	if name == "" {
+		return nil, p.errorf("unexpected %q", c)
+	}
+	switch name {
+	case "true":
+		return &literal{value: true}, nil
+	case "false":
+		return &literal{value: false}, nil
+	case "null":
+		return &literal{value: nil}, nil
+	}
+	if p.consume("(") {
+		return p.parseCall(name)
+	}
+	segments, err := p.parseSegments()
+	if err != nil {
+		return nil, err
+	}
+	return &path{segments: append([]segment{&field{name: name}}, segments...)}, nil
+}
+
+func (p *parser) parseString() (string, error) {
+	quote := p.input[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && p.pos < len(p.input):
+			b.WriteByte(p.input[p.pos])
+			p.pos++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *parser) parseNumber() (expression, error) {
+	start := p.pos
+	if p.input[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.input) && strings.ContainsRune("0123456789.eE", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	number, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return nil, p.errorf("invalid number %q", p.input[start:p.pos])
+	}
+	return &literal{value: number}, nil
+}
+
+// parseName parses a property or function name. Names may contain any
+// character that is not part of the expression syntax, such as the dashes of
+// header names.
+func (p *parser) parseName() string {
+	start := p.pos
+	for p.pos < len(p.input) && !strings.ContainsRune(" \t\r\n.[](),?'\"=!<>|&@*}", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *parser) parseCall(name string) (expression, error) {
+	function, ok := builtins[name]
+	if !ok {
+		return nil, p.errorf("unknown function %s", name)
+	}
+	c := &call{name: name, function: function}
+	if p.consume(")") {
+		return c, nil
+	}
+	for {
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+		if p.consume(")") {
+			return c, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected , or )")
+		}
+	}
+}
+
+// parseSegments parses the selections that follow the start of a path.
+func (p *parser) parseSegments() (segments []segment, err error) {
+	for p.pos < len(p.input) {
+		switch {
+		case strings.HasPrefix(p.input[p.pos:], ".."):
+			p.pos += 2
+			name := p.parseName()
+			if name == "" {
+				return nil, p.errorf("expected name after ..")
+			}
+			segments = append(segments, &descent{name: name})
+		case strings.HasPrefix(p.input[p.pos:], ".*"):
+			p.pos += 2
+			segments = append(segments, &wildcard{})
+		case p.input[p.pos] == '.':
+			p.pos++
+			name := p.parseName()
+			if name == "" {
+				return nil, p.errorf("expected name after .")
+			}
+			segments = append(segments, &field{name: name})
+		case p.input[p.pos] == '[':
+			p.pos++
+			s, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			if !p.consume("]") {
+				return nil, p.errorf("expected ]")
+			}
+			segments = append(segments, s)
+		default:
+			return segments, nil
+		}
+	}
+	return segments, nil
+}
+
+func (p *parser) parseBracket() (segment, error) {
+	switch {
+	case p.consume("*"):
+		return &wildcard{}, nil
+	case p.consume("?("):
+		condition, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+		return &filter{condition: condition}, nil
+	case p.peek("'") || p.peek("\""):
+		name, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &field{name: name}, nil
+	}
+	start, hasStart, err := p.parseInt()
+	if err != nil {
+		return nil, err
+	}
+	if !p.consume(":") {
+		if !hasStart {
+			return nil, p.errorf("expected index")
+		}
+		return &index{index: start}, nil
+	}
+	end, hasEnd, err := p.parseInt()
+	if err != nil {
+		return nil, err
+	}
+	s := &slice{}
+	if hasStart {
+		s.start = &start
+	}
+	if hasEnd {
+		s.end = &end
+	}
+	return s, nil
+}
+
+func (p *parser) parseInt() (int, bool, error) {
+	p.skipSpace()
+	start := p.pos
+	if p.pos < len(p.input) && p.input[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, false, nil
+	}
+	i, err := strconv.Atoi(p.input[start:p.pos])
+	if err != nil {
+		return 0, false, p.errorf("invalid index %q", p.input[start:p.pos])
+	}
+	return i, true, nil
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (l *literal) evaluate(s scope) (interface{}, error) {
+	return l.value, nil
+}
+
+// coalesce resolves to its right side when its left side is missing.
+type coalesce struct {
+	left, right expression
+}
+
+func (c *coalesce) evaluate(s scope) (interface{}, error) {
+	value, err := c.left.evaluate(s)
+	if err == nil && value != nil {
+		return value, nil
+	}
+	return c.right.evaluate(s)
+}
+
+type logical struct {
+	or          bool
+	left, right expression
+}
+
+func (l *logical) evaluate(s scope) (interface{}, error) {
+	left, err := l.left.evaluate(s)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(left) == l.or {
+		return l.or, nil
+	}
+	right, err := l.right.evaluate(s)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(right), nil
+}
+
+type comparison struct {
+	operator    string
+	left, right expression
+}
+
+func (c *comparison) evaluate(s scope) (interface{}, error) {
+	left, err := c.left.evaluate(s)
+	if err != nil {
+		return nil, err
+	}
+	right, err := c.right.evaluate(s)
+	if err != nil {
+		return nil, err
+	}
+	left, right = normalize(left), normalize(right)
+	switch c.operator {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	}
+	var order int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false, nil
+		}
+		switch {
+		case l < r:
+			order = -1
+		case l > r:
+			order = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false, nil
+		}
+		order = strings.Compare(l, r)
+	default:
+		return false, nil
+	}
+	switch c.operator {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	default:
+		return order >= 0, nil
+	}
+}
+
+type call struct {
+	name     string
+	function builtin
+	args     []expression
+}
+
+func (c *call) evaluate(s scope) (interface{}, error) {
+	args := make([]interface{}, len(c.args))
+	for i, arg := range c.args {
+		value, err := arg.evaluate(s)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	value, err := c.function(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", c.name, err)
+	}
+	return value, nil
+}
+
+// path selects values from the execution context, or from the current node
+// when it is relative. A path with a wildcard, slice, filter or descent
+// selects an array of values.
+type path struct {
+	relative bool
+	segments []segment
+}
+
+// segment is one selection of a path.
+type segment interface {
+	apply(node interface{}, s scope) ([]interface{}, error)
+	// selects reports whether the segment selects any number of values.
+	selects() bool
+}
+
+func (p *path) evaluate(s scope) (interface{}, error) {
+	start := s.root
+	if p.relative {
+		start = s.current
+	}
+	nodes := []interface{}{start}
+	multiple := false
+	for _, seg := range p.segments {
+		multiple = multiple || seg.selects()
+		var next []interface{}
+		for _, node := range nodes {
+			if node == nil {
+				continue
+			}
+			values, err := seg.apply(node, s)
+			if err != nil {
+				if multiple {
+					continue
+				}
+				return nil, err
+			}
+			for _, value := range values {
+				if value != nil || !multiple {
+					next = append(next, value)
+				}
+			}
+		}
+		nodes = next
+		if !multiple && (len(nodes) == 0 || nodes[0] == nil) {
+			return nil, nil
+		}
+	}
+	if multiple {
+		if nodes == nil {
+			nodes = []interface{}{}
+		}
+		return nodes, nil
+	}
+	return nodes[0], nil
+}
+
+type field struct {
+	name string
+}
+
+func (f *field) apply(node interface{}, s scope) ([]interface{}, error) {
+	v := indirect(node)
+	switch v.Kind() {
+	case reflect.Invalid:
+		return []interface{}{nil}, nil
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("array has no property named %s", f.name)
+		}
+		return (&index{index: i}).apply(node, s)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return []interface{}{nil}, nil
+		}
+		value := v.MapIndex(reflect.ValueOf(f.name).Convert(v.Type().Key()))
+		if !value.IsValid() {
+			return []interface{}{nil}, nil
+		}
+		return []interface{}{value.Interface()}, nil
+	}
+	value, err := getProperty(v.Interface(), f.name)
+	return []interface{}{value}, err
+}
+
+func (f *field) selects() bool {
+	return false
+}
+
+type index struct {
+	index int
+}
+
+func (i *index) apply(node interface{}, s scope) ([]interface{}, error) {
+	v := indirect(node)
+	if v.Kind() == reflect.Map {
+		return (&field{name: strconv.Itoa(i.index)}).apply(node, s)
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, errors.New("can only index arrays")
+	}
+	position := i.index
+	if position < 0 {
+		position += v.Len()
+	}
+	if position < 0 || position >= v.Len() {
+		return []interface{}{nil}, nil
+	}
+	return []interface{}{v.Index(position).Interface()}, nil
+}
+
+func (i *index) selects() bool {
+	return false
+}
+
+type slice struct {
+	start, end *int
+}
+
+func (sl *slice) apply(node interface{}, s scope) ([]interface{}, error) {
+	v := indirect(node)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, errors.New("can only slice arrays")
+	}
+	bound := func(i *int, fallback int) int {
+		if i == nil {
+			return fallback
+		}
+		b := *i
+		if b < 0 {
+			b += v.Len()
+		}
+		if b < 0 {
+			return 0
+		}
+		if b > v.Len() {
+			return v.Len()
+		}
+		return b
+	}
+	var values []interface{}
+	for i := bound(sl.start, 0); i < bound(sl.end, v.Len()); i++ {
+		values = append(values, v.Index(i).Interface())
+	}
+	return values, nil
+}
+
+func (sl *slice) selects() bool {
+	return true
+}
+
+// wildcard selects the elements of an array or the values of an object.
+type wildcard struct{}
+
+func (w *wildcard) apply(node interface{}, s scope) ([]interface{}, error) {
+	return children(node), nil
+}
+
+func (w *wildcard) selects() bool {
+	return true
+}
+
+// descent selects the properties with a name at any depth.
+type descent struct {
+	name string
+}
+
+func (d *descent) apply(node interface{}, s scope) ([]interface{}, error) {
+	var values []interface{}
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		if v := indirect(node); v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String {
+			if value := v.MapIndex(reflect.ValueOf(d.name).Convert(v.Type().Key())); value.IsValid() {
+				values = append(values, value.Interface())
+			}
+		}
+		for _, child := range children(node) {
+			walk(child)
+		}
+	}
+	walk(plain(node))
+	return values, nil
+}
+
+func (d *descent) selects() bool {
+	return true
+}
+
+// filter selects the elements of an array for which its condition is true.
+type filter struct {
+	condition expression
+}
+
+func (f *filter) apply(node interface{}, s scope) ([]interface{}, error) {
+	var values []interface{}
+	for _, element := range children(node) {
+		ok, err := f.condition.evaluate(scope{root: s.root, current: element})
+		if err != nil {
+			return nil, err
+		}
+		if truthy(ok) {
+			values = append(values, element)
+		}
+	}
+	return values, nil
+}
+
+func (f *filter) selects() bool {
+	return true
+}
+
+// indirect dereferences pointers and interfaces.
+func indirect(value interface{}) reflect.Value {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// children returns the elements of an array or the values of an object in
+// key order.
+func children(node interface{}) []interface{} {
+	v := indirect(node)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			values[i] = v.Index(i).Interface()
+		}
+		return values
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			values[i] = v.MapIndex(key).Interface()
+		}
+		return values
+	}
+	return nil
+}
+
+// plain converts service instances and other structs into their JSON form so
+// that they can be searched like any other object.
+func plain(node interface{}) interface{} {
+	v := indirect(node)
+	switch v.Kind() {
+	case reflect.Struct:
+		var value interface{}
+		data, err := json.Marshal(v.Interface())
+		if err != nil || json.Unmarshal(data, &value) != nil {
+			return nil
+		}
+		return value
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		values := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			values[key.String()] = plain(v.MapIndex(key).Interface())
+		}
+		return values
+	case reflect.Slice, reflect.Array:
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			values[i] = plain(v.Index(i).Interface())
+		}
+		return values
+	case reflect.Invalid:
+		return nil
+	}
+	return v.Interface()
+}
+
+// normalize converts numbers to float64 so that they compare like JSON numbers.
+func normalize(value interface{}) interface{} {
+	v := indirect(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Invalid:
+		return nil
+	}
+	return v.Interface()
+}
+
+// truthy reports whether a value counts as true in a logical expression or
+// filter. Only missing values, false, zero and empty strings are false.
+func truthy(value interface{}) bool {
+	switch v := normalize(value).(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// stringify formats a value for interpolation into a string.
+func stringify(value interface{}) string {
+	switch v := normalize(value).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []byte:
+		return string(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,194 @@
+package Core
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	mservice "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service"
+)
+
+func testContext() map[string]interface{} {
+	var users interface{} = &mservice.HTTP{
+		Response: mservice.HTTPResponse{
+			StatusCode: 200,
+			Body: map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"id": "a", "price": 5.0, "stock": true},
+					map[string]interface{}{"id": "b", "price": 15.0, "stock": true},
+					map[string]interface{}{"id": "c", "price": 8.0, "stock": false},
+				},
+			},
+		},
+	}
+	var payload interface{} = map[string]interface{}{
+		"pathParams": map[string]interface{}{"id": "42"},
+		"headers":    map[string]interface{}{"Content-Type": "application/json"},
+		"name":       " Jane ",
+	}
+	return map[string]interface{}{"users": &users, "payload": &payload}
+}
+
+func TestTemplates(t *testing.T) {
+	context := testContext()
+	tests := []struct {
+		template string
+		value    interface{}
+	}{
+		{"plain", "plain"},
+		{"${payload.pathParams.id}", "42"},
+		{"${payload.headers.Content-Type}", "application/json"},
+		{"${payload.headers['Content-Type']}", "application/json"},
+		{"${users.response.statusCode}", 200},
+		{"${users.response.body.items[1].id}", "b"},
+		{"${users.response.body.items[-1].id}", "c"},
+		{"${users.response.body.items.0.id}", "a"},
+		{"${users.response.body.items[5]}", nil},
+		{"${users.response.body.items[*].id}", []interface{}{"a", "b", "c"}},
+		{"${users.response.body.items[0:2].id}", []interface{}{"a", "b"}},
+		{"${users..id}", []interface{}{"a", "b", "c"}},
+		{"${users.response.body.items[?(@.price < 10 && @.stock)].id}", []interface{}{"a"}},
+		{"${users.response.body.items[?(@.id == payload.missing ?? 'b')].price}", []interface{}{15.0}},
+		{"${payload.missing ?? 'none'}", "none"},
+		{"/users/${payload.pathParams.id}/orders", "/users/42/orders"},
+		{"Bearer ${upper(payload.pathParams.id)}${length(users.response.body.items)}", "Bearer 423"},
+		{"${users.response.body.items[0].price} items", "5 items"},
+		{"$${literal}", "${literal}"},
+		{"${trim(payload.name)}", "Jane"},
+		{"${upper(trim(payload.name))}", "JANE"},
+		{"${substring('gateway', 0, 4)}", "gate"},
+		{"${substring('gateway', -3)}", "way"},
+		{"${replace('a-b-c', '-', '+')}", "a+b+c"},
+		{"${join(split('a,b', ','), '|')}", "a|b"},
+		{"${concat('a', 1, true)}", "a1true"},
+		{"${contains('gateway', 'way')}", true},
+		{"${default(payload.missing, '', 'x')}", "x"},
+		{"${base64Encode('user:pass')}", "dXNlcjpwYXNz"},
+		{"${base64Decode('dXNlcjpwYXNz')}", "user:pass"},
+		{"${urlEncode('a b&c')}", "a+b%26c"},
+		{"${json(users.response.body.items[0])}", `{"id":"a","price":5,"stock":true}`},
+		{"${md5('abc')}", "900150983cd24fb0d6963f7d28e17f72"},
+		{"${sha1('abc')}", "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		{"${sha256('abc')}", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"${hmacSha256('key', 'The quick brown fox jumps over the lazy dog')}", "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{"${formatTime(0, 'RFC3339')}", "1970-01-01T00:00:00Z"},
+		{"${formatTime('2018-03-07T10:00:00Z', '2006-01-02')}", "2018-03-07"},
+		{"${formatTime('2018-03-07T10:00:00Z', 'unix')}", int64(1520416800)},
+		{"${number(payload.pathParams.id)}", 42.0},
+		{"${int('42.9')}", 42},
+		{"${round(2.345, 2)}", 2.35},
+	}
+	for _, test := range tests {
+		parsed, err := parseTemplate(test.template)
+		if err != nil {
+			t.Fatalf("%s should parse but got %v", test.template, err)
+		}
+		value, err := parsed.evaluate(context)
+		if err != nil {
+			t.Fatalf("%s should evaluate but got %v", test.template, err)
+		}
+		if !reflect.DeepEqual(value, test.value) {
+			t.Fatalf("%s should be %#v but is %#v", test.template, test.value, value)
+		}
+	}
+}
+
+func TestTemplateFunctions(t *testing.T) {
+	context := testContext()
+	for template, pattern := range map[string]string{
+		"${uuid()}":     `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+		"${now()}":      `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`,
+		"${unixTime()}": `^\d+$`,
+	} {
+		parsed, err := parseTemplate(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := parsed.evaluate(context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(pattern).MatchString(stringify(value)) {
+			t.Fatalf("%s should match %s but is %v", template, pattern, value)
+		}
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	for _, template := range []string{
+		"${payload.id",
+		"${unknown(payload)}",
+		"${payload.items[}",
+		"${'unterminated}",
+		"${}",
+		"${payload.id + 1}",
+	} {
+		if _, err := parseTemplate(template); err == nil {
+			t.Fatalf("%s should not parse", template)
+		}
+	}
+	for _, template := range []string{
+		"${upper()}",
+		"${number('abc')}",
+		"${payload.name.first}",
+	} {
+		parsed, err := parseTemplate(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = parsed.evaluate(testContext()); err == nil {
+			t.Fatalf("%s should fail to evaluate", template)
+		}
+	}
+}
+
+func TestTranslateMappings(t *testing.T) {
+	context := testContext()
+	values, err := translateMappings(&context, map[string]interface{}{
+		"pathParams.id": "${payload.pathParams.id}",
+		"body": map[string]interface{}{
+			"ids":   []interface{}{"${users.response.body.items[0].id}", "literal"},
+			"count": 3,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"pathParams": map[string]interface{}{"id": "42"},
+		"body": map[string]interface{}{
+			"ids":   []interface{}{"a", "literal"},
+			"count": 3,
+		},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("values should be %v but are %v", expected, values)
+	}
+}
+
+func TestTranslateMappingsLiterals(t *testing.T) {
+	context := testContext()
+	mappings := map[string]interface{}{
+		"script": "echo ${HOME:-/root} && echo ${#PATH}",
+		"body": map[string]interface{}{
+			"js":    "const greet = name => { return `Hello ${name` }",
+			"exact": "${payload.pathParams.id",
+		},
+		"id": "${payload.pathParams.id}",
+	}
+	values, err := translateMappings(&context, mappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"script": "echo ${HOME:-/root} && echo ${#PATH}",
+		"body": map[string]interface{}{
+			"js":    "const greet = name => { return `Hello ${name` }",
+			"exact": "${payload.pathParams.id",
+		},
+		"id": "42",
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("values that do not parse should be kept as %v but are %v", expected, values)
+	}
+}
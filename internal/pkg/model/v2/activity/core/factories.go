@@ -0,0 +1,51 @@
+package Core
+
+import (
+	"sync"
+
+	mservice "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service"
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+)
+
+// Factories holds the started service factories of a gateway keyed by service
+// name. They are shared by every dispatch of the gateway.
+type Factories struct {
+	factories map[string]mservice.Factory
+	sync.Mutex
+}
+
+var factories = Factories{
+	factories: make(map[string]mservice.Factory),
+}
+
+// Lookup returns the started Factory for the service definition, creating and
+// starting it if it does not exist yet.
+func (f *Factories) Lookup(serviceDef types.Service) (mservice.Factory, error) {
+	f.Lock()
+	defer f.Unlock()
+	factory := f.factories[serviceDef.Name]
+	if factory != nil {
+		return factory, nil
+	}
+	factory = mservice.NewFactory(serviceDef)
+	err := factory.Start()
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("started service: ", serviceDef.Name)
+	f.factories[serviceDef.Name] = factory
+	return factory, nil
+}
+
+// Close closes and discards every Factory.
+func (f *Factories) Close() {
+	f.Lock()
+	defer f.Unlock()
+	for name, factory := range f.factories {
+		err := factory.Close()
+		if err != nil {
+			log.Errorf("error closing service %s: %v", name, err)
+		}
+		delete(f.factories, name)
+	}
+}
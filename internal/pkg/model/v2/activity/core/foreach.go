@@ -0,0 +1,112 @@
+package Core
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+)
+
+// DefaultForeachAs is the name an element is available under when none is configured.
+const DefaultForeachAs = "item"
+
+// ValidateForeach checks the settings of a foreach step.
+func ValidateForeach(step types.Step) error {
+	if step.Service == "" {
+		return errors.New("only a step with a service can iterate")
+	}
+	if step.Foreach.In == "" {
+		return errors.New("in must be an array expression")
+	}
+	if step.Foreach.Concurrency < 0 {
+		return errors.New("concurrency must not be negative")
+	}
+	if IsReserved(step.Foreach.As) {
+		return errors.New("as name " + step.Foreach.As + " is reserved")
+	}
+	return nil
+}
+
+// executeForeach invokes the service of a step once per element of the array
+// its foreach expression resolves to, running at most concurrency invocations
+// at a time. The service instances are collected in element order into an
+// array that is kept under the step name.
+func (e *execution) executeForeach(step types.Step) (results []result, err error) {
+	foreach := step.Foreach
+	values, err := e.translate(map[string]interface{}{"in": foreach.In})
+	if err != nil {
+		return nil, err
+	}
+	elements, err := toArray(values["in"])
+	if err != nil {
+		return nil, fmt.Errorf("foreach expression %s: %v", foreach.In, err)
+	}
+	as := foreach.As
+	if as == "" {
+		as = DefaultForeachAs
+	}
+	concurrency := foreach.Concurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+
+	instances := make([]interface{}, len(elements))
+	errs := make([]error, len(elements))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+iterate:
+	for i, element := range elements {
+		select {
+		case semaphore <- struct{}{}:
+		case <-e.ctx.Done():
+			errs[i] = e.ctx.Err()
+			break iterate
+		}
+		wg.Add(1)
+		go func(i int, element interface{}) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			elementResults, elementErr := e.invokeStep(step, result{name: as, value: element})
+			for _, r := range elementResults {
+				instances[i] = r.value
+			}
+			errs[i] = elementErr
+		}(i, element)
+	}
+	wg.Wait()
+
+	results = []result{{name: StepName(step), value: instances}}
+	for _, elementErr := range errs {
+		if elementErr != nil {
+			return results, elementErr
+		}
+	}
+	return results, nil
+}
+
+// toArray converts a resolved expression into its elements. A missing value
+// has no elements.
+func toArray(value interface{}) ([]interface{}, error) {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, errors.New("value is not an array")
+	}
+	elements := make([]interface{}, v.Len())
+	for i := range elements {
+		elements[i] = v.Index(i).Interface()
+	}
+	return elements, nil
+}
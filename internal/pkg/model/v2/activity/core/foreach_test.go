@@ -0,0 +1,96 @@
+package Core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mservice "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service"
+)
+
+func TestExecuteForeach(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	echo := map[string]interface{}{
+		"name":     "echo",
+		"type":     "js",
+		"settings": map[string]interface{}{"script": "result.value = parameters.id"},
+	}
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"name": "enrich", "service": "echo", "foreach": {"in": "${payload.items}", "as": "line", "concurrency": 2}, "input": {"parameters.id": "${line.id}"}},
+    {"if": "enrich.length == 3 && enrich[2].response.result.value == 'c'", "service": "users"}
+  ]
+}]`, map[string]string{"users": ""}, echo)
+	exec, err := newExecution(context.Background(), exec.dispatch, map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"id": "a"},
+			map[string]interface{}{"id": "b"},
+			map[string]interface{}{"id": "c"},
+		},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = exec.executeRoute(&exec.dispatch.Routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrich := (*exec.context["enrich"].(*interface{})).([]interface{})
+	for i, id := range []string{"a", "b", "c"} {
+		if value := enrich[i].(*mservice.JS).Response.Result["value"]; value != id {
+			t.Fatalf("element %d should be %s but is %v", i, id, value)
+		}
+	}
+	if name := responseName(t, exec, "users"); name != "users" {
+		t.Fatalf("collected results should be available to later steps but users response is %q", name)
+	}
+}
+
+func TestExecuteForeachConcurrency(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"service": "slow", "foreach": {"in": "${payload}", "concurrency": 2}}
+  ]
+}]`, map[string]string{"slow": "delay=100ms"})
+	exec, err := newExecution(context.Background(), exec.dispatch, []interface{}{1, 2, 3, 4}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = exec.executeRoute(&exec.dispatch.Routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed >= 400*time.Millisecond {
+		t.Fatalf("4 elements 2 at a time should take about 200ms but took %s", elapsed)
+	}
+	if slow := (*exec.context["slow"].(*interface{})).([]interface{}); len(slow) != 4 {
+		t.Fatalf("there should be 4 results but there are %d", len(slow))
+	}
+}
+
+func TestExecuteForeachInvalid(t *testing.T) {
+	defer Reset()
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"service": "users", "foreach": {"in": "${env}"}}
+  ]
+}]`, map[string]string{"users": ""})
+
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err == nil {
+		t.Fatal("a foreach over an object should fail")
+	}
+}
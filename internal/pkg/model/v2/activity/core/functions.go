@@ -0,0 +1,375 @@
+package Core
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// builtin is a function that can be called in a mapping expression.
+type builtin func(args []interface{}) (interface{}, error)
+
+// builtins are the functions available to mapping expressions by name.
+var builtins = map[string]builtin{
+	// Strings
+	"upper":      unary(func(s string) interface{} { return strings.ToUpper(s) }),
+	"lower":      unary(func(s string) interface{} { return strings.ToLower(s) }),
+	"trim":       unary(func(s string) interface{} { return strings.TrimSpace(s) }),
+	"concat":     concat,
+	"substring":  substring,
+	"replace":    replace,
+	"split":      split,
+	"join":       join,
+	"contains":   binary(func(s, sub string) interface{} { return strings.Contains(s, sub) }),
+	"startsWith": binary(func(s, prefix string) interface{} { return strings.HasPrefix(s, prefix) }),
+	"endsWith":   binary(func(s, suffix string) interface{} { return strings.HasSuffix(s, suffix) }),
+	"length":     length,
+	"string":     unary(func(s string) interface{} { return s }),
+	"default":    defaultValue,
+	// Encoding
+	"base64Encode": unary(func(s string) interface{} { return base64.StdEncoding.EncodeToString([]byte(s)) }),
+	"base64Decode": base64Decode,
+	"urlEncode":    unary(func(s string) interface{} { return url.QueryEscape(s) }),
+	"json":         toJSON,
+	// Hashing
+	"md5":        digest(md5.New),
+	"sha1":       digest(sha1.New),
+	"sha256":     digest(sha256.New),
+	"sha512":     digest(sha512.New),
+	"hmacSha256": hmacSha256,
+	"uuid":       uuid,
+	// Time
+	"now":        now,
+	"unixTime":   unixTime,
+	"formatTime": formatTime,
+	// Numbers
+	"number": number,
+	"int":    integer,
+	"round":  round,
+}
+
+func arity(args []interface{}, min, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		switch {
+		case min == max:
+			return fmt.Errorf("expects %d arguments but got %d", min, len(args))
+		case max < 0:
+			return fmt.Errorf("expects at least %d arguments but got %d", min, len(args))
+		}
+		return fmt.Errorf("expects %d to %d arguments but got %d", min, max, len(args))
+	}
+	return nil
+}
+
+// unary adapts a function of one string.
+func unary(f func(string) interface{}) builtin {
+	return func(args []interface{}) (interface{}, error) {
+		if err := arity(args, 1, 1); err != nil {
+			return nil, err
+		}
+		return f(stringify(args[0])), nil
+	}
+}
+
+// binary adapts a function of two strings.
+func binary(f func(string, string) interface{}) builtin {
+	return func(args []interface{}) (interface{}, error) {
+		if err := arity(args, 2, 2); err != nil {
+			return nil, err
+		}
+		return f(stringify(args[0]), stringify(args[1])), nil
+	}
+}
+
+func concat(args []interface{}) (interface{}, error) {
+	var b strings.Builder
+	for _, arg := range args {
+		b.WriteString(stringify(arg))
+	}
+	return b.String(), nil
+}
+
+// substring returns the characters of a string from start up to end, which
+// defaults to the end of the string. Negative positions count from the end.
+func substring(args []interface{}) (interface{}, error) {
+	if err := arity(args, 2, 3); err != nil {
+		return nil, err
+	}
+	runes := []rune(stringify(args[0]))
+	bound := func(arg interface{}) (int, error) {
+		position, err := toNumber(arg)
+		if err != nil {
+			return 0, err
+		}
+		i := int(position)
+		if i < 0 {
+			i += len(runes)
+		}
+		if i < 0 {
+			return 0, nil
+		}
+		if i > len(runes) {
+			return len(runes), nil
+		}
+		return i, nil
+	}
+	start, err := bound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	end := len(runes)
+	if len(args) == 3 {
+		if end, err = bound(args[2]); err != nil {
+			return nil, err
+		}
+	}
+	if start >= end {
+		return "", nil
+	}
+	return string(runes[start:end]), nil
+}
+
+func replace(args []interface{}) (interface{}, error) {
+	if err := arity(args, 3, 3); err != nil {
+		return nil, err
+	}
+	return strings.Replace(stringify(args[0]), stringify(args[1]), stringify(args[2]), -1), nil
+}
+
+func split(args []interface{}) (interface{}, error) {
+	if err := arity(args, 2, 2); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(stringify(args[0]), stringify(args[1]))
+	values := make([]interface{}, len(parts))
+	for i, part := range parts {
+		values[i] = part
+	}
+	return values, nil
+}
+
+func join(args []interface{}) (interface{}, error) {
+	if err := arity(args, 2, 2); err != nil {
+		return nil, err
+	}
+	elements, err := toArray(args[0])
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(elements))
+	for i, element := range elements {
+		parts[i] = stringify(element)
+	}
+	return strings.Join(parts, stringify(args[1])), nil
+}
+
+// length returns the number of characters of a string, elements of an array
+// or properties of an object.
+func length(args []interface{}) (interface{}, error) {
+	if err := arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	v := indirect(args[0])
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0, nil
+	case reflect.String:
+		return len([]rune(v.String())), nil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len(), nil
+	}
+	return nil, errors.New("value has no length")
+}
+
+// defaultValue returns the first argument that is not missing or empty.
+func defaultValue(args []interface{}) (interface{}, error) {
+	if err := arity(args, 2, -1); err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if arg != nil && arg != "" {
+			return arg, nil
+		}
+	}
+	return args[len(args)-1], nil
+}
+
+func base64Decode(args []interface{}) (interface{}, error) {
+	if err := arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	s := stringify(args[0])
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		// Fall back to the unpadded URL alphabet used by tokens.
+		if data, err = base64.RawURLEncoding.DecodeString(s); err != nil {
+			return nil, err
+		}
+	}
+	return string(data), nil
+}
+
+func toJSON(args []interface{}) (interface{}, error) {
+	if err := arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// digest returns a function that hashes a string into hex.
+func digest(h func() hash.Hash) builtin {
+	return unary(func(s string) interface{} {
+		sum := h()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	})
+}
+
+func hmacSha256(args []interface{}) (interface{}, error) {
+	if err := arity(args, 2, 2); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(stringify(args[0])))
+	mac.Write([]byte(stringify(args[1])))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// uuid returns a random version 4 UUID.
+func uuid(args []interface{}) (interface{}, error) {
+	if err := arity(args, 0, 0); err != nil {
+		return nil, err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// timeLayouts are the named layouts of formatTime.
+var timeLayouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC822":      time.RFC822,
+	"Kitchen":     time.Kitchen,
+}
+
+func now(args []interface{}) (interface{}, error) {
+	if err := arity(args, 0, 0); err != nil {
+		return nil, err
+	}
+	return time.Now().UTC().Format(time.RFC3339), nil
+}
+
+func unixTime(args []interface{}) (interface{}, error) {
+	if err := arity(args, 0, 0); err != nil {
+		return nil, err
+	}
+	return time.Now().Unix(), nil
+}
+
+// formatTime formats a time, given as an RFC 3339 string or as seconds since
+// the epoch, with a named or Go reference layout. The layout unix formats the
+// time as seconds since the epoch.
+func formatTime(args []interface{}) (interface{}, error) {
+	if err := arity(args, 2, 2); err != nil {
+		return nil, err
+	}
+	var t time.Time
+	switch value := normalize(args[0]).(type) {
+	case float64:
+		seconds, fraction := math.Modf(value)
+		t = time.Unix(int64(seconds), int64(fraction*1e9)).UTC()
+	case string:
+		var err error
+		if t, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("time must be an RFC 3339 string or a number of seconds")
+	}
+	layout := stringify(args[1])
+	if layout == "unix" {
+		return t.Unix(), nil
+	}
+	if named, ok := timeLayouts[layout]; ok {
+		layout = named
+	}
+	return t.Format(layout), nil
+}
+
+func number(args []interface{}) (interface{}, error) {
+	if err := arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	return toNumber(args[0])
+}
+
+func integer(args []interface{}) (interface{}, error) {
+	if err := arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	n, err := toNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return int(n), nil
+}
+
+// round rounds a number to a number of decimal places, which defaults to 0.
+func round(args []interface{}) (interface{}, error) {
+	if err := arity(args, 1, 2); err != nil {
+		return nil, err
+	}
+	n, err := toNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	places := 0.0
+	if len(args) == 2 {
+		if places, err = toNumber(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	scale := math.Pow(10, places)
+	return math.Round(n*scale) / scale, nil
+}
+
+// toNumber converts a number, a numeric string or a boolean to a float64.
+func toNumber(value interface{}) (float64, error) {
+	switch v := normalize(value).(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%v is not a number", value)
+}
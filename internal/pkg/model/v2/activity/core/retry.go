@@ -0,0 +1,153 @@
+package Core
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	mservice "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service"
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+)
+
+const (
+	// BackoffFixed waits the same delay before every retry.
+	BackoffFixed = "fixed"
+	// BackoffExponential doubles the delay after every retry.
+	BackoffExponential = "exponential"
+	// DefaultRetryAttempts is the number of attempts when none are configured.
+	DefaultRetryAttempts = 3
+	// DefaultRetryDelay is the delay before the first retry when none is configured.
+	DefaultRetryDelay = 100 * time.Millisecond
+	// DefaultRetryMaxDelay is the upper bound of a delay when none is configured.
+	DefaultRetryMaxDelay = 5 * time.Minute
+)
+
+// ValidateRetry checks the settings of a retry policy.
+func ValidateRetry(retry *types.Retry) error {
+	if retry.Attempts < 0 {
+		return errors.New("attempts must not be negative")
+	}
+	if retry.Backoff != "" && retry.Backoff != BackoffFixed && retry.Backoff != BackoffExponential {
+		return errors.New("backoff must be either fixed or exponential but is " + retry.Backoff)
+	}
+	if retry.Jitter < 0 || retry.Jitter > 1 {
+		return errors.New("jitter must be between 0 and 1")
+	}
+	for _, duration := range []string{retry.Delay, retry.MaxDelay} {
+		if duration == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(duration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// invokeStep invokes the service of a step and retries it according to the
+// retry policy of the step. Only the results of the last attempt are kept.
+func (e *execution) invokeStep(step types.Step, pending ...result) (results []result, err error) {
+	retry := step.Retry
+	if retry == nil {
+		return e.invokeService(step.Service, StepName(step), step.Input, pending...)
+	}
+	attempts := retry.Attempts
+	if attempts == 0 {
+		attempts = DefaultRetryAttempts
+	}
+	for attempt := 1; ; attempt++ {
+		results, err = e.invokeService(step.Service, StepName(step), step.Input, pending...)
+		if attempt >= attempts {
+			return results, err
+		}
+		retryable, rErr := e.shouldRetry(step, results, err, attempt)
+		if rErr != nil {
+			log.Errorf("retry condition of service %s causes error so is false: %v", step.Service, rErr)
+			return results, err
+		}
+		if !retryable {
+			return results, err
+		}
+		delay := backoff(retry, attempt)
+		log.Infof("attempt %d of %d of service %s failed, retrying in %s", attempt, attempts, step.Service, delay)
+		select {
+		case <-time.After(delay):
+		case <-e.ctx.Done():
+			return results, err
+		}
+	}
+}
+
+// shouldRetry evaluates the retry-on condition of a step against an attempt.
+// The service instance is available by step name and by type, along with
+// netError, error and attempt. Without a condition any error is retried.
+func (e *execution) shouldRetry(step types.Step, results []result, err error, attempt int) (bool, error) {
+	if step.Retry.On == "" {
+		return err != nil, nil
+	}
+	details := map[string]interface{}{}
+	if err != nil {
+		details = newStepError(StepName(step), step.Service, err).Details()
+	}
+	vm, vmErr := mservice.NewVM(map[string]interface{}{
+		"attempt":  attempt,
+		"netError": isNetError(results, err),
+		"error":    details,
+	})
+	if vmErr != nil {
+		return false, vmErr
+	}
+	for _, r := range results {
+		if serviceType := e.dispatch.Services[step.Service].Type; serviceType != "" {
+			if vmErr = vm.SetInVM(serviceType, r.value); vmErr != nil {
+				return false, vmErr
+			}
+		}
+		if vmErr = vm.SetInVM(r.name, r.value); vmErr != nil {
+			return false, vmErr
+		}
+	}
+	return e.dispatch.evaluateTruthiness(step.Retry.On, vm)
+}
+
+// isNetError reports whether an attempt failed with a network error, including
+// the network errors that an HTTP service records in its response.
+func isNetError(results []result, err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	for _, r := range results {
+		if h, ok := r.value.(*mservice.HTTP); ok && h.Response.NetError != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before the retry following an attempt.
+func backoff(retry *types.Retry, attempt int) time.Duration {
+	delay := DefaultRetryDelay
+	if retry.Delay != "" {
+		delay, _ = time.ParseDuration(retry.Delay)
+	}
+	maxDelay := DefaultRetryMaxDelay
+	if retry.MaxDelay != "" {
+		if d, err := time.ParseDuration(retry.MaxDelay); err == nil {
+			maxDelay = d
+		}
+	}
+	if retry.Backoff == BackoffExponential {
+		// Doubling stops at the upper bound so that the delay cannot overflow.
+		for i := 1; i < attempt && delay < maxDelay; i++ {
+			delay <<= 1
+		}
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if retry.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * retry.Jitter * float64(delay))
+	}
+	return delay
+}
@@ -0,0 +1,106 @@
+package Core
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mservice "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service"
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+)
+
+// newFlakyBackend fails the first failures requests with a 503.
+func newFlakyBackend(failures int32, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(requests, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, `{"name": "flaky"}`)
+	}))
+}
+
+func TestExecuteStepRetry(t *testing.T) {
+	defer Reset()
+	var requests int32
+	backend := newFlakyBackend(2, &requests)
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"service": "flaky", "retry": {"attempts": 3, "delay": "1ms", "on": "http.response.statusCode >= 500 || netError"}}
+  ]
+}]`, map[string]string{"flaky": ""})
+
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 {
+		t.Fatalf("service should be attempted 3 times but was attempted %d times", requests)
+	}
+	if name := responseName(t, exec, "flaky"); name != "flaky" {
+		t.Fatalf("response of the last attempt should be kept but is %q", name)
+	}
+}
+
+func TestExecuteStepRetryExhausted(t *testing.T) {
+	defer Reset()
+	var requests int32
+	backend := newFlakyBackend(5, &requests)
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "steps": [
+    {"service": "flaky", "retry": {"attempts": 2, "delay": "1ms", "on": "flaky.response.statusCode == 503"}}
+  ]
+}]`, map[string]string{"flaky": ""})
+
+	err := exec.executeRoute(&exec.dispatch.Routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Fatalf("service should be attempted 2 times but was attempted %d times", requests)
+	}
+	instance := exec.context["flaky"].(*interface{})
+	if code := (*instance).(*mservice.HTTP).Response.StatusCode; code != http.StatusServiceUnavailable {
+		t.Fatalf("response of the last attempt should be kept but has status %d", code)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	exponential := &types.Retry{Backoff: BackoffExponential, Delay: "10ms", MaxDelay: "50ms"}
+	for attempt, expected := range []time.Duration{10, 20, 40, 50, 50} {
+		if delay := backoff(exponential, attempt+1); delay != expected*time.Millisecond {
+			t.Fatalf("delay after attempt %d should be %dms but is %s", attempt+1, expected, delay)
+		}
+	}
+	for _, attempt := range []int{40, 64, 65, 1000} {
+		if delay := backoff(&types.Retry{Backoff: BackoffExponential}, attempt); delay != DefaultRetryMaxDelay {
+			t.Fatalf("delay after attempt %d should be capped at %s but is %s", attempt, DefaultRetryMaxDelay, delay)
+		}
+		if delay := backoff(exponential, attempt); delay != 50*time.Millisecond {
+			t.Fatalf("delay after attempt %d should be 50ms but is %s", attempt, delay)
+		}
+	}
+	if delay := backoff(&types.Retry{}, 3); delay != DefaultRetryDelay {
+		t.Fatalf("fixed delay should be %s but is %s", DefaultRetryDelay, delay)
+	}
+	jitter := &types.Retry{Delay: "100ms", Jitter: 0.5}
+	for i := 0; i < 10; i++ {
+		if delay := backoff(jitter, 1); delay < 50*time.Millisecond || delay > 100*time.Millisecond {
+			t.Fatalf("delay with jitter should be between 50ms and 100ms but is %s", delay)
+		}
+	}
+	if err := ValidateRetry(&types.Retry{Backoff: "linear"}); err == nil {
+		t.Fatal("an unknown backoff should be invalid")
+	}
+	if err := ValidateRetry(&types.Retry{Delay: "soon"}); err == nil {
+		t.Fatal("an invalid delay should be invalid")
+	}
+}
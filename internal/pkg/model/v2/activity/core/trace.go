@@ -0,0 +1,366 @@
+package Core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TIBCOSoftware/mashling/lib/util"
+)
+
+const (
+	// EnvTrace traces every request when set to true.
+	EnvTrace = "MASHLING_TRACE"
+	// EnvTraceSecret is the shared secret that a request presents in the
+	// TraceHeader to be traced.
+	EnvTraceSecret = "MASHLING_TRACE_SECRET"
+	// TraceHeader is the request header that asks for a trace.
+	TraceHeader = "X-Mashling-Trace"
+	// TraceIDHeader is the response header that identifies the trace of a request.
+	TraceIDHeader = "X-Mashling-Trace-Id"
+	// TraceCapacity is the number of recent traces that are kept.
+	TraceCapacity = 100
+	// Redacted replaces the values of secrets in traces.
+	Redacted = "[redacted]"
+)
+
+// redactedFields are the lower case names of the fields and headers whose
+// string values are secrets that are never kept in a trace.
+var redactedFields = map[string]bool{
+	"key":                 true,
+	"token":               true,
+	"accesstoken":         true,
+	"refreshtoken":        true,
+	"clientsecret":        true,
+	"secret":              true,
+	"password":            true,
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+	"x-mashling-trace":    true,
+}
+
+// Trace records how a dispatch handled one request: the route conditions,
+// the steps with their resolved inputs and service responses, and the
+// response that matched.
+type Trace struct {
+	ID       string           `json:"id"`
+	Start    time.Time        `json:"start"`
+	Duration string           `json:"duration,omitempty"`
+	Routes   []ConditionTrace `json:"routes"`
+	Steps    []StepTrace      `json:"steps"`
+	Response *ResponseTrace   `json:"response,omitempty"`
+	kept     bool
+	sync.Mutex
+}
+
+// ConditionTrace is the result of evaluating a condition.
+type ConditionTrace struct {
+	Condition string `json:"if"`
+	Result    bool   `json:"result"`
+	Error     string `json:"error,omitempty"`
+}
+
+// StepTrace is either the condition of a step or one invocation of its service.
+type StepTrace struct {
+	Name      string          `json:"name"`
+	Service   string          `json:"service"`
+	Condition *ConditionTrace `json:"if,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	Response  json.RawMessage `json:"response,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Start     time.Time       `json:"start"`
+	Duration  string          `json:"duration,omitempty"`
+}
+
+// ResponseTrace records the response conditions and the code of the response
+// that matched.
+type ResponseTrace struct {
+	Conditions []ConditionTrace `json:"conditions"`
+	Code       int              `json:"code,omitempty"`
+}
+
+// traceRequested reports whether a request is to be traced, either because
+// every request is or because it presents the trace secret.
+func traceRequested(payload interface{}) bool {
+	if strings.EqualFold(os.Getenv(EnvTrace), "true") {
+		return true
+	}
+	secret := os.Getenv(EnvTraceSecret)
+	if secret == "" {
+		return false
+	}
+	p, ok := payload.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	header, ok := p["header"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	presented, ok := header[TraceHeader].(string)
+	return ok && subtle.ConstantTimeCompare([]byte(presented), []byte(secret)) == 1
+}
+
+func newTrace() *Trace {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &Trace{ID: hex.EncodeToString(id), Start: time.Now()}
+}
+
+// route records the evaluation of a route condition. Like all methods of a
+// Trace it does nothing when the request is not traced.
+func (t *Trace) route(condition string, truthy bool, err error) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.Routes = append(t.Routes, newConditionTrace(condition, truthy, err))
+}
+
+// step records the evaluation of a step condition.
+func (t *Trace) step(name, service, condition string, truthy bool, err error) {
+	if t == nil || condition == "" {
+		return
+	}
+	c := newConditionTrace(condition, truthy, err)
+	t.Lock()
+	defer t.Unlock()
+	t.Steps = append(t.Steps, StepTrace{Name: name, Service: service, Condition: &c, Start: time.Now()})
+}
+
+// invocation records an invocation of a service that started at start.
+func (t *Trace) invocation(name, service string, start time.Time, input map[string]interface{}, instance interface{}, err error) {
+	if t == nil {
+		return
+	}
+	s := StepTrace{Name: name, Service: service, Start: start, Duration: time.Since(start).String()}
+	s.Input = redact(input)
+	if instance != nil {
+		s.Response = redact(instance)
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.Steps = append(t.Steps, s)
+}
+
+// response records the evaluation of a response condition.
+func (t *Trace) response(condition string, truthy bool, err error) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	if t.Response == nil {
+		t.Response = &ResponseTrace{}
+	}
+	t.Response.Conditions = append(t.Response.Conditions, newConditionTrace(condition, truthy, err))
+}
+
+// reply records the code of the response that matched.
+func (t *Trace) reply(code int) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	if t.Response == nil {
+		t.Response = &ResponseTrace{}
+	}
+	t.Response.Code = code
+}
+
+// attach attaches the trace ID header to an object reply without changing how
+// its body is encoded. Other replies have no meta keys and are left as they are.
+func (t *Trace) attach(data interface{}) interface{} {
+	object, ok := data.(map[string]interface{})
+	if t == nil || !ok {
+		return data
+	}
+	headers := make(map[string]interface{})
+	if replyHeaders, ok := object[util.MetaHeaders].(map[string]interface{}); ok {
+		for key, value := range replyHeaders {
+			headers[key] = value
+		}
+	}
+	headers[TraceIDHeader] = t.ID
+	reply := make(map[string]interface{}, len(object)+1)
+	for key, value := range object {
+		reply[key] = value
+	}
+	reply[util.MetaHeaders] = headers
+	return reply
+}
+
+// finish completes the trace and keeps it with the recent traces. The trace
+// of a request with an async route is finished again by the async execution.
+func (t *Trace) finish() {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	t.Duration = time.Since(t.Start).String()
+	kept := t.kept
+	t.kept = true
+	t.Unlock()
+	if !kept {
+		traces.add(t)
+	}
+}
+
+// MarshalJSON marshals the trace while it is locked, since the steps of an
+// async route may still be adding to it.
+func (t *Trace) MarshalJSON() ([]byte, error) {
+	t.Lock()
+	defer t.Unlock()
+	type trace Trace
+	return json.Marshal((*trace)(t))
+}
+
+// redact marshals a value with the values of its secret fields and headers
+// replaced.
+func redact(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err = decoder.Decode(&value); err != nil {
+		return nil
+	}
+	data, _ = json.Marshal(redactValue(value))
+	return data
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if _, ok := value.(string); ok && redactedFields[strings.ToLower(k)] {
+				v[k] = Redacted
+				continue
+			}
+			if values, ok := value.([]interface{}); ok && redactedFields[strings.ToLower(k)] {
+				// A multi-valued header.
+				for i := range values {
+					values[i] = Redacted
+				}
+				continue
+			}
+			v[k] = redactValue(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
+
+func newConditionTrace(condition string, truthy bool, err error) ConditionTrace {
+	c := ConditionTrace{Condition: condition, Result: truthy && err == nil}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	return c
+}
+
+// traceRing keeps the most recent traces.
+type traceRing struct {
+	traces []*Trace
+	next   int
+	sync.RWMutex
+}
+
+var traces = &traceRing{}
+
+func (r *traceRing) add(t *Trace) {
+	r.Lock()
+	defer r.Unlock()
+	if len(r.traces) < TraceCapacity {
+		r.traces = append(r.traces, t)
+		return
+	}
+	r.traces[r.next] = t
+	r.next = (r.next + 1) % TraceCapacity
+}
+
+// LookupTrace returns a recent trace by ID.
+func LookupTrace(id string) (*Trace, bool) {
+	traces.RLock()
+	defer traces.RUnlock()
+	for _, t := range traces.traces {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// RecentTraces returns the recent traces, oldest first.
+func RecentTraces() []*Trace {
+	traces.RLock()
+	defer traces.RUnlock()
+	recent := make([]*Trace, 0, len(traces.traces))
+	recent = append(recent, traces.traces[traces.next:]...)
+	return append(recent, traces.traces[:traces.next]...)
+}
+
+// RequireTraceSecret serves a handler only to the requests that present the
+// trace secret in the TraceHeader, or only to those of the given methods
+// when there are any. They are not served when no secret is configured.
+func RequireTraceSecret(h http.Handler, methods ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		required := len(methods) == 0
+		for _, method := range methods {
+			required = required || r.Method == method
+		}
+		if !required {
+			h.ServeHTTP(w, r)
+			return
+		}
+		secret := os.Getenv(EnvTraceSecret)
+		presented := r.Header.Get(TraceHeader)
+		if secret == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(secret)) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error":"the trace secret is required"}`, http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// TraceHandler serves the recent traces at its root and a single trace at
+// its root followed by the trace ID to the requests that present the trace
+// secret.
+func TraceHandler(root string) http.Handler {
+	return RequireTraceSecret(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, root), "/")
+		var body interface{} = RecentTraces()
+		if id != "" {
+			t, ok := LookupTrace(id)
+			if !ok {
+				http.Error(w, `{"error":"trace not found"}`, http.StatusNotFound)
+				return
+			}
+			body = t
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+}
@@ -0,0 +1,213 @@
+package Core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+	"github.com/TIBCOSoftware/mashling/lib/util"
+)
+
+func TestTraceRequested(t *testing.T) {
+	defer os.Unsetenv(EnvTraceSecret)
+	os.Setenv(EnvTraceSecret, "s3cret")
+	payload := func(secret string) interface{} {
+		return map[string]interface{}{"header": map[string]interface{}{TraceHeader: secret}}
+	}
+	if !traceRequested(payload("s3cret")) {
+		t.Fatal("a request with the secret should be traced")
+	}
+	if traceRequested(payload("wrong")) || traceRequested(nil) {
+		t.Fatal("a request without the secret should not be traced")
+	}
+	os.Unsetenv(EnvTraceSecret)
+	if traceRequested(payload("")) {
+		t.Fatal("a request should not be traced without a configured secret")
+	}
+}
+
+func TestExecuteTrace(t *testing.T) {
+	defer Reset()
+	defer os.Unsetenv(EnvTrace)
+	os.Setenv(EnvTrace, "true")
+	backend := newTestBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{
+  "if": "payload.id == 1",
+  "steps": [{"service": "skipped"}]
+}, {
+  "steps": [
+    {"if": "payload.id == 1", "service": "skipped"},
+    {"service": "users", "input": {"pathParams.id": "${payload.id}"}}
+  ]
+}]`, map[string]string{"users": "", "skipped": ""})
+	exec, err := newExecution(context.Background(), exec.dispatch, map[string]interface{}{"id": 2.0}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := exec.dispatch.selectRoute(exec.vm, exec.trace)
+	if err = exec.executeRoute(route); err != nil {
+		t.Fatal(err)
+	}
+	exec.trace.finish()
+
+	trace, ok := LookupTrace(exec.trace.ID)
+	if !ok {
+		t.Fatal("a finished trace should be kept")
+	}
+	if len(trace.Routes) != 2 || trace.Routes[0].Result || !trace.Routes[1].Result {
+		t.Fatalf("both route conditions should be traced but are %+v", trace.Routes)
+	}
+	if len(trace.Steps) != 2 {
+		t.Fatalf("the skipped condition and the users invocation should be traced but are %+v", trace.Steps)
+	}
+	if skipped := trace.Steps[0]; skipped.Condition == nil || skipped.Condition.Result || skipped.Response != nil {
+		t.Fatalf("skipped step should only have a false condition but is %+v", skipped)
+	}
+	users := trace.Steps[1]
+	var input, response map[string]interface{}
+	if err = json.Unmarshal(users.Input, &input); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(users.Response, &response); err != nil {
+		t.Fatal(err)
+	}
+	if input["pathParams"].(map[string]interface{})["id"] != 2.0 || users.Duration == "" {
+		t.Fatalf("users invocation should have its resolved input and timing but is %+v", users)
+	}
+	if body := response["response"].(map[string]interface{})["body"]; body.(map[string]interface{})["name"] != "users" {
+		t.Fatalf("users invocation should have its response but is %v", response)
+	}
+
+	get := func(path, secret string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		if secret != "" {
+			request.Header.Set(TraceHeader, secret)
+		}
+		TraceHandler("/traces").ServeHTTP(recorder, request)
+		return recorder
+	}
+	defer os.Unsetenv(EnvTraceSecret)
+	os.Setenv(EnvTraceSecret, "s3cret")
+	if recorder := get("/traces/"+trace.ID, ""); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("a trace should not be served without the secret but got %d", recorder.Code)
+	}
+	if recorder := get("/traces", "wrong"); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("traces should not be served with a wrong secret but got %d", recorder.Code)
+	}
+	recorder := get("/traces/"+trace.ID, "s3cret")
+	var served map[string]interface{}
+	if err = json.Unmarshal(recorder.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	if served["id"] != trace.ID {
+		t.Fatalf("trace %s should be served but got %v", trace.ID, served)
+	}
+	if recorder = get("/traces/unknown", "s3cret"); recorder.Code != http.StatusNotFound {
+		t.Fatalf("an unknown trace should not be found but got %d", recorder.Code)
+	}
+}
+
+func TestExecutionOutputTrace(t *testing.T) {
+	defer Reset()
+	backend := newContentBackend()
+	defer backend.Close()
+
+	exec := newTestExecution(t, backend.URL, `[{"steps": [{"service": "image"}, {"service": "feed"}, {"service": "users"}]}]`,
+		map[string]string{"image": "", "feed": "", "users": ""})
+	if err := exec.executeRoute(&exec.dispatch.Routes[0]); err != nil {
+		t.Fatal(err)
+	}
+	outputs := []types.Output{
+		{Data: "${image.response.body}"},
+		{Data: "${feed.response.body}"},
+		{Data: "${users.response.body}"},
+		{Data: map[string]interface{}{"name": "${users.response.body.name}"}},
+		{Data: "${feed.response.body}", Headers: map[string]interface{}{"X-Custom": "custom"}},
+		{Data: "${users.response.body.name}", ContentType: "text/plain"},
+	}
+	for _, output := range outputs {
+		exec.trace = nil
+		untraced, err := exec.output(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exec.trace = newTrace()
+		traced, err := exec.output(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		object := traced.(map[string]interface{})
+		if headers := util.ReplyHeaders(object); headers[TraceIDHeader][0] != exec.trace.ID {
+			t.Fatalf("reply of %v should carry the trace ID but has %v", output.Data, headers)
+		}
+		if mime := untraced.(map[string]interface{})[util.MetaMIME]; object[util.MetaMIME] != mime {
+			t.Fatalf("reply of %v should have the content type %v when traced but has %v", output.Data, mime, object[util.MetaMIME])
+		}
+		untracedData, err := util.Marshal(untraced)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracedData, err := util.Marshal(traced)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(tracedData, untracedData) {
+			t.Fatalf("reply of %v should be %q when traced but is %q", output.Data, untracedData, tracedData)
+		}
+	}
+}
+
+func TestTraceRedaction(t *testing.T) {
+	var redacted map[string]interface{}
+	err := json.Unmarshal(redact(map[string]interface{}{
+		"key":          "private",
+		"clientSecret": "secret",
+		"token":        map[string]interface{}{"claims": map[string]interface{}{"sub": "user"}},
+		"headers": map[string]interface{}{
+			"Authorization": "Bearer abc",
+			"X-Api-Key":     []interface{}{"abc"},
+			"Accept":        "application/json",
+		},
+	}), &redacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := redacted["headers"].(map[string]interface{})
+	if redacted["key"] != Redacted || redacted["clientSecret"] != Redacted ||
+		headers["Authorization"] != Redacted || headers["X-Api-Key"].([]interface{})[0] != Redacted {
+		t.Fatalf("secrets should be redacted but are %v", redacted)
+	}
+	if headers["Accept"] != "application/json" || redacted["token"].(map[string]interface{})["claims"] == nil {
+		t.Fatalf("other values should be kept but are %v", redacted)
+	}
+}
+
+func TestRequireTraceSecret(t *testing.T) {
+	defer os.Unsetenv(EnvTraceSecret)
+	os.Setenv(EnvTraceSecret, "s3cret")
+	handler := RequireTraceSecret(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), http.MethodPost)
+	serve := func(method, secret string) int {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, "/circuitBreakers/test/reset", nil)
+		request.Header.Set(TraceHeader, secret)
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	if code := serve(http.MethodGet, ""); code != http.StatusOK {
+		t.Fatalf("a method that does not require the secret should be served but got %d", code)
+	}
+	if code := serve(http.MethodPost, ""); code != http.StatusUnauthorized {
+		t.Fatalf("a method that requires the secret should not be served without it but got %d", code)
+	}
+	if code := serve(http.MethodPost, "s3cret"); code != http.StatusOK {
+		t.Fatalf("a method that requires the secret should be served with it but got %d", code)
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -258,7 +259,7 @@ func InitializeAnomaly(settings map[string]interface{}) (service *Anomaly, err e
 }
 
 // Execute executes the anomaly service
-func (a *Anomaly) Execute() (err error) {
+func (a *Anomaly) Execute(ctx context.Context) (err error) {
 	complexity := contexts.Lookup(a.context, a.depth)
 
 	data, err := json.Marshal(a.values)
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultAPIKeyHeader     = "X-Api-Key"
+	defaultAPIKeyQueryParam = "api_key"
+)
+
+// APIKeyFactory shares the keys and quota counters of an APIKey service
+// definition between its executions.
+type APIKeyFactory struct {
+	name     string
+	settings map[string]interface{}
+	keys     *apiKeyStore
+	plans    map[string]apiKeyPlan
+	quotas   *quotaStore
+}
+
+// NewAPIKeyFactory creates an APIKeyFactory with provided settings.
+func NewAPIKeyFactory(name string, settings map[string]interface{}) *APIKeyFactory {
+	return &APIKeyFactory{name: name, settings: settings}
+}
+
+// Start implements Factory.Start
+func (f *APIKeyFactory) Start() (err error) {
+	if f.keys, err = newAPIKeyStore(f.settings); err != nil {
+		return err
+	}
+	if f.plans, err = newAPIKeyPlans(f.settings); err != nil {
+		return err
+	}
+	if f.quotas, err = newQuotaStore(f.settings); err != nil {
+		return err
+	}
+	f.quotas.start()
+	return nil
+}
+
+// New implements Factory.New
+func (f *APIKeyFactory) New() (service Service, err error) {
+	apiKey := &APIKey{Name: f.name, keys: f.keys, plans: f.plans, quotas: f.quotas}
+	err = apiKey.setRequestValues(f.settings)
+	return apiKey, err
+}
+
+// Close implements Factory.Close
+func (f *APIKeyFactory) Close() (err error) {
+	if f.quotas == nil {
+		return nil
+	}
+	err = f.quotas.close()
+	f.quotas = nil
+	return err
+}
+
+// APIKey is a service that validates API keys against a key store and
+// enforces the daily and monthly quotas of their plans. The key is either
+// given as is, or taken from a header or a query parameter.
+type APIKey struct {
+	Name   string
+	keys   *apiKeyStore
+	plans  map[string]apiKeyPlan
+	quotas *quotaStore
+
+	// inputs
+	Key        string                 `json:"key"`
+	Headers    map[string]interface{} `json:"headers"`
+	Query      map[string]interface{} `json:"queryParams"`
+	Header     string                 `json:"header"`
+	QueryParam string                 `json:"queryParam"`
+
+	// outputs
+	Valid            bool                   `json:"valid"`
+	ConsumerID       string                 `json:"consumerId"`
+	Plan             string                 `json:"plan"`
+	Metadata         map[string]interface{} `json:"metadata"`
+	QuotaExceeded    bool                   `json:"quotaExceeded"`
+	DailyRemaining   int64                  `json:"dailyRemaining"`
+	MonthlyRemaining int64                  `json:"monthlyRemaining"`
+	Message          string                 `json:"message"`
+}
+
+// InitializeAPIKey initializes an APIKey service with provided settings. Its
+// quota counters are saved after every call.
+func InitializeAPIKey(name string, settings map[string]interface{}) (apiKey *APIKey, err error) {
+	apiKey = &APIKey{Name: name}
+	if apiKey.keys, err = newAPIKeyStore(settings); err != nil {
+		return nil, err
+	}
+	if apiKey.plans, err = newAPIKeyPlans(settings); err != nil {
+		return nil, err
+	}
+	if apiKey.quotas, err = newQuotaStore(settings); err != nil {
+		return nil, err
+	}
+	err = apiKey.setRequestValues(settings)
+	return apiKey, err
+}
+
+// Execute invokes this service
+func (a *APIKey) Execute(ctx context.Context) (err error) {
+	a.Valid, a.ConsumerID, a.Plan, a.Metadata = false, "", "", nil
+	a.QuotaExceeded, a.DailyRemaining, a.MonthlyRemaining, a.Message = false, 0, 0, ""
+
+	key := a.key()
+	if key == "" {
+		a.Message = "API key not found"
+		return nil
+	}
+	record := a.keys.lookup(key)
+	if record == nil {
+		a.Message = "unknown API key"
+		return nil
+	}
+	a.ConsumerID, a.Plan, a.Metadata = record.ConsumerID, record.Plan, record.Metadata
+	if record.Disabled {
+		a.Message = "API key is disabled"
+		return nil
+	}
+	a.DailyRemaining, a.MonthlyRemaining, a.QuotaExceeded = a.quotas.consume(key, a.plans[record.Plan], time.Now())
+	if a.QuotaExceeded {
+		a.Message = "quota exceeded"
+		return nil
+	}
+	a.Valid = true
+	return nil
+}
+
+// key returns the key input, or else the key from the header or the query
+// parameter.
+func (a *APIKey) key() string {
+	if a.Key != "" {
+		return a.Key
+	}
+	if name, ok := headerKey(a.Headers, a.Header); ok {
+		if v := values(a.Headers[name]); len(v) > 0 && v[0] != "" {
+			return v[0]
+		}
+	}
+	if v := values(a.Query[a.QueryParam]); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// UpdateRequest updates a request on an existing APIKey service instance with new values.
+func (a *APIKey) UpdateRequest(values map[string]interface{}) (err error) {
+	return a.setRequestValues(values)
+}
+
+func (a *APIKey) setRequestValues(settings map[string]interface{}) (err error) {
+	if a.Header == "" {
+		a.Header = defaultAPIKeyHeader
+	}
+	if a.QueryParam == "" {
+		a.QueryParam = defaultAPIKeyQueryParam
+	}
+	strs := map[string]*string{
+		"key":        &a.Key,
+		"header":     &a.Header,
+		"queryParam": &a.QueryParam,
+	}
+	for k, v := range settings {
+		if str, ok := strs[k]; ok {
+			if *str, ok = v.(string); !ok {
+				return fmt.Errorf("invalid type for %s", k)
+			}
+			continue
+		}
+		switch k {
+		case "headers":
+			headers, ok := v.(map[string]interface{})
+			if !ok {
+				return errors.New("invalid type for headers")
+			}
+			a.Headers = headers
+		case "queryParams":
+			query, ok := v.(map[string]interface{})
+			if !ok {
+				return errors.New("invalid type for queryParams")
+			}
+			a.Query = query
+		default:
+			// ignore and move on.
+		}
+	}
+	return nil
+}
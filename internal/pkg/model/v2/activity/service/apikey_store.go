@@ -0,0 +1,351 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyRecord is a key known to an apikey service.
+type APIKeyRecord struct {
+	Key        string                 `json:"key"`
+	ConsumerID string                 `json:"consumerId"`
+	Plan       string                 `json:"plan"`
+	Disabled   bool                   `json:"disabled"`
+	Metadata   map[string]interface{} `json:"metadata"`
+}
+
+// apiKeyStore holds the keys of an apikey service. Keys are either inline in
+// the settings or loaded from a JSON or CSV file, which is loaded again when
+// it changes.
+type apiKeyStore struct {
+	file           string
+	reloadInterval time.Duration
+	keys           map[string]*APIKeyRecord
+	checked        time.Time
+	modified       time.Time
+	size           int64
+	sync.Mutex
+}
+
+func newAPIKeyStore(settings map[string]interface{}) (store *apiKeyStore, err error) {
+	store = &apiKeyStore{reloadInterval: 5 * time.Second}
+	if v, ok := settings["reloadInterval"]; ok {
+		str, ok := v.(string)
+		if !ok {
+			return nil, errors.New("invalid type for reloadInterval")
+		}
+		if store.reloadInterval, err = time.ParseDuration(str); err != nil || store.reloadInterval < 0 {
+			return nil, fmt.Errorf("reloadInterval must be a duration but is %s", str)
+		}
+	}
+	if v, ok := settings["keys"]; ok {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if store.keys, err = parseAPIKeysJSON(data); err != nil {
+			return nil, fmt.Errorf("invalid keys: %v", err)
+		}
+		return store, nil
+	}
+	v, ok := settings["keyFile"]
+	if !ok {
+		return nil, errors.New("keys or keyFile is required")
+	}
+	if store.file, ok = v.(string); !ok {
+		return nil, errors.New("invalid type for keyFile")
+	}
+	if err = store.reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// lookup finds a key, loading the key file again if it changed.
+func (s *apiKeyStore) lookup(key string) *APIKeyRecord {
+	s.Lock()
+	defer s.Unlock()
+	if s.file != "" && time.Since(s.checked) >= s.reloadInterval {
+		if err := s.reload(); err != nil {
+			// The keys loaded before are kept until the file is valid again.
+			log.Errorf("unable to load API keys: %v", err)
+		}
+	}
+	return s.keys[key]
+}
+
+func (s *apiKeyStore) reload() error {
+	s.checked = time.Now()
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return err
+	}
+	if s.keys != nil && info.ModTime().Equal(s.modified) && info.Size() == s.size {
+		return nil
+	}
+	data, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+	var keys map[string]*APIKeyRecord
+	if strings.EqualFold(filepath.Ext(s.file), ".csv") {
+		keys, err = parseAPIKeysCSV(data)
+	} else {
+		keys, err = parseAPIKeysJSON(data)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid key file %s: %v", s.file, err)
+	}
+	s.keys, s.modified, s.size = keys, info.ModTime(), info.Size()
+	return nil
+}
+
+// parseAPIKeysJSON parses either an array of keys or an object of keys by
+// key.
+func parseAPIKeysJSON(data []byte) (map[string]*APIKeyRecord, error) {
+	var records []*APIKeyRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		var byKey map[string]*APIKeyRecord
+		if json.Unmarshal(data, &byKey) != nil {
+			return nil, err
+		}
+		for key, record := range byKey {
+			if record == nil {
+				record = &APIKeyRecord{}
+			}
+			record.Key = key
+			records = append(records, record)
+		}
+	}
+	keys := make(map[string]*APIKeyRecord, len(records))
+	for _, record := range records {
+		if record == nil || record.Key == "" {
+			return nil, errors.New("every key needs a key")
+		}
+		keys[record.Key] = record
+	}
+	return keys, nil
+}
+
+// parseAPIKeysCSV parses a CSV file with a header. The key, consumerId, plan
+// and disabled columns are the fields of a key, and the other columns are its
+// metadata.
+func parseAPIKeysCSV(data []byte) (map[string]*APIKeyRecord, error) {
+	reader := csv.NewReader(strings.NewReader(string(data)))
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("no header")
+	}
+	header := rows[0]
+	keys := make(map[string]*APIKeyRecord, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := &APIKeyRecord{Metadata: make(map[string]interface{})}
+		for i, column := range header {
+			switch value := row[i]; column {
+			case "key":
+				record.Key = value
+			case "consumerId":
+				record.ConsumerID = value
+			case "plan":
+				record.Plan = value
+			case "disabled":
+				record.Disabled = strings.EqualFold(value, "true")
+			default:
+				record.Metadata[column] = value
+			}
+		}
+		if record.Key == "" {
+			return nil, errors.New("every key needs a key")
+		}
+		keys[record.Key] = record
+	}
+	return keys, nil
+}
+
+// apiKeyPlan is the quota of the keys of a plan. A quota of 0 is unlimited.
+type apiKeyPlan struct {
+	Daily   int64 `json:"daily"`
+	Monthly int64 `json:"monthly"`
+}
+
+func newAPIKeyPlans(settings map[string]interface{}) (map[string]apiKeyPlan, error) {
+	plans := make(map[string]apiKeyPlan)
+	v, ok := settings["plans"]
+	if !ok {
+		return plans, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &plans); err != nil {
+		return nil, fmt.Errorf("invalid plans: %v", err)
+	}
+	for name, plan := range plans {
+		if plan.Daily < 0 || plan.Monthly < 0 {
+			return nil, fmt.Errorf("the quotas of plan %s must not be negative", name)
+		}
+	}
+	return plans, nil
+}
+
+// quotaCounter counts the calls of a key in the current day and month.
+type quotaCounter struct {
+	Day     string `json:"day"`
+	Daily   int64  `json:"daily"`
+	Month   string `json:"month"`
+	Monthly int64  `json:"monthly"`
+}
+
+// quotaStore counts the calls of keys. The counters are saved to a file so
+// that they survive restarts, either after every call or every flushInterval.
+type quotaStore struct {
+	file          string
+	flushInterval time.Duration
+	counters      map[string]*quotaCounter
+	dirty         bool
+	done          chan struct{}
+	sync.Mutex
+}
+
+func newQuotaStore(settings map[string]interface{}) (store *quotaStore, err error) {
+	store = &quotaStore{flushInterval: 10 * time.Second, counters: make(map[string]*quotaCounter)}
+	if v, ok := settings["quotaFlush"]; ok {
+		str, ok := v.(string)
+		if !ok {
+			return nil, errors.New("invalid type for quotaFlush")
+		}
+		if store.flushInterval, err = time.ParseDuration(str); err != nil || store.flushInterval < 0 {
+			return nil, fmt.Errorf("quotaFlush must be a duration but is %s", str)
+		}
+	}
+	v, ok := settings["quotaFile"]
+	if !ok {
+		return store, nil
+	}
+	if store.file, ok = v.(string); !ok {
+		return nil, errors.New("invalid type for quotaFile")
+	}
+	data, err := ioutil.ReadFile(store.file)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &store.counters); err != nil {
+		return nil, fmt.Errorf("invalid quota file %s: %v", store.file, err)
+	}
+	return store, nil
+}
+
+// start saves the counters every flushInterval until the store is closed.
+func (q *quotaStore) start() {
+	if q.file == "" || q.flushInterval == 0 {
+		return
+	}
+	done := make(chan struct{})
+	q.done = done
+	go func() {
+		ticker := time.NewTicker(q.flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := q.flush(); err != nil {
+					log.Errorf("unable to save quotas: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// consume counts a call of the key if it is within the quotas of its plan and
+// returns what remains of them, where -1 is unlimited.
+func (q *quotaStore) consume(key string, plan apiKeyPlan, now time.Time) (daily, monthly int64, exceeded bool) {
+	q.Lock()
+	now = now.UTC()
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	counter, ok := q.counters[key]
+	if !ok {
+		counter = &quotaCounter{}
+		q.counters[key] = counter
+	}
+	if counter.Day != day {
+		counter.Day, counter.Daily = day, 0
+	}
+	if counter.Month != month {
+		counter.Month, counter.Monthly = month, 0
+	}
+	exceeded = (plan.Daily > 0 && counter.Daily >= plan.Daily) || (plan.Monthly > 0 && counter.Monthly >= plan.Monthly)
+	if !exceeded {
+		counter.Daily++
+		counter.Monthly++
+		q.dirty = true
+	}
+	daily, monthly = remaining(plan.Daily, counter.Daily), remaining(plan.Monthly, counter.Monthly)
+	periodic := q.done != nil
+	q.Unlock()
+	if !exceeded && !periodic {
+		if err := q.flush(); err != nil {
+			log.Errorf("unable to save quotas: %v", err)
+		}
+	}
+	return daily, monthly, exceeded
+}
+
+func remaining(quota, count int64) int64 {
+	if quota == 0 {
+		return -1
+	}
+	if count > quota {
+		return 0
+	}
+	return quota - count
+}
+
+// flush saves the counters if they changed.
+func (q *quotaStore) flush() error {
+	q.Lock()
+	defer q.Unlock()
+	if q.file == "" || !q.dirty {
+		return nil
+	}
+	data, err := json.Marshal(q.counters)
+	if err != nil {
+		return err
+	}
+	tmp := q.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, q.file); err != nil {
+		return err
+	}
+	q.dirty = false
+	return nil
+}
+
+// close stops saving the counters periodically and saves them a last time.
+func (q *quotaStore) close() error {
+	q.Lock()
+	if q.done != nil {
+		close(q.done)
+		q.done = nil
+	}
+	q.Unlock()
+	return q.flush()
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+)
+
+func executeAPIKey(t *testing.T, factory Factory, values map[string]interface{}) *APIKey {
+	instance, err := factory.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.UpdateRequest(values); err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return instance.(*APIKey)
+}
+
+func TestAPIKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apikey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "keys.csv")
+	write := func(content string) {
+		if err := ioutil.WriteFile(keyFile, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("key,consumerId,plan,disabled,team\nk1,app1,gold,false,pets\nk2,app2,gold,true,stores\n")
+
+	factory := NewFactory(types.Service{Name: "keys", Type: "apikey", Settings: map[string]interface{}{
+		"keyFile":        keyFile,
+		"reloadInterval": "0s",
+	}})
+	if err = factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer factory.Close()
+
+	apiKey := executeAPIKey(t, factory, map[string]interface{}{"headers": map[string]interface{}{"x-api-key": "k1"}})
+	if !apiKey.Valid || apiKey.ConsumerID != "app1" || apiKey.Plan != "gold" || apiKey.Metadata["team"] != "pets" {
+		t.Fatalf("a key in a header should be valid but got %+v", apiKey)
+	}
+	if apiKey.DailyRemaining != -1 || apiKey.MonthlyRemaining != -1 {
+		t.Fatalf("a plan without quotas should be unlimited but got %+v", apiKey)
+	}
+	if apiKey = executeAPIKey(t, factory, map[string]interface{}{"queryParams": map[string]interface{}{"api_key": []interface{}{"k2"}}}); apiKey.Valid || apiKey.ConsumerID != "app2" {
+		t.Fatalf("a disabled key should be invalid but got %+v", apiKey)
+	}
+	for _, values := range []map[string]interface{}{
+		{"key": "k3"},
+		{"headers": map[string]interface{}{"Authorization": "k1"}},
+	} {
+		if executeAPIKey(t, factory, values).Valid {
+			t.Fatalf("%v should be invalid", values)
+		}
+	}
+
+	// The file is loaded again when it changes.
+	write("key,consumerId,plan\nk3,app3,silver\n")
+	os.Chtimes(keyFile, time.Now(), time.Now().Add(time.Second))
+	if apiKey = executeAPIKey(t, factory, map[string]interface{}{"key": "k3"}); !apiKey.Valid || apiKey.ConsumerID != "app3" {
+		t.Fatalf("a key added to the file should be valid but got %+v", apiKey)
+	}
+	write("not,a\nvalid,csv,file\n")
+	os.Chtimes(keyFile, time.Now(), time.Now().Add(2*time.Second))
+	if !executeAPIKey(t, factory, map[string]interface{}{"key": "k3"}).Valid {
+		t.Fatal("the keys should be kept when the file becomes invalid")
+	}
+}
+
+func TestAPIKeyQuotas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apikey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	settings := map[string]interface{}{
+		"keys": []interface{}{
+			map[string]interface{}{"key": "k1", "consumerId": "app1", "plan": "trial", "metadata": map[string]interface{}{"tier": 1.0}},
+		},
+		"plans":     map[string]interface{}{"trial": map[string]interface{}{"daily": 2.0, "monthly": 3.0}},
+		"quotaFile": filepath.Join(dir, "quotas.json"),
+	}
+	start := func() Factory {
+		factory := NewFactory(types.Service{Name: "quotas", Type: "apikey", Settings: settings})
+		if err := factory.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return factory
+	}
+
+	factory := start()
+	apiKey := executeAPIKey(t, factory, map[string]interface{}{"key": "k1"})
+	if !apiKey.Valid || apiKey.DailyRemaining != 1 || apiKey.MonthlyRemaining != 2 || apiKey.Metadata["tier"] != 1.0 {
+		t.Fatalf("the first call should be within the quotas but got %+v", apiKey)
+	}
+	factory.Close()
+
+	// The counters survive a restart.
+	factory = start()
+	defer factory.Close()
+	if apiKey = executeAPIKey(t, factory, map[string]interface{}{"key": "k1"}); !apiKey.Valid || apiKey.DailyRemaining != 0 {
+		t.Fatalf("the second call should be within the quotas but got %+v", apiKey)
+	}
+	if apiKey = executeAPIKey(t, factory, map[string]interface{}{"key": "k1"}); apiKey.Valid || !apiKey.QuotaExceeded {
+		t.Fatalf("the third call should exceed the daily quota but got %+v", apiKey)
+	}
+
+	// A new day resets the daily quota and a new month the monthly one.
+	quotas := &quotaStore{counters: make(map[string]*quotaCounter)}
+	plan := apiKeyPlan{Daily: 1, Monthly: 2}
+	for i, call := range []struct {
+		day      int
+		exceeded bool
+	}{{29, false}, {29, true}, {30, false}, {31, true}, {32, false}} {
+		if _, _, exceeded := quotas.consume("k1", plan, time.Date(2026, time.January, call.day, 12, 0, 0, 0, time.UTC)); exceeded != call.exceeded {
+			t.Fatalf("call %d on day %d should be exceeded %v", i, call.day, call.exceeded)
+		}
+	}
+
+	for _, invalid := range []map[string]interface{}{
+		{},
+		{"keys": []interface{}{map[string]interface{}{"plan": "gold"}}},
+		{"keys": []interface{}{}, "plans": map[string]interface{}{"gold": map[string]interface{}{"daily": -1.0}}},
+		{"keyFile": filepath.Join(dir, "missing.json")},
+	} {
+		if NewFactory(types.Service{Name: "invalid", Type: "apikey", Settings: invalid}).Start() == nil {
+			t.Fatalf("settings %v should be invalid", invalid)
+		}
+	}
+}
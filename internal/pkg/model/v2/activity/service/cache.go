@@ -0,0 +1,422 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cacheLookup     = "lookup"
+	cacheStore      = "store"
+	cacheInvalidate = "invalidate"
+
+	defaultCacheTTL        = 5 * time.Minute
+	defaultCacheMaxEntries = 1000
+)
+
+// CacheEntry is a response kept by a cache. An entry is fresh until it
+// expires, after which it can still be revalidated with its ETag.
+type CacheEntry struct {
+	Response map[string]interface{} `json:"response"`
+	ETag     string                 `json:"etag,omitempty"`
+	Expires  time.Time              `json:"expires"`
+}
+
+// CacheStore keeps the entries of a cache.
+type CacheStore interface {
+	// Get returns the entry with the key, or nil if there is none.
+	Get(ctx context.Context, key string) (entry *CacheEntry, err error)
+	// Set keeps an entry under the key.
+	Set(ctx context.Context, key string, entry *CacheEntry) (err error)
+	// Delete removes the entry with the key.
+	Delete(ctx context.Context, key string) (err error)
+	// Close releases the resources of the store.
+	Close() (err error)
+}
+
+// CacheStoreFactory creates a CacheStore from the settings of a cache service.
+type CacheStoreFactory func(settings map[string]interface{}) (store CacheStore, err error)
+
+var cacheStoreFactories = map[string]CacheStoreFactory{
+	"memory": NewMemoryCacheStore,
+}
+
+// RegisterCacheStore makes a CacheStore available to the store setting of
+// cache services.
+func RegisterCacheStore(name string, factory CacheStoreFactory) {
+	cacheStoreFactories[name] = factory
+}
+
+// MemoryCacheStore is a CacheStore that keeps at most maxEntries entries in
+// memory and evicts the least recently used ones.
+type MemoryCacheStore struct {
+	maxEntries int
+	entries    map[string]*list.Element
+	recent     *list.List
+	sync.Mutex
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewMemoryCacheStore creates a MemoryCacheStore bounded by the maxEntries
+// setting.
+func NewMemoryCacheStore(settings map[string]interface{}) (CacheStore, error) {
+	maxEntries := defaultCacheMaxEntries
+	if v, ok := settings["maxEntries"]; ok {
+		n, ok := v.(float64)
+		if !ok || n < 1 {
+			return nil, errors.New("maxEntries must be a positive number")
+		}
+		maxEntries = int(n)
+	}
+	return &MemoryCacheStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}, nil
+}
+
+// Get implements CacheStore.Get
+func (m *MemoryCacheStore) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	m.Lock()
+	defer m.Unlock()
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	m.recent.MoveToFront(element)
+	return element.Value.(*memoryCacheItem).entry, nil
+}
+
+// Set implements CacheStore.Set
+func (m *MemoryCacheStore) Set(ctx context.Context, key string, entry *CacheEntry) error {
+	m.Lock()
+	defer m.Unlock()
+	if element, ok := m.entries[key]; ok {
+		element.Value.(*memoryCacheItem).entry = entry
+		m.recent.MoveToFront(element)
+		return nil
+	}
+	m.entries[key] = m.recent.PushFront(&memoryCacheItem{key: key, entry: entry})
+	for m.recent.Len() > m.maxEntries {
+		oldest := m.recent.Back()
+		m.recent.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+	return nil
+}
+
+// Delete implements CacheStore.Delete
+func (m *MemoryCacheStore) Delete(ctx context.Context, key string) error {
+	m.Lock()
+	defer m.Unlock()
+	if element, ok := m.entries[key]; ok {
+		m.recent.Remove(element)
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+// Close implements CacheStore.Close
+func (m *MemoryCacheStore) Close() error {
+	return nil
+}
+
+// newCacheStore creates the store named by the store setting.
+func newCacheStore(settings map[string]interface{}) (CacheStore, error) {
+	name := "memory"
+	if v, ok := settings["store"]; ok {
+		if name, ok = v.(string); !ok {
+			return nil, errors.New("invalid type for store")
+		}
+	}
+	factory, ok := cacheStoreFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown cache store: %s", name)
+	}
+	return factory(settings)
+}
+
+// CacheFactory shares the store of a Cache service definition between its
+// executions.
+type CacheFactory struct {
+	name     string
+	settings map[string]interface{}
+	store    CacheStore
+}
+
+// NewCacheFactory creates a CacheFactory with provided settings.
+func NewCacheFactory(name string, settings map[string]interface{}) *CacheFactory {
+	return &CacheFactory{name: name, settings: settings}
+}
+
+// Start implements Factory.Start
+func (f *CacheFactory) Start() (err error) {
+	f.store, err = newCacheStore(f.settings)
+	return err
+}
+
+// New implements Factory.New
+func (f *CacheFactory) New() (service Service, err error) {
+	cache := &Cache{Name: f.name, store: f.store}
+	err = cache.setRequestValues(f.settings)
+	return cache, err
+}
+
+// Close implements Factory.Close
+func (f *CacheFactory) Close() (err error) {
+	if f.store == nil {
+		return nil
+	}
+	err = f.store.Close()
+	f.store = nil
+	return err
+}
+
+// Cache is a response cache service. A lookup finds the response kept under
+// a key, a store keeps a response of an http service under a key according
+// to its Cache-Control and ETag headers, and an invalidate removes it.
+type Cache struct {
+	Name  string
+	store CacheStore
+
+	// inputs
+	Operation    string      `json:"operation"`
+	Key          string      `json:"key"`
+	TTL          string      `json:"ttl"`
+	CacheControl string      `json:"cacheControl"`
+	Input        interface{} `json:"-"`
+
+	// outputs
+	Hit      bool                   `json:"hit"`
+	ETag     string                 `json:"etag"`
+	Stored   bool                   `json:"stored"`
+	Response map[string]interface{} `json:"response"`
+}
+
+// InitializeCache initializes a Cache service with provided settings and a
+// store of its own.
+func InitializeCache(name string, settings map[string]interface{}) (cache *Cache, err error) {
+	cache = &Cache{Name: name}
+	if cache.store, err = newCacheStore(settings); err != nil {
+		return nil, err
+	}
+	err = cache.setRequestValues(settings)
+	return cache, err
+}
+
+// UpdateRequest updates a request on an existing Cache service instance with new values.
+func (c *Cache) UpdateRequest(values map[string]interface{}) (err error) {
+	return c.setRequestValues(values)
+}
+
+func (c *Cache) setRequestValues(settings map[string]interface{}) (err error) {
+	for k, v := range settings {
+		switch k {
+		case "operation":
+			operation, ok := v.(string)
+			if !ok {
+				return errors.New("invalid type for operation")
+			}
+			switch operation {
+			case cacheLookup, cacheStore, cacheInvalidate:
+			default:
+				return fmt.Errorf("operation must be lookup, store or invalidate but is %s", operation)
+			}
+			c.Operation = operation
+		case "key":
+			key, ok := v.(string)
+			if !ok {
+				return errors.New("invalid type for key")
+			}
+			c.Key = key
+		case "ttl":
+			ttl, ok := v.(string)
+			if !ok {
+				return errors.New("invalid type for ttl")
+			}
+			if d, err := time.ParseDuration(ttl); err != nil || d < 0 {
+				return fmt.Errorf("ttl must be a duration but is %s", ttl)
+			}
+			c.TTL = ttl
+		case "cacheControl":
+			c.CacheControl = strings.Join(values(v), ",")
+		case "response":
+			c.Input = v
+		default:
+			// ignore and move on.
+		}
+	}
+	return nil
+}
+
+// Execute invokes this Cache service.
+func (c *Cache) Execute(ctx context.Context) (err error) {
+	c.Hit, c.ETag, c.Stored, c.Response = false, "", false, nil
+	if c.Key == "" {
+		return errors.New("a cache key is required")
+	}
+	switch c.Operation {
+	case cacheStore:
+		return c.storeResponse(ctx)
+	case cacheInvalidate:
+		return c.store.Delete(ctx, c.Key)
+	}
+	return c.lookup(ctx)
+}
+
+func (c *Cache) lookup(ctx context.Context) error {
+	requestControl := parseCacheControl(c.CacheControl)
+	if _, ok := requestControl["no-store"]; ok {
+		return nil
+	}
+	entry, err := c.store.Get(ctx, c.Key)
+	if err != nil || entry == nil {
+		return err
+	}
+	fresh := time.Now().Before(entry.Expires)
+	if _, ok := requestControl["no-cache"]; ok {
+		fresh = false
+	}
+	if maxAge, ok := requestControl["max-age"]; ok && maxAge == "0" {
+		fresh = false
+	}
+	if !fresh && entry.ETag == "" {
+		return c.store.Delete(ctx, c.Key)
+	}
+	c.Hit = fresh
+	c.ETag = entry.ETag
+	c.Response = entry.Response
+	return nil
+}
+
+func (c *Cache) storeResponse(ctx context.Context) error {
+	response, err := cacheResponse(c.Input)
+	if err != nil {
+		return err
+	}
+	c.Response = response
+	if _, ok := parseCacheControl(c.CacheControl)["no-store"]; ok {
+		return nil
+	}
+	headers, _ := response["headers"].(map[string]interface{})
+	status := statusCode(response["statusCode"])
+	if status == 304 {
+		// The backend revalidated the entry, so it is fresh again.
+		entry, err := c.store.Get(ctx, c.Key)
+		if err != nil || entry == nil {
+			return err
+		}
+		ttl, store := c.ttl(headers)
+		if !store {
+			return nil
+		}
+		refreshed := *entry
+		refreshed.Expires = time.Now().Add(ttl)
+		c.Response, c.ETag = refreshed.Response, refreshed.ETag
+		c.Stored = true
+		return c.store.Set(ctx, c.Key, &refreshed)
+	}
+	if !cacheableStatus(status) {
+		return nil
+	}
+	ttl, store := c.ttl(headers)
+	if !store {
+		return nil
+	}
+	c.ETag = header(headers, "ETag")
+	c.Stored = true
+	return c.store.Set(ctx, c.Key, &CacheEntry{Response: response, ETag: c.ETag, Expires: time.Now().Add(ttl)})
+}
+
+// ttl returns how long a response stays fresh according to its Cache-Control
+// header, and whether it may be stored at all.
+func (c *Cache) ttl(headers map[string]interface{}) (time.Duration, bool) {
+	ttl := defaultCacheTTL
+	if c.TTL != "" {
+		ttl, _ = time.ParseDuration(c.TTL)
+	}
+	control := parseCacheControl(header(headers, "Cache-Control"))
+	for _, directive := range []string{"no-store", "private"} {
+		if _, ok := control[directive]; ok {
+			return 0, false
+		}
+	}
+	if _, ok := control["no-cache"]; ok {
+		return 0, true
+	}
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if seconds, err := strconv.Atoi(control[directive]); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return ttl, true
+}
+
+// cacheResponse converts the response of an http service into an entry
+// response.
+func cacheResponse(v interface{}) (map[string]interface{}, error) {
+	switch r := v.(type) {
+	case HTTPResponse:
+		return map[string]interface{}{"statusCode": r.StatusCode, "headers": r.Headers, "body": r.Body}, nil
+	case *HTTPResponse:
+		return cacheResponse(*r)
+	case map[string]interface{}:
+		return r, nil
+	}
+	return nil, errors.New("invalid type for response")
+}
+
+func statusCode(v interface{}) int {
+	switch code := v.(type) {
+	case int:
+		return code
+	case float64:
+		return int(code)
+	}
+	return 0
+}
+
+// cacheableStatus reports whether a response with the status is cached.
+func cacheableStatus(status int) bool {
+	switch status {
+	case 200, 203, 204, 301, 404, 410:
+		return true
+	}
+	return false
+}
+
+// header finds the value of a header regardless of its case.
+func header(headers map[string]interface{}, name string) string {
+	key, ok := headerKey(headers, name)
+	if !ok {
+		return ""
+	}
+	return strings.Join(values(headers[key]), ",")
+}
+
+// parseCacheControl parses the directives of a Cache-Control header.
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" {
+			continue
+		}
+		name, arg := directive, ""
+		if i := strings.Index(directive, "="); i >= 0 {
+			name, arg = directive[:i], strings.Trim(directive[i+1:], `"`)
+		}
+		directives[strings.ToLower(name)] = arg
+	}
+	return directives
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+)
+
+func executeCache(t *testing.T, factory Factory, values map[string]interface{}) *Cache {
+	instance, err := factory.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.UpdateRequest(values); err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return instance.(*Cache)
+}
+
+func newCacheFactory(t *testing.T, name string, settings map[string]interface{}) Factory {
+	factory := NewFactory(types.Service{Name: name, Type: "cache", Settings: settings})
+	if err := factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return factory
+}
+
+func response(status int, headers map[string]interface{}, body string) HTTPResponse {
+	return HTTPResponse{StatusCode: status, Headers: headers, Body: map[string]interface{}{"name": body}}
+}
+
+func TestCacheLookupAndStore(t *testing.T) {
+	factory := newCacheFactory(t, "pets", map[string]interface{}{"ttl": "1m"})
+	defer factory.Close()
+
+	if cache := executeCache(t, factory, map[string]interface{}{"key": "pet:1"}); cache.Hit || cache.Response != nil {
+		t.Fatalf("an empty cache should miss but got %+v", cache)
+	}
+	store := func(key string, r HTTPResponse) *Cache {
+		return executeCache(t, factory, map[string]interface{}{"operation": "store", "key": key, "response": r})
+	}
+	if !store("pet:1", response(200, nil, "sally")).Stored {
+		t.Fatal("a 200 response should be stored")
+	}
+	cache := executeCache(t, factory, map[string]interface{}{"key": "pet:1"})
+	if !cache.Hit || cache.Response["body"].(map[string]interface{})["name"] != "sally" {
+		t.Fatalf("the stored response should be found but got %+v", cache)
+	}
+	if cache = executeCache(t, factory, map[string]interface{}{"key": "pet:1", "cacheControl": "no-cache"}); cache.Hit {
+		t.Fatal("a request with no-cache should not use the stored response")
+	}
+
+	for _, r := range []HTTPResponse{
+		response(500, nil, "error"),
+		response(200, map[string]interface{}{"Cache-Control": "no-store"}, "secret"),
+		response(200, map[string]interface{}{"cache-control": "private, max-age=60"}, "mine"),
+	} {
+		if store("pet:2", r).Stored {
+			t.Fatalf("response %+v should not be stored", r)
+		}
+	}
+	store("pet:2", response(200, map[string]interface{}{"Cache-Control": "max-age=0"}, "sally"))
+	if cache = executeCache(t, factory, map[string]interface{}{"key": "pet:2"}); cache.Hit || cache.Response != nil {
+		t.Fatalf("an expired response without an ETag should be dropped but got %+v", cache)
+	}
+
+	executeCache(t, factory, map[string]interface{}{"operation": "invalidate", "key": "pet:1"})
+	if executeCache(t, factory, map[string]interface{}{"key": "pet:1"}).Hit {
+		t.Fatal("an invalidated response should not be found")
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	factory := newCacheFactory(t, "revalidated", nil)
+	defer factory.Close()
+
+	executeCache(t, factory, map[string]interface{}{
+		"operation": "store",
+		"key":       "pet:1",
+		"response":  response(200, map[string]interface{}{"Etag": `"v1"`, "Cache-Control": "no-cache"}, "sally"),
+	})
+	cache := executeCache(t, factory, map[string]interface{}{"key": "pet:1"})
+	if cache.Hit || cache.ETag != `"v1"` {
+		t.Fatalf("a no-cache response should need revalidation with its ETag but got %+v", cache)
+	}
+	cache = executeCache(t, factory, map[string]interface{}{
+		"operation": "store",
+		"key":       "pet:1",
+		"ttl":       "1m",
+		"response":  map[string]interface{}{"statusCode": 304.0, "headers": map[string]interface{}{}},
+	})
+	if !cache.Stored || cache.Response["body"].(map[string]interface{})["name"] != "sally" {
+		t.Fatalf("a 304 should refresh the stored response and return it but got %+v", cache)
+	}
+	if !executeCache(t, factory, map[string]interface{}{"key": "pet:1"}).Hit {
+		t.Fatal("a revalidated response should be fresh")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	factory := newCacheFactory(t, "bounded", map[string]interface{}{"maxEntries": 2.0})
+	defer factory.Close()
+
+	for i := 1; i <= 2; i++ {
+		executeCache(t, factory, map[string]interface{}{"operation": "store", "key": fmt.Sprint(i), "response": response(200, nil, "")})
+	}
+	executeCache(t, factory, map[string]interface{}{"key": "1"})
+	executeCache(t, factory, map[string]interface{}{"operation": "store", "key": "3", "response": response(200, nil, "")})
+	for key, hit := range map[string]bool{"1": true, "2": false, "3": true} {
+		if executeCache(t, factory, map[string]interface{}{"key": key}).Hit != hit {
+			t.Fatalf("key %s should be hit %v after evicting the least recently used entry", key, hit)
+		}
+	}
+
+	for _, settings := range []map[string]interface{}{
+		{"store": "unknown"},
+		{"maxEntries": 0.0},
+	} {
+		if NewFactory(types.Service{Name: fmt.Sprint(settings), Type: "cache", Settings: settings}).Start() == nil {
+			t.Fatalf("settings %v should be invalid", settings)
+		}
+	}
+	instance, _ := factory.New()
+	if instance.UpdateRequest(map[string]interface{}{"operation": "fetch"}) == nil {
+		t.Fatal("an unknown operation should be invalid")
+	}
+}
+
+type closedCacheStore struct {
+	CacheStore
+	closed *bool
+}
+
+func (c closedCacheStore) Close() error {
+	*c.closed = true
+	return c.CacheStore.Close()
+}
+
+func TestCacheFactoryClose(t *testing.T) {
+	var closed bool
+	RegisterCacheStore("closed", func(settings map[string]interface{}) (CacheStore, error) {
+		store, err := NewMemoryCacheStore(settings)
+		return closedCacheStore{CacheStore: store, closed: &closed}, err
+	})
+	defer delete(cacheStoreFactories, "closed")
+
+	factory := newCacheFactory(t, "closed", map[string]interface{}{"store": "closed"})
+	executeCache(t, factory, map[string]interface{}{"operation": "store", "key": "1", "response": response(200, nil, "")})
+	if err := factory.Close(); err != nil || !closed {
+		t.Fatalf("closing the factory should close its store but got %v", err)
+	}
+	if err := factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer factory.Close()
+	if executeCache(t, factory, map[string]interface{}{"key": "1"}).Hit {
+		t.Fatal("a restarted factory should not keep the entries of its old store")
+	}
+}
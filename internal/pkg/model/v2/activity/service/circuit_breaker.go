@@ -1,10 +1,17 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -24,6 +31,12 @@ const (
 	CircuitBreakerUnknown = 0.0
 	// CircuitBreakerSuccess isa success
 	CircuitBreakerSuccess = 1.0
+	// CircuitBreakerClosed is the state of a circuit breaker that lets requests through
+	CircuitBreakerClosed = "closed"
+	// CircuitBreakerOpen is the state of a tripped circuit breaker
+	CircuitBreakerOpen = "open"
+	// CircuitBreakerHalfOpen is the state of a circuit breaker that lets probe requests through after its timeout
+	CircuitBreakerHalfOpen = "halfOpen"
 )
 
 // ErrorCircuitBreakerTripped happens when the circuit breaker has tripped
@@ -33,19 +46,31 @@ var now = time.Now
 
 // CircuitBreaker is a circuit breaker service
 type CircuitBreaker struct {
-	operation, context, mode string
-	threshold                int
-	period, timeout          time.Duration
-	Tripped                  bool `json:"tripped"`
+	breakerPolicy
+	operation, context string
+	stateFile          string
+	Tripped            bool   `json:"tripped"`
+	State              string `json:"state"`
+}
+
+// breakerPolicy is how a circuit breaker context trips and recovers.
+type breakerPolicy struct {
+	mode             string
+	threshold        int
+	halfOpenRequests int
+	period, timeout  time.Duration
 }
 
 // InitializeCircuitBreaker creates a circuit breaker service
 func InitializeCircuitBreaker(settings map[string]interface{}) (service *CircuitBreaker, err error) {
 	circuit := &CircuitBreaker{
-		mode:      CircuitBreakerModeA,
-		threshold: 5,
-		period:    60 * time.Second,
-		timeout:   60 * time.Second,
+		breakerPolicy: breakerPolicy{
+			mode:             CircuitBreakerModeA,
+			threshold:        5,
+			halfOpenRequests: 1,
+			period:           60 * time.Second,
+			timeout:          60 * time.Second,
+		},
 	}
 	circuit.UpdateRequest(settings)
 	return circuit, nil
@@ -59,20 +84,198 @@ type Record struct {
 
 // CircuitBreakerContext is a circuit breaker context
 type CircuitBreakerContext struct {
+	name      string
+	threshold int
+	mode      string
+	file      string
 	counter   int
 	processed uint64
 	timeout   time.Time
 	index     int
 	buffer    []Record
-	tripped   bool
+	state     string
+	changed   time.Time
+	probes    int
+	successes int
+	metrics   CircuitBreakerMetrics
 	sync.RWMutex
 }
 
+// CircuitBreakerMetrics count the state changes and rejected requests of a
+// circuit breaker context.
+type CircuitBreakerMetrics struct {
+	Opened     int64 `json:"opened"`
+	HalfOpened int64 `json:"halfOpened"`
+	Closed     int64 `json:"closed"`
+	Rejected   int64 `json:"rejected"`
+}
+
 // Trip trips the circuit breaker
 func (c *CircuitBreakerContext) Trip(now time.Time, timeout time.Duration) {
 	c.timeout = now.Add(timeout)
 	c.counter = 0
-	c.tripped = true
+	c.setState(CircuitBreakerOpen, now)
+}
+
+// advance moves a tripped circuit breaker whose timeout passed to the half
+// open state and returns the state.
+func (c *CircuitBreakerContext) advance(now time.Time) string {
+	if c.state == CircuitBreakerOpen && c.timeout.Sub(now) <= 0 {
+		c.probes, c.successes = 0, 0
+		c.setState(CircuitBreakerHalfOpen, now)
+	}
+	return c.state
+}
+
+// setState changes the state, logging and counting the change, and saves it
+// to the state file of the context.
+func (c *CircuitBreakerContext) setState(state string, now time.Time) {
+	if c.state == state {
+		return
+	}
+	log.Infof("circuit breaker %s changed from %s to %s", c.name, c.state, state)
+	switch state {
+	case CircuitBreakerOpen:
+		c.metrics.Opened++
+	case CircuitBreakerHalfOpen:
+		c.metrics.HalfOpened++
+	case CircuitBreakerClosed:
+		c.metrics.Closed++
+	}
+	c.state, c.changed = state, now
+	if c.file != "" {
+		if err := saveCircuitBreakerState(c.file, c.key(), circuitBreakerState{State: state, OpenUntil: c.timeout, Since: now}); err != nil {
+			log.Errorf("unable to save the state of circuit breaker %s: %v", c.name, err)
+		}
+	}
+}
+
+// allow reports whether a request passes a circuit breaker of mode a, b or c.
+// A half open circuit breaker lets its probes pass.
+func (c *CircuitBreakerContext) allow(now time.Time, p breakerPolicy) bool {
+	c.Lock()
+	defer c.Unlock()
+	state := c.advance(now)
+	if state == CircuitBreakerHalfOpen && c.probes >= p.halfOpenRequests && now.Sub(c.changed) >= p.timeout {
+		// The probes did not report back in time, so there is another round.
+		c.probes, c.successes, c.changed = 0, 0, now
+	}
+	if state == CircuitBreakerOpen || (state == CircuitBreakerHalfOpen && c.probes >= p.halfOpenRequests) {
+		c.metrics.Rejected++
+		return false
+	}
+	if state == CircuitBreakerHalfOpen {
+		c.probes++
+	}
+	return true
+}
+
+// failure processes an error, which trips the circuit breaker according to
+// its mode.
+func (c *CircuitBreakerContext) failure(now time.Time, p breakerPolicy) {
+	c.Lock()
+	defer c.Unlock()
+	state := c.advance(now)
+	if state == CircuitBreakerOpen {
+		return
+	}
+	c.counter++
+	c.AddRecord(CircuitBreakerFailure, now)
+	if state == CircuitBreakerHalfOpen {
+		// A failed probe trips the circuit breaker again.
+		c.Trip(now, p.timeout)
+		return
+	}
+	switch p.mode {
+	case CircuitBreakerModeA:
+		if c.counter >= p.threshold {
+			c.Trip(now, p.timeout)
+		}
+	case CircuitBreakerModeB:
+		if c.processed < uint64(p.threshold) {
+			break
+		}
+		if now.Sub(c.buffer[c.index].Stamp) < p.period {
+			c.Trip(now, p.timeout)
+		}
+	case CircuitBreakerModeC:
+		if c.processed < uint64(p.threshold) {
+			break
+		}
+		if c.counter >= p.threshold &&
+			now.Sub(c.buffer[c.index].Stamp) < p.period {
+			c.Trip(now, p.timeout)
+		}
+	}
+}
+
+// success processes a non-error, which closes a half open circuit breaker
+// once all of its probes succeeded.
+func (c *CircuitBreakerContext) success(now time.Time, p breakerPolicy) {
+	c.Lock()
+	defer c.Unlock()
+	if p.mode == CircuitBreakerModeD {
+		c.AddRecord(CircuitBreakerSuccess, now)
+		return
+	}
+	switch c.advance(now) {
+	case CircuitBreakerClosed:
+		c.counter = 0
+	case CircuitBreakerHalfOpen:
+		c.successes++
+		if c.successes >= p.halfOpenRequests {
+			c.counter = 0
+			c.setState(CircuitBreakerClosed, now)
+		}
+	}
+}
+
+// Reset closes the circuit breaker and forgets its errors
+func (c *CircuitBreakerContext) Reset(now time.Time) {
+	c.counter, c.processed, c.index = 0, 0, 0
+	c.timeout = time.Time{}
+	for i := range c.buffer {
+		c.buffer[i] = Record{Weight: CircuitBreakerSuccess}
+	}
+	c.setState(CircuitBreakerClosed, now)
+}
+
+func (c *CircuitBreakerContext) key() string {
+	return fmt.Sprintf("%s-%d", c.name, c.threshold)
+}
+
+// CircuitBreakerStatus is the state of a circuit breaker context.
+type CircuitBreakerStatus struct {
+	Context   string     `json:"context"`
+	Threshold int        `json:"threshold"`
+	Mode      string     `json:"mode"`
+	State     string     `json:"state"`
+	Since     time.Time  `json:"since"`
+	OpenUntil *time.Time `json:"openUntil,omitempty"`
+	Errors    int        `json:"errors"`
+	Probes    int        `json:"probes"`
+	CircuitBreakerMetrics
+}
+
+// Status returns the state of the circuit breaker
+func (c *CircuitBreakerContext) Status(now time.Time) CircuitBreakerStatus {
+	c.Lock()
+	defer c.Unlock()
+	status := CircuitBreakerStatus{
+		Context:               c.name,
+		Threshold:             c.threshold,
+		Mode:                  c.mode,
+		State:                 c.advance(now),
+		Since:                 c.changed,
+		Errors:                c.counter,
+		Probes:                c.probes,
+		CircuitBreakerMetrics: c.metrics,
+	}
+	if status.State == CircuitBreakerOpen {
+		openUntil := c.timeout
+		status.OpenUntil = &openUntil
+	}
+	return status
 }
 
 func (c *CircuitBreakerContext) AddRecord(weight float64, now time.Time) {
@@ -107,7 +310,13 @@ var circuitBreakerContexts = CircuitBreakerContexts{
 
 // GetContext gets a circuit breaker context
 func (c *CircuitBreakerContexts) GetContext(context string, threshold int) *CircuitBreakerContext {
-	context = fmt.Sprintf("%s-%d", context, threshold)
+	return c.lookup(context, threshold, CircuitBreakerModeA, "", time.Now())
+}
+
+// lookup gets a circuit breaker context, restoring a new one from the state
+// file.
+func (c *CircuitBreakerContexts) lookup(name string, threshold int, mode, file string, now time.Time) *CircuitBreakerContext {
+	context := fmt.Sprintf("%s-%d", name, threshold)
 	c.RLock()
 	cbContext := c.contexts[context]
 	c.RUnlock()
@@ -116,86 +325,192 @@ func (c *CircuitBreakerContexts) GetContext(context string, threshold int) *Circ
 		return cbContext
 	}
 
+	c.Lock()
+	defer c.Unlock()
+	if cbContext = c.contexts[context]; cbContext != nil {
+		return cbContext
+	}
 	buffer := make([]Record, threshold)
 	cbContext = &CircuitBreakerContext{
-		buffer: buffer,
+		name:      name,
+		threshold: threshold,
+		mode:      mode,
+		file:      file,
+		buffer:    buffer,
+		state:     CircuitBreakerClosed,
+		changed:   now,
 	}
 	for i := range buffer {
 		buffer[i].Weight = CircuitBreakerSuccess
 	}
-
-	c.Lock()
+	if file != "" {
+		state, ok, err := loadCircuitBreakerState(file, context)
+		if err != nil {
+			log.Errorf("unable to restore the state of circuit breaker %s: %v", name, err)
+		} else if ok && state.State != CircuitBreakerClosed {
+			// A half open circuit breaker starts probing again.
+			cbContext.state, cbContext.timeout, cbContext.changed = CircuitBreakerOpen, state.OpenUntil, state.Since
+		}
+	}
 	c.contexts[context] = cbContext
-	c.Unlock()
 
 	return cbContext
 }
 
+// Statuses returns the state of the circuit breaker contexts with a name, or
+// of all of them if the name is empty.
+func (c *CircuitBreakerContexts) Statuses(name string) []CircuitBreakerStatus {
+	c.RLock()
+	var contexts []*CircuitBreakerContext
+	for _, context := range c.contexts {
+		if name == "" || context.name == name {
+			contexts = append(contexts, context)
+		}
+	}
+	c.RUnlock()
+
+	now := now()
+	statuses := make([]CircuitBreakerStatus, 0, len(contexts))
+	for _, context := range contexts {
+		statuses = append(statuses, context.Status(now))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Context != statuses[j].Context {
+			return statuses[i].Context < statuses[j].Context
+		}
+		return statuses[i].Threshold < statuses[j].Threshold
+	})
+	return statuses
+}
+
+// Reset closes the circuit breaker contexts with a name and reports whether
+// there were any.
+func (c *CircuitBreakerContexts) Reset(name string) bool {
+	c.RLock()
+	defer c.RUnlock()
+	found, now := false, now()
+	for _, context := range c.contexts {
+		if context.name == name {
+			context.Lock()
+			context.Reset(now)
+			context.Unlock()
+			found = true
+		}
+	}
+	return found
+}
+
+// CircuitBreakerHandler serves the state of the circuit breaker contexts. A
+// GET of the root lists them, a GET of root/<context> reads the contexts of a
+// name, and a POST to root/<context>/reset closes them.
+func CircuitBreakerHandler(root string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, root), "/")
+		if r.Method == http.MethodPost {
+			name := strings.TrimSuffix(path, "/reset")
+			if name == path || name == "" {
+				http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+				return
+			}
+			if !circuitBreakerContexts.Reset(name) {
+				http.Error(w, `{"error":"circuit breaker not found"}`, http.StatusNotFound)
+				return
+			}
+			path = name
+		}
+		statuses := circuitBreakerContexts.Statuses(path)
+		if path != "" && len(statuses) == 0 {
+			http.Error(w, `{"error":"circuit breaker not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(statuses)
+	})
+}
+
+// circuitBreakerState is the state of a circuit breaker context saved in a
+// state file.
+type circuitBreakerState struct {
+	State     string    `json:"state"`
+	OpenUntil time.Time `json:"openUntil"`
+	Since     time.Time `json:"since"`
+}
+
+// circuitBreakerFiles guards the state files of the circuit breakers.
+var circuitBreakerFiles sync.Mutex
+
+func readCircuitBreakerStates(file string) (map[string]circuitBreakerState, error) {
+	states := make(map[string]circuitBreakerState)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return states, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", file, err)
+	}
+	return states, nil
+}
+
+func loadCircuitBreakerState(file, context string) (state circuitBreakerState, ok bool, err error) {
+	circuitBreakerFiles.Lock()
+	defer circuitBreakerFiles.Unlock()
+	states, err := readCircuitBreakerStates(file)
+	if err != nil {
+		return state, false, err
+	}
+	state, ok = states[context]
+	return state, ok, nil
+}
+
+func saveCircuitBreakerState(file, context string, state circuitBreakerState) error {
+	circuitBreakerFiles.Lock()
+	defer circuitBreakerFiles.Unlock()
+	states, err := readCircuitBreakerStates(file)
+	if err != nil {
+		return err
+	}
+	states[context] = state
+	data, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
 // Execute executes the circuit breaker service
-func (c *CircuitBreaker) Execute() (err error) {
+func (c *CircuitBreaker) Execute(ctx context.Context) (err error) {
 	if c.context == "" {
 		return errors.New("invalid context")
 	}
 	if c.threshold <= 0 {
 		return errors.New("invalid threshold")
 	}
+	if c.halfOpenRequests <= 0 {
+		return errors.New("invalid halfOpenRequests")
+	}
 
-	context, now := circuitBreakerContexts.GetContext(c.context, c.threshold), now()
+	now := now()
+	context := circuitBreakerContexts.lookup(c.context, c.threshold, c.mode, c.stateFile, now)
+	defer func() {
+		context.RLock()
+		c.State = context.state
+		context.RUnlock()
+	}()
 	switch c.operation {
 	case "counter":
-		context.Lock()
-		if context.timeout.Sub(now) > 0 {
-			context.Unlock()
-			break
-		}
-		context.counter++
-		context.AddRecord(CircuitBreakerFailure, now)
-		if context.tripped {
-			context.Trip(now, c.timeout)
-			context.Unlock()
-			break
-		}
-		switch c.mode {
-		case CircuitBreakerModeA:
-			if context.counter >= c.threshold {
-				context.Trip(now, c.timeout)
-			}
-		case CircuitBreakerModeB:
-			if context.processed < uint64(c.threshold) {
-				break
-			}
-			if now.Sub(context.buffer[context.index].Stamp) < c.period {
-				context.Trip(now, c.timeout)
-			}
-		case CircuitBreakerModeC:
-			if context.processed < uint64(c.threshold) {
-				break
-			}
-			if context.counter >= c.threshold &&
-				now.Sub(context.buffer[context.index].Stamp) < c.period {
-				context.Trip(now, c.timeout)
-			}
-		}
-		context.Unlock()
+		context.failure(now, c.breakerPolicy)
 	case "reset":
-		context.Lock()
-		switch c.mode {
-		case CircuitBreakerModeA, CircuitBreakerModeB, CircuitBreakerModeC:
-			if context.timeout.Sub(now) <= 0 {
-				context.counter = 0
-				context.tripped = false
-			}
-		case CircuitBreakerModeD:
-			context.AddRecord(CircuitBreakerSuccess, now)
-		}
-		context.Unlock()
+		context.success(now, c.breakerPolicy)
 	default:
 		switch c.mode {
 		case CircuitBreakerModeA, CircuitBreakerModeB, CircuitBreakerModeC:
-			context.RLock()
-			timeout := context.timeout
-			context.RUnlock()
-			if timeout.Sub(now) > 0 {
+			if !context.allow(now, c.breakerPolicy) {
 				c.Tripped = true
 				return ErrorCircuitBreakerTripped
 			}
@@ -206,6 +521,7 @@ func (c *CircuitBreaker) Execute() (err error) {
 			if rand.Float64()*1000 < math.Floor(p*1000) {
 				context.Lock()
 				context.AddRecord(CircuitBreakerUnknown, now)
+				context.metrics.Rejected++
 				context.Unlock()
 				c.Tripped = true
 				return ErrorCircuitBreakerTripped
@@ -251,6 +567,18 @@ func (c *CircuitBreaker) UpdateRequest(values map[string]interface{}) (err error
 				return errors.New("threshold is not a number")
 			}
 			c.threshold = int(threshold)
+		case "halfOpenRequests":
+			halfOpenRequests, ok := v.(float64)
+			if !ok {
+				return errors.New("halfOpenRequests is not a number")
+			}
+			c.halfOpenRequests = int(halfOpenRequests)
+		case "stateFile":
+			stateFile, ok := v.(string)
+			if !ok {
+				return errors.New("stateFile is not a string")
+			}
+			c.stateFile = stateFile
 		case "timeout":
 			timeout, ok := v.(float64)
 			if !ok {
@@ -1,15 +1,31 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
 	"math"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
 )
 
+// resetCircuitBreakerContexts forgets the circuit breaker contexts of earlier
+// tests, like a restart of the gateway.
+func resetCircuitBreakerContexts() {
+	circuitBreakerContexts.Lock()
+	circuitBreakerContexts.contexts = make(map[string]*CircuitBreakerContext)
+	circuitBreakerContexts.Unlock()
+}
+
 func TestCircuitBreakerModeA(t *testing.T) {
+	resetCircuitBreakerContexts()
 	rand.Seed(1)
 	clock := time.Unix(1533930608, 0)
 	now = func() time.Time {
@@ -36,7 +52,7 @@ func TestCircuitBreakerModeA(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		err = breaker.Execute()
+		err = breaker.Execute(context.Background())
 		if err != should {
 			t.Fatalf("error should be %v but is %v", should, err)
 		}
@@ -70,6 +86,7 @@ func TestCircuitBreakerModeA(t *testing.T) {
 }
 
 func TestCircuitBreakerModeB(t *testing.T) {
+	resetCircuitBreakerContexts()
 	rand.Seed(1)
 	clock := time.Unix(1533930608, 0)
 	now = func() time.Time {
@@ -97,7 +114,7 @@ func TestCircuitBreakerModeB(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		err = breaker.Execute()
+		err = breaker.Execute(context.Background())
 		if err != should {
 			t.Fatalf("error should be %v but is %v", should, err)
 		}
@@ -130,6 +147,7 @@ func TestCircuitBreakerModeB(t *testing.T) {
 }
 
 func TestCircuitBreakerModeC(t *testing.T) {
+	resetCircuitBreakerContexts()
 	rand.Seed(1)
 	clock := time.Unix(1533930608, 0)
 	now = func() time.Time {
@@ -157,7 +175,7 @@ func TestCircuitBreakerModeC(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		err = breaker.Execute()
+		err = breaker.Execute(context.Background())
 		if err != should {
 			t.Fatalf("error should be %v but is %v", should, err)
 		}
@@ -198,6 +216,7 @@ func TestCircuitBreakerModeC(t *testing.T) {
 }
 
 func TestCircuitBreakerModeD(t *testing.T) {
+	resetCircuitBreakerContexts()
 	rand.Seed(1)
 	clock := time.Unix(1533930608, 0)
 	now = func() time.Time {
@@ -225,7 +244,7 @@ func TestCircuitBreakerModeD(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		err = breaker.Execute()
+		err = breaker.Execute(context.Background())
 		if err != should {
 			t.Fatalf("error should be %v but is %v", should, err)
 		}
@@ -281,3 +300,166 @@ func TestCircuitBreakerModeD(t *testing.T) {
 		t.Fatalf("probability should be zero but is %v", math.Floor(p*100))
 	}
 }
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	resetCircuitBreakerContexts()
+	clock := time.Unix(1533930608, 0)
+	now = func() time.Time {
+		return clock
+	}
+	defer func() {
+		now = time.Now
+	}()
+
+	service := types.Service{
+		Type: "circuitBreaker",
+		Settings: map[string]interface{}{
+			"context":          "testHalfOpen",
+			"threshold":        2.0,
+			"halfOpenRequests": 2.0,
+		},
+	}
+	execute := func(operation string, should error) *CircuitBreaker {
+		breaker, err := Initialize(service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if operation != "" {
+			if err = breaker.UpdateRequest(map[string]interface{}{"operation": operation}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = breaker.Execute(context.Background()); err != should {
+			t.Fatalf("error should be %v but is %v", should, err)
+		}
+		return breaker.(*CircuitBreaker)
+	}
+
+	execute("counter", nil)
+	if state := execute("counter", nil).State; state != CircuitBreakerOpen {
+		t.Fatalf("the circuit breaker should be open but is %s", state)
+	}
+	execute("", ErrorCircuitBreakerTripped)
+
+	// Two probes are let through after the timeout, and a failed one trips
+	// the circuit breaker again.
+	clock = clock.Add(60 * time.Second)
+	if state := execute("", nil).State; state != CircuitBreakerHalfOpen {
+		t.Fatalf("the circuit breaker should be half open but is %s", state)
+	}
+	execute("", nil)
+	execute("", ErrorCircuitBreakerTripped)
+	execute("reset", nil)
+	if state := execute("counter", nil).State; state != CircuitBreakerOpen {
+		t.Fatalf("a failed probe should open the circuit breaker but it is %s", state)
+	}
+
+	// Probes that do not report back are followed by another round.
+	clock = clock.Add(60 * time.Second)
+	execute("", nil)
+	execute("", nil)
+	execute("", ErrorCircuitBreakerTripped)
+	clock = clock.Add(60 * time.Second)
+	execute("", nil)
+	execute("", nil)
+	if state := execute("reset", nil).State; state != CircuitBreakerHalfOpen {
+		t.Fatalf("the circuit breaker should wait for every probe but is %s", state)
+	}
+	if state := execute("reset", nil).State; state != CircuitBreakerClosed {
+		t.Fatalf("the circuit breaker should close after its probes succeeded but is %s", state)
+	}
+	execute("", nil)
+
+	statuses := circuitBreakerContexts.Statuses("testHalfOpen")
+	if len(statuses) != 1 {
+		t.Fatalf("there should be a circuit breaker but there are %v", statuses)
+	}
+	metrics := CircuitBreakerMetrics{Opened: 2, HalfOpened: 2, Closed: 1, Rejected: 3}
+	if status := statuses[0]; status.State != CircuitBreakerClosed || status.CircuitBreakerMetrics != metrics {
+		t.Fatalf("the status should count the state changes but is %+v", status)
+	}
+}
+
+func TestCircuitBreakerHandler(t *testing.T) {
+	resetCircuitBreakerContexts()
+	service := types.Service{
+		Type: "circuitBreaker",
+		Settings: map[string]interface{}{
+			"context":   "testHandler",
+			"threshold": 1.0,
+		},
+	}
+	breaker, _ := Initialize(service)
+	breaker.UpdateRequest(map[string]interface{}{"operation": "counter"})
+	breaker.Execute(context.Background())
+
+	server := httptest.NewServer(CircuitBreakerHandler("/circuitBreakers"))
+	defer server.Close()
+	read := func(method, path string, code int) []CircuitBreakerStatus {
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Fatalf("%s %s should be %d but is %d", method, path, code, resp.StatusCode)
+		}
+		var statuses []CircuitBreakerStatus
+		json.NewDecoder(resp.Body).Decode(&statuses)
+		return statuses
+	}
+
+	statuses := read(http.MethodGet, "/circuitBreakers/testHandler", http.StatusOK)
+	if len(statuses) != 1 || statuses[0].State != CircuitBreakerOpen || statuses[0].OpenUntil == nil {
+		t.Fatalf("the circuit breaker should be open but is %+v", statuses)
+	}
+	if len(read(http.MethodGet, "/circuitBreakers", http.StatusOK)) == 0 {
+		t.Fatal("the circuit breakers should be listed")
+	}
+	read(http.MethodGet, "/circuitBreakers/unknown", http.StatusNotFound)
+	read(http.MethodPost, "/circuitBreakers/testHandler", http.StatusMethodNotAllowed)
+	statuses = read(http.MethodPost, "/circuitBreakers/testHandler/reset", http.StatusOK)
+	if len(statuses) != 1 || statuses[0].State != CircuitBreakerClosed {
+		t.Fatalf("the circuit breaker should be reset but is %+v", statuses)
+	}
+	breaker, _ = Initialize(service)
+	if err := breaker.Execute(context.Background()); err != nil {
+		t.Fatalf("a reset circuit breaker should let requests through but got %v", err)
+	}
+}
+
+func TestCircuitBreakerStateFile(t *testing.T) {
+	resetCircuitBreakerContexts()
+	dir, err := ioutil.TempDir("", "circuitbreaker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer resetCircuitBreakerContexts()
+	service := types.Service{
+		Type: "circuitBreaker",
+		Settings: map[string]interface{}{
+			"context":   "testStateFile",
+			"threshold": 1.0,
+			"stateFile": filepath.Join(dir, "state.json"),
+		},
+	}
+	breaker, _ := Initialize(service)
+	breaker.UpdateRequest(map[string]interface{}{"operation": "counter"})
+	breaker.Execute(context.Background())
+
+	// A restart forgets the contexts but not the state file.
+	resetCircuitBreakerContexts()
+	breaker, _ = Initialize(service)
+	if err = breaker.Execute(context.Background()); err != ErrorCircuitBreakerTripped {
+		t.Fatalf("the restored circuit breaker should be tripped but got %v", err)
+	}
+
+	circuitBreakerContexts.Reset("testStateFile")
+	resetCircuitBreakerContexts()
+	breaker, _ = Initialize(service)
+	if err = breaker.Execute(context.Background()); err != nil {
+		t.Fatalf("the restored circuit breaker should be closed but got %v", err)
+	}
+}
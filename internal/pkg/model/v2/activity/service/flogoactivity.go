@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -45,7 +46,7 @@ func (f *FlogoActivity) UpdateRequest(values map[string]interface{}) (err error)
 }
 
 // Execute invokes this FlogoActivity service.
-func (f *FlogoActivity) Execute() (err error) {
+func (f *FlogoActivity) Execute(ctx context.Context) (err error) {
 	fa := activity.Get(f.Request.Ref)
 	if fa == nil {
 		return fmt.Errorf("unable to find Flogo activity: %s", f.Request.Ref)
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"testing"
@@ -67,7 +68,7 @@ func TestFlogoActivity(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = instance.Execute()
+	err = instance.Execute(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
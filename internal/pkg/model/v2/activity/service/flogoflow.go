@@ -82,7 +82,7 @@ func (f *FlogoFlow) setRequestValues(settings map[string]interface{}) (err error
 }
 
 // Execute invokes this FlogoActivity service.
-func (f *FlogoFlow) Execute() (err error) {
+func (f *FlogoFlow) Execute(ctx context.Context) (err error) {
 	// Ignore IDs and do everything by ref?
 	var flowAction action.Action
 	flowActionStored, exists := flowActions.Load(f.Request.Reference)
@@ -128,9 +128,8 @@ func (f *FlogoFlow) Execute() (err error) {
 			mAttrs["_T."+k] = attr
 		}
 	}
-	ctx := trigger.NewContext(context.Background(), attrs)
 	r := runner.NewDirect()
-	outputData, err := r.Execute(ctx, flowAction, mAttrs)
+	outputData, err := r.Execute(trigger.NewContext(ctx, attrs), flowAction, mAttrs)
 	outputs := make(map[string]interface{})
 	for _, v := range outputData {
 		outputs[v.Name()] = v.Value()
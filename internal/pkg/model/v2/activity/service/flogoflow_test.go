@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
@@ -52,7 +53,7 @@ func TestFlogoFlow(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = instance.Execute()
+	err = instance.Execute(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1,7 +1,9 @@
 package grpc
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"sync"
 
@@ -16,22 +18,67 @@ import (
 // log is the default package logger
 var log = logger.GetLogger("tibco-service-grpc")
 
-type mashGRPCClienConn struct {
-	conn  *grpc.ClientConn
-	count int
+// connections holds client connections keyed by host address.
+type connections struct {
+	connMap map[string]*grpc.ClientConn
+	sync.Mutex
 }
 
-type mashGRPCClinetConns struct {
-	connMap map[string]*mashGRPCClienConn
-	sync.Mutex
+func newConnections() *connections {
+	return &connections{
+		connMap: make(map[string]*grpc.ClientConn),
+	}
+}
+
+// Breaker fails the calls of a GRPC service to an upstream fast while the
+// upstream is failing.
+type Breaker interface {
+	// Allow returns an error when the upstream is not to be called, or a
+	// function that reports the error of the call.
+	Allow(upstream string) (done func(err error), err error)
+}
+
+// GRPCFactory shares client connections between the executions of a GRPC
+// service definition.
+type GRPCFactory struct {
+	settings map[string]interface{}
+	conns    *connections
+	// Breaker guards the calls of the executions if it is set.
+	Breaker Breaker
+}
+
+// NewGRPCFactory creates a GRPCFactory with provided settings.
+func NewGRPCFactory(settings map[string]interface{}) *GRPCFactory {
+	return &GRPCFactory{settings: settings}
+}
+
+// Start implements service.Factory.Start
+func (f *GRPCFactory) Start() (err error) {
+	f.conns = newConnections()
+	return nil
+}
+
+// New implements service.Factory.New
+func (f *GRPCFactory) New() (service *GRPC, err error) {
+	grpcService, err := InitializeGRPC(f.settings)
+	grpcService.conns = f.conns
+	grpcService.breaker = f.Breaker
+	return grpcService, err
 }
 
-var conns = mashGRPCClinetConns{
-	connMap: make(map[string]*mashGRPCClienConn),
+// Close implements service.Factory.Close
+func (f *GRPCFactory) Close() (err error) {
+	if f.conns != nil {
+		err = f.conns.close()
+	}
+	return err
 }
 
 // GRPC is grpc service
 type GRPC struct {
+	conns    *connections
+	breaker  Breaker
+	rpcErr   error
 	Request  GRPCRequest  `json:"request"`
 	Response GRPCResponse `json:"response"`
 }
@@ -73,9 +120,23 @@ func InitializeGRPC(settings map[string]interface{}) (grpcService *GRPC, err err
 }
 
 // Execute invokes this GRPC service.
-func (g *GRPC) Execute() (err error) {
+func (g *GRPC) Execute(ctx context.Context) (err error) {
 
 	g.Response = GRPCResponse{}
+	g.rpcErr = nil
+	if g.breaker != nil {
+		done, bErr := g.breaker.Allow(g.Request.HostURL)
+		if bErr != nil {
+			return bErr
+		}
+		defer func() {
+			if err != nil {
+				done(err)
+			} else {
+				done(g.rpcErr)
+			}
+		}()
+	}
 
 	opts := []grpc.DialOption{}
 	log.Debug("enableTLS: ", g.Request.EnableTLS)
@@ -92,19 +153,23 @@ func (g *GRPC) Execute() (err error) {
 		opts = []grpc.DialOption{grpc.WithInsecure()}
 	}
 
-	conn, err := getConnection(g.Request.HostURL, opts)
+	conns := g.conns
+	if conns == nil {
+		conns = newConnections()
+		defer conns.close()
+	}
+	conn, err := conns.get(g.Request.HostURL, opts)
 	if err != nil {
 		return err
 	}
-	defer releaseConnection(g.Request.HostURL)
 
 	log.Debug("operating mode: ", g.Request.OperatingMode)
 
 	switch g.Request.OperatingMode {
 	case "grpc-to-grpc":
-		return gRPCTogRPCHandler(g, conn)
+		return gRPCTogRPCHandler(ctx, g, conn)
 	case "rest-to-grpc":
-		return restTogRPCHandler(g, conn)
+		return restTogRPCHandler(ctx, g, conn)
 	}
 
 	log.Error("Invalid use of service , OperatingMode not recognised")
@@ -190,7 +255,7 @@ func (g *GRPC) setRequestValues(settings map[string]interface{}) (err error) {
 			if len(g.Request.OperatingMode) == 0 {
 				g.Request.OperatingMode = "rest-to-grpc"
 			}
-			queryParams, ok := v.(map[string]string)
+			queryParams, ok := stringMap(v)
 			if !ok {
 				return errors.New("invalid type for queryParams")
 			}
@@ -226,35 +291,61 @@ func (g *GRPC) setRequestValues(settings map[string]interface{}) (err error) {
 	return nil
 }
 
-// getconnection returns single client connection object per hostaddress
-func getConnection(hostAdds string, opts []grpc.DialOption) (*grpc.ClientConn, error) {
-	conns.Lock()
-	defer conns.Unlock()
-	conn := conns.connMap[hostAdds]
+// stringMap converts mapped params into strings. A repeated param, which is
+// an array, has its values joined with commas.
+func stringMap(v interface{}) (map[string]string, bool) {
+	switch m := v.(type) {
+	case map[string]string:
+		return m, true
+	case map[string]interface{}:
+		params := make(map[string]string, len(m))
+		for key, value := range m {
+			switch value := value.(type) {
+			case string:
+				params[key] = value
+			case []string:
+				params[key] = strings.Join(value, ",")
+			case []interface{}:
+				values := make([]string, len(value))
+				for i, element := range value {
+					values[i] = fmt.Sprint(element)
+				}
+				params[key] = strings.Join(values, ",")
+			default:
+				params[key] = fmt.Sprint(value)
+			}
+		}
+		return params, true
+	}
+	return nil, false
+}
+
+// get returns single client connection object per hostaddress
+func (c *connections) get(hostAdds string, opts []grpc.DialOption) (*grpc.ClientConn, error) {
+	c.Lock()
+	defer c.Unlock()
+	conn := c.connMap[hostAdds]
 	if conn == nil {
-		c, err := grpc.Dial(hostAdds, opts...)
+		var err error
+		conn, err = grpc.Dial(hostAdds, opts...)
 		if err != nil {
 			log.Error(err)
 			return nil, err
 		}
-		conn = &mashGRPCClienConn{
-			conn:  c,
-			count: 0,
-		}
-		conns.connMap[hostAdds] = conn
+		c.connMap[hostAdds] = conn
 	}
-	conn.count++
-	return conn.conn, nil
+	return conn, nil
 }
 
-// releaseConnection closes created client connection per hostaddress
-func releaseConnection(hostAdds string) {
-	conns.Lock()
-	defer conns.Unlock()
-	conn := conns.connMap[hostAdds]
-	conn.count--
-	if conn.count <= 0 {
-		conn.conn.Close()
-		delete(conns.connMap, hostAdds)
+// close closes all created client connections
+func (c *connections) close() (err error) {
+	c.Lock()
+	defer c.Unlock()
+	for hostAdds, conn := range c.connMap {
+		if cerr := conn.Close(); cerr != nil {
+			err = cerr
+		}
+		delete(c.connMap, hostAdds)
 	}
+	return err
 }
@@ -1,6 +1,7 @@
 package grpc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -12,7 +13,7 @@ import (
 
 var clientInterfaceObj interface{}
 
-func gRPCTogRPCHandler(g *GRPC, conn *grpc.ClientConn) error {
+func gRPCTogRPCHandler(ctx context.Context, g *GRPC, conn *grpc.ClientConn) error {
 
 	serviceName := g.Request.GrpcMthdParamtrs["serviceName"].(string)
 	protoName := g.Request.GrpcMthdParamtrs["protoName"].(string)
@@ -34,7 +35,7 @@ func gRPCTogRPCHandler(g *GRPC, conn *grpc.ClientConn) error {
 
 					inputs := make([]reflect.Value, 2)
 
-					inputs[0] = reflect.ValueOf(g.Request.GrpcMthdParamtrs["contextdata"])
+					inputs[0] = reflect.ValueOf(ctx)
 					inputs[1] = reflect.ValueOf(g.Request.GrpcMthdParamtrs["reqdata"])
 
 					resultArr := reflect.ValueOf(clientInterfaceObj).MethodByName(g.Request.GrpcMthdParamtrs["methodName"].(string)).Call(inputs)
@@ -42,6 +43,7 @@ func gRPCTogRPCHandler(g *GRPC, conn *grpc.ClientConn) error {
 					res := resultArr[0]
 					grpcErr := resultArr[1]
 					if !grpcErr.IsNil() {
+						g.rpcErr, _ = grpcErr.Interface().(error)
 						erroString := fmt.Sprintf("%v", grpcErr.Interface())
 						log.Error("Propagating error to calling function:", erroString)
 						erroString = "{\"error\":\"true\",\"details\":{\"error\":\"" + erroString + "\"}}"
@@ -62,6 +64,7 @@ func gRPCTogRPCHandler(g *GRPC, conn *grpc.ClientConn) error {
 					resMap := service.InvokeMethod(InvokeMethodData)
 
 					if resMap["Error"] != nil {
+						g.rpcErr, _ = resMap["Error"].(error)
 						log.Errorf("Error occured:%v", resMap["Error"])
 						erroString := fmt.Sprintf("%v", resMap["Error"])
 						erroString = "{\"error\":\"true\",\"details\":{\"error\":\"" + erroString + "\"}}"
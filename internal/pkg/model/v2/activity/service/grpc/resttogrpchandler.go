@@ -1,6 +1,7 @@
 package grpc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -9,7 +10,7 @@ import (
 	"google.golang.org/grpc"
 )
 
-func restTogRPCHandler(g *GRPC, conn *grpc.ClientConn) error {
+func restTogRPCHandler(ctx context.Context, g *GRPC, conn *grpc.ClientConn) error {
 	// check for method name
 	if len(g.Request.MethodName) == 0 {
 		if len(g.Request.PathParams["grpcMethodName"]) == 0 {
@@ -42,6 +43,7 @@ func restTogRPCHandler(g *GRPC, conn *grpc.ClientConn) error {
 					InvokeMethodData["Content"] = g.Request.Content
 				}
 				InvokeMethodData["Mode"] = "rest-to-grpc"
+				InvokeMethodData["Context"] = ctx
 				resMap := service.InvokeMethod(InvokeMethodData)
 				if resMap["Response"] != nil && strings.Compare(string(resMap["Response"].([]byte)), "null") != 0 {
 					err := util.Unmarshal("application/json", resMap["Response"].([]byte), &g.Response.Body)
@@ -49,6 +51,7 @@ func restTogRPCHandler(g *GRPC, conn *grpc.ClientConn) error {
 						return err
 					}
 				} else {
+					g.rpcErr, _ = resMap["Error"].(error)
 					erroString := fmt.Sprintf("%v", resMap["Error"])
 					erroString = "{\"error\":\"true\",\"details\":{\"error\":\"" + erroString + "\"}}"
 					err := util.Unmarshal("application/json", []byte(erroString), &g.Response.Body)
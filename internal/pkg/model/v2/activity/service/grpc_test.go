@@ -126,7 +126,7 @@ func TestGRPC(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = instance.Execute()
+	err = instance.Execute(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -158,7 +158,7 @@ func TestGRPC(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = instance.Execute()
+	err = instance.Execute(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -3,12 +3,14 @@ package service
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -31,9 +33,12 @@ const (
 
 // HTTP is an HTTP service.
 type HTTP struct {
-	netError bool
-	Request  HTTPRequest  `json:"request"`
-	Response HTTPResponse `json:"response"`
+	netError   bool
+	client     *http.Client
+	metrics    *HTTPMetrics
+	resilience *Resilience
+	Request    HTTPRequest  `json:"request"`
+	Response   HTTPResponse `json:"response"`
 }
 
 // HTTPRequest is an http service request.
@@ -44,7 +49,7 @@ type HTTPRequest struct {
 	URL        string                 `json:"url"`
 	Body       string                 `json:"body"`
 	Headers    map[string]interface{} `json:"headers"`
-	Query      map[string]string      `json:"query"`
+	Query      map[string]interface{} `json:"query"`
 	Timeout    int                    `json:"timeout"`
 }
 
@@ -57,21 +62,48 @@ type HTTPResponse struct {
 }
 
 // Execute invokes this HTTP service.
-func (h *HTTP) Execute() (err error) {
+func (h *HTTP) Execute(ctx context.Context) (err error) {
 	h.Response = HTTPResponse{}
 	if h.Request.Timeout == 0 {
 		h.Request.Timeout = defaultTimeout
 	}
-	client := &http.Client{Timeout: time.Duration(h.Request.Timeout) * time.Second}
+	client := h.client
+	if client == nil {
+		client = &http.Client{}
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(h.Request.Timeout)*time.Second)
+	defer cancel()
 	body := bytes.NewReader([]byte(h.Request.Body))
 
 	req, err := http.NewRequest(h.Request.Method, h.Request.CompleteURL(), body)
 	if err != nil {
 		return err
 	}
+	req = req.WithContext(ctx)
 	AddHeaders(req.Header, h.Request.Headers)
 
-	resp, err := client.Do(req)
+	var done func(err error)
+	if h.resilience != nil {
+		if done, err = h.resilience.Allow(req.URL.Host); err != nil {
+			return err
+		}
+	}
+	var resp *http.Response
+	if h.metrics != nil {
+		resp, err = h.metrics.do(client, req)
+	} else {
+		resp, err = client.Do(req)
+	}
+	if done != nil {
+		switch {
+		case err == nil:
+			done(upstreamStatus(resp.StatusCode))
+		case ctx.Err() != nil:
+			done(ctx.Err())
+		default:
+			done(err)
+		}
+	}
 	if err != nil {
 		if h.netError {
 			if netError, ok := err.(net.Error); ok {
@@ -83,19 +115,24 @@ func (h *HTTP) Execute() (err error) {
 	}
 	h.Response.StatusCode = resp.StatusCode
 	h.Response.Headers = DesliceValues(resp.Header)
-	bodyReader := resp.Body
-	if resp.ContentLength > 0 && resp.Header.Get("Content-Encoding") == "gzip" {
-		bodyReader, err = gzip.NewReader(bodyReader)
+	defer resp.Body.Close()
+	respbody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	// The length of a gzip body is often unknown, so it is decoded whenever
+	// there is one and the transport did not already decode it.
+	if len(respbody) > 0 && !resp.Uncompressed && resp.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(bytes.NewReader(respbody))
 		if err != nil {
 			return err
 		}
+		defer reader.Close()
+		if respbody, err = ioutil.ReadAll(reader); err != nil {
+			return err
+		}
 	}
-	defer bodyReader.Close()
-	respbody, err := ioutil.ReadAll(bodyReader)
-	if err != nil {
-		return err
-	}
-	contentType := resp.Header.Get("Content-Type")
+	contentType := decodeContentType(resp.Header.Get("Content-Type"), respbody)
 	err = util.Unmarshal(contentType, respbody, &h.Response.Body)
 	if err != nil {
 		return err
@@ -110,12 +147,62 @@ func InitializeHTTP(settings map[string]interface{}) (httpService *HTTP, err err
 	req := HTTPRequest{}
 	req.PathParams = make(map[string]interface{})
 	req.Headers = make(map[string]interface{})
-	req.Query = make(map[string]string)
+	req.Query = make(map[string]interface{})
 	httpService.Request = req
 	err = httpService.setRequestValues(settings)
 	return httpService, err
 }
 
+// HTTPFactory shares a pooled http.Client between the executions of an HTTP
+// service definition. The transport of the client is configured by the
+// settings of the service definition and counts its connection events.
+type HTTPFactory struct {
+	name       string
+	settings   map[string]interface{}
+	transport  *http.Transport
+	client     *http.Client
+	metrics    *HTTPMetrics
+	resilience *Resilience
+}
+
+// NewHTTPFactory creates an HTTPFactory with provided settings.
+func NewHTTPFactory(name string, settings map[string]interface{}) *HTTPFactory {
+	return &HTTPFactory{name: name, settings: settings}
+}
+
+// Start implements Factory.Start
+func (f *HTTPFactory) Start() (err error) {
+	settings, err := newHTTPTransportSettings(f.settings)
+	if err != nil {
+		return err
+	}
+	f.transport, err = settings.transport()
+	if err != nil {
+		return err
+	}
+	f.client = &http.Client{Transport: f.transport, CheckRedirect: settings.checkRedirect}
+	f.metrics = lookupHTTPMetrics(f.name)
+	f.resilience, err = NewResilience(f.name, "http", f.settings)
+	return err
+}
+
+// New implements Factory.New
+func (f *HTTPFactory) New() (service Service, err error) {
+	httpService, err := InitializeHTTP(f.settings)
+	httpService.client = f.client
+	httpService.metrics = f.metrics
+	httpService.resilience = f.resilience
+	return httpService, err
+}
+
+// Close implements Factory.Close
+func (f *HTTPFactory) Close() (err error) {
+	if f.transport != nil {
+		f.transport.CloseIdleConnections()
+	}
+	return nil
+}
+
 // UpdateRequest updates a request on an existing HTTP service instance with new values.
 func (h *HTTP) UpdateRequest(values map[string]interface{}) (err error) {
 	return h.setRequestValues(values)
@@ -144,19 +231,37 @@ func (h *HTTP) setRequestValues(settings map[string]interface{}) (err error) {
 			}
 			h.Request.Path = path
 		case "headers":
-			headers, ok := v.(map[string]interface{})
-			if !ok {
+			var headers map[string]interface{}
+			switch hs := v.(type) {
+			case map[string]interface{}:
+				headers = hs
+			case map[string]string:
+				headers = make(map[string]interface{}, len(hs))
+				for key, value := range hs {
+					headers[key] = value
+				}
+			default:
 				return errors.New("invalid type for headers")
 			}
 			if err := mergo.Merge(&h.Request.Headers, headers, mergo.WithOverride); err != nil {
 				return errors.New("unable to merge header values")
 			}
 		case "query":
-			query, ok := v.(map[string]string)
-			if !ok {
+			var query map[string]interface{}
+			switch q := v.(type) {
+			case map[string]interface{}:
+				query = q
+			case map[string]string:
+				query = make(map[string]interface{}, len(q))
+				for key, value := range q {
+					query[key] = value
+				}
+			default:
 				return errors.New("invalid type for query")
 			}
-			h.Request.Query = query
+			if err := mergo.Merge(&h.Request.Query, query, mergo.WithOverride); err != nil {
+				return errors.New("unable to merge query values")
+			}
 		case "pathParams":
 			pathParams, ok := v.(map[string]interface{})
 			if !ok {
@@ -187,32 +292,54 @@ func (h *HTTP) setRequestValues(settings map[string]interface{}) (err error) {
 					}
 				}
 			}
-			if _, ok := h.Request.Headers["Content-Type"]; !ok {
-				h.Request.Headers["Content-Type"] = contentType
+			key, ok := headerKey(h.Request.Headers, "Content-Type")
+			if !ok {
+				key = "Content-Type"
+			} else if s, ok := h.Request.Headers[key].(string); ok {
+				contentType = s
 			}
 
-			data, err := util.Marshal(body)
+			data, encodedType, err := encodeBody(contentType, body)
 			if err != nil {
 				return err
 			}
+			h.Request.Headers[key] = encodedType
 			h.Request.Body = string(data)
 		}
 	}
 	return nil
 }
 
-// AddHeaders adds the headers in headers to headers.
+// AddHeaders adds the headers in headers to headers. A header that is an
+// array is added once per value.
 func AddHeaders(h http.Header, headers map[string]interface{}) {
 	for key, value := range headers {
-		switch value := value.(type) {
-		case string:
-			h.Add(key, value)
-		case []interface{}:
-			for _, v := range value {
-				AddHeaders(h, map[string]interface{}{key: v})
-			}
+		for _, v := range values(value) {
+			h.Add(key, v)
+		}
+	}
+}
+
+// values converts a mapped header or query value into its values. Arrays have
+// a value per element and scalars like numbers are formatted.
+func values(value interface{}) []string {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []interface{}:
+		var all []string
+		for _, v := range value {
+			all = append(all, values(v)...)
 		}
+		return all
+	case float64:
+		return []string{strconv.FormatFloat(value, 'f', -1, 64)}
 	}
+	return []string{fmt.Sprint(value)}
 }
 
 // DesliceValues is used to collapse single value string slices from map values.
@@ -245,7 +372,9 @@ func (h *HTTPRequest) CompleteURL() string {
 	if len(h.Query) > 0 {
 		params := url.Values{}
 		for k, v := range h.Query {
-			params.Add(k, v)
+			for _, value := range values(v) {
+				params.Add(k, value)
+			}
 		}
 		if strings.Contains(h.URL, "?") {
 			return fmt.Sprintf("%s&%s", h.URL, params.Encode())
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/TIBCOSoftware/mashling/lib/util"
+)
+
+const (
+	contentTypeMultipart = "multipart/form-data"
+	contentTypeForm      = util.MIMEForm
+)
+
+// mediaType returns the media type of a content type without its parameters.
+func mediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return mediaType
+}
+
+// headerKey finds the key of a header regardless of its case.
+func headerKey(headers map[string]interface{}, name string) (string, bool) {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// encodeBody encodes a request body for its content type. A body that is
+// already encoded, like a raw copy of a request body, is sent as it is.
+func encodeBody(contentType string, body interface{}) (data []byte, encodedType string, err error) {
+	object, isObject := body.(map[string]interface{})
+	if isObject {
+		if _, raw := object[util.MetaCopy]; raw {
+			data, err = util.Marshal(body)
+			return data, contentType, err
+		}
+	}
+	switch mediaType(contentType) {
+	case contentTypeMultipart:
+		if isObject {
+			return encodeMultipart(object)
+		}
+	case contentTypeForm:
+		if isObject {
+			return []byte(formValues(util.Clean(object)).Encode()), contentType, nil
+		}
+	case util.MIMEApplicationJSON, util.MIMETextXML, util.MIMEApplicationXML:
+	default:
+		// Binary and text payloads are passed through untouched.
+		switch b := body.(type) {
+		case string:
+			return []byte(b), contentType, nil
+		case []byte:
+			return b, contentType, nil
+		}
+	}
+	data, err = util.Marshal(body)
+	return data, contentType, err
+}
+
+// formValues converts the fields of a form into values. An array field is
+// sent as repeated values.
+func formValues(fields map[string]interface{}) url.Values {
+	values := url.Values{}
+	for key, value := range fields {
+		if array, ok := value.([]interface{}); ok {
+			for _, element := range array {
+				values.Add(key, fmt.Sprint(element))
+			}
+			continue
+		}
+		values.Add(key, fmt.Sprint(value))
+	}
+	return values
+}
+
+// encodeMultipart encodes the fields of a multipart/form-data body. A field
+// that is an object with a filename is a file, with its content given either
+// as is in content or base64 encoded in base64.
+func encodeMultipart(fields map[string]interface{}) ([]byte, string, error) {
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+	keys := make([]string, 0, len(fields))
+	for key := range util.Clean(fields) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values, ok := fields[key].([]interface{})
+		if !ok {
+			values = []interface{}{fields[key]}
+		}
+		for _, value := range values {
+			if err := writePart(writer, key, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buffer.Bytes(), writer.FormDataContentType(), nil
+}
+
+func writePart(writer *multipart.Writer, name string, value interface{}) error {
+	file, ok := value.(map[string]interface{})
+	if !ok {
+		return writer.WriteField(name, fmt.Sprint(value))
+	}
+	filename, ok := file["filename"].(string)
+	if !ok {
+		return fmt.Errorf("file %s needs a filename", name)
+	}
+	var content []byte
+	switch {
+	case file["base64"] != nil:
+		encoded, ok := file["base64"].(string)
+		if !ok {
+			return fmt.Errorf("invalid type for base64 of file %s", name)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid base64 content of file %s: %v", name, err)
+		}
+		content = decoded
+	default:
+		switch c := file["content"].(type) {
+		case string:
+			content = []byte(c)
+		case []byte:
+			content = c
+		case nil:
+		default:
+			return fmt.Errorf("invalid type for content of file %s", name)
+		}
+	}
+	contentType, ok := file["contentType"].(string)
+	if !ok {
+		contentType = util.MIMEUnknown
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(name), escapeQuotes(filename)))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(content)
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// decodeContentType returns the content type a response body is parsed with.
+// JSON and XML content types lose their parameters, others keep them so that
+// the body can be passed on unchanged.
+func decodeContentType(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	switch mediaType := mediaType(contentType); mediaType {
+	case util.MIMEApplicationJSON, util.MIMETextXML, util.MIMEApplicationXML:
+		return mediaType
+	}
+	return contentType
+}
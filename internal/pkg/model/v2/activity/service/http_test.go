@@ -1,10 +1,26 @@
 package service
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"io"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
 	"github.com/TIBCOSoftware/mashling/lib/util"
@@ -93,7 +109,7 @@ func TestHTTP(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		err = instance.Execute()
+		err = instance.Execute(context.Background())
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -174,3 +190,333 @@ func TestHTTP(t *testing.T) {
 		"pathParams": map[string]interface{}{"id": 1},
 	}, "", "", "")
 }
+
+func TestHTTPFactory(t *testing.T) {
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, `{"name": "sally"}`)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	factory := NewFactory(types.Service{
+		Name:     "pets",
+		Type:     "http",
+		Settings: map[string]interface{}{"url": server.URL, "method": methodGET},
+	})
+	err := factory.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		instance, err := factory.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = instance.Execute(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if instance.(*HTTP).Response.StatusCode != http.StatusOK {
+			t.Fatalf("status code is %d and should be 200", instance.(*HTTP).Response.StatusCode)
+		}
+	}
+	if atomic.LoadInt32(&connections) != 1 {
+		t.Fatalf("executions should share 1 connection but opened %d", connections)
+	}
+	err = factory.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeClientCert writes a self signed client certificate and its key to dir.
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mashling"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func executeHTTP(t *testing.T, factory Factory) *HTTP {
+	instance, err := factory.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return instance.(*HTTP)
+}
+
+func TestHTTPFactoryTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, `{"client": "`+r.TLS.PeerCertificates[0].Subject.CommonName+`"}`)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+	server.TLS.ClientCAs.AddCert(clientCert)
+	server.StartTLS()
+	defer server.Close()
+	caFile := filepath.Join(dir, "ca.crt")
+	err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	factory := NewFactory(types.Service{
+		Name: "mtls",
+		Type: "http",
+		Settings: map[string]interface{}{
+			"url":        server.URL,
+			"method":     methodGET,
+			"caFile":     caFile,
+			"clientCert": certFile,
+			"clientKey":  keyFile,
+		},
+	})
+	if err = factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer factory.Close()
+	for i := 0; i < 2; i++ {
+		body := executeHTTP(t, factory).Response.Body.(map[string]interface{})
+		if body["client"] != "mashling" {
+			t.Fatalf("backend should see the client certificate but got %v", body)
+		}
+	}
+	metrics := HTTPTransportMetrics()["mtls"]
+	if metrics.Requests != 2 || metrics.ConnectionsOpened != 1 || metrics.ConnectionsReused != 1 || metrics.TLSHandshakes != 1 || metrics.InFlight != 0 {
+		t.Fatalf("metrics should count 2 requests over 1 connection but are %+v", metrics)
+	}
+
+	factory = NewFactory(types.Service{
+		Name:     "untrusted",
+		Type:     "http",
+		Settings: map[string]interface{}{"url": server.URL, "method": methodGET},
+	})
+	if err = factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer factory.Close()
+	instance, _ := factory.New()
+	if instance.Execute(context.Background()) == nil {
+		t.Fatal("a backend with an unknown certificate should be rejected")
+	}
+	if metrics = HTTPTransportMetrics()["untrusted"]; metrics.Failures != 1 || metrics.TLSHandshakeErrors != 1 {
+		t.Fatalf("metrics should count the failed handshake but are %+v", metrics)
+	}
+}
+
+func TestHTTPFactoryRedirectsAndProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pet" {
+			http.Redirect(w, r, "/pet", http.StatusFound)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, `{"name": "sally"}`)
+	}))
+	defer server.Close()
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer proxy.Close()
+
+	test := func(settings map[string]interface{}, status int) {
+		settings["url"], settings["method"] = server.URL+"/old", methodGET
+		factory := NewFactory(types.Service{Name: "redirects", Type: "http", Settings: settings})
+		if err := factory.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer factory.Close()
+		if code := executeHTTP(t, factory).Response.StatusCode; code != status {
+			t.Fatalf("status code is %d and should be %d with %v", code, status, settings)
+		}
+	}
+	test(map[string]interface{}{}, http.StatusOK)
+	test(map[string]interface{}{"followRedirects": false}, http.StatusFound)
+	test(map[string]interface{}{"proxy": proxy.URL}, http.StatusTeapot)
+	if atomic.LoadInt32(&proxied) != 1 {
+		t.Fatal("request should go through the proxy")
+	}
+
+	for _, settings := range []map[string]interface{}{
+		{"maxRedirects": "ten"},
+		{"idleConnTimeout": "soon"},
+		{"clientCert": "client.crt"},
+		{"caFile": filepath.Join(t.TempDir(), "missing.crt")},
+	} {
+		if NewFactory(types.Service{Name: "invalid", Type: "http", Settings: settings}).Start() == nil {
+			t.Fatalf("settings %v should be invalid", settings)
+		}
+	}
+}
+
+func TestHTTPBodies(t *testing.T) {
+	png := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/multipart":
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Fatal(err)
+			}
+			file, header, err := r.FormFile("photo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, _ := ioutil.ReadAll(file)
+			if !bytes.Equal(content, png) || header.Filename != "sally.png" || header.Header.Get("Content-Type") != "image/png" {
+				t.Fatalf("file should be the photo but is %q %v", content, header.Header)
+			}
+			if tags := r.MultipartForm.Value["tag"]; r.FormValue("name") != "sally" || len(tags) != 2 {
+				t.Fatalf("fields should be sent but are %v", r.MultipartForm.Value)
+			}
+		case "/form":
+			if r.Header.Get("Content-Type") != contentTypeForm {
+				t.Fatalf("content type should be a form but is %s", r.Header.Get("Content-Type"))
+			}
+			if err := r.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+			if r.PostForm.Get("name") != "sally" || len(r.PostForm["tag"]) != 2 {
+				t.Fatalf("form should be sent but is %v", r.PostForm)
+			}
+		case "/binary":
+			content, _ := ioutil.ReadAll(r.Body)
+			if !bytes.Equal(content, png) {
+				t.Fatalf("binary body should be untouched but is %q", content)
+			}
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(content)
+		case "/gzip":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			writer := gzip.NewWriter(w)
+			io.WriteString(writer, `{"name": "sally"}`)
+			writer.Close()
+		}
+	}))
+	defer server.Close()
+
+	execute := func(path string, values map[string]interface{}) *HTTP {
+		instance, err := InitializeHTTP(map[string]interface{}{"url": server.URL + path, "method": methodPOST})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = instance.UpdateRequest(values); err != nil {
+			t.Fatal(err)
+		}
+		if err = instance.Execute(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return instance
+	}
+	execute("/multipart", map[string]interface{}{
+		"headers": map[string]interface{}{"content-type": "multipart/form-data"},
+		"body": map[string]interface{}{
+			"name":  "sally",
+			"tag":   []interface{}{"cat", "black"},
+			"photo": map[string]interface{}{"filename": "sally.png", "contentType": "image/png", "base64": "iVBORwD//g=="},
+		},
+	})
+	execute("/form", map[string]interface{}{
+		"headers": map[string]interface{}{"Content-Type": contentTypeForm},
+		"body":    map[string]interface{}{"name": "sally", "tag": []interface{}{"cat", "black"}},
+	})
+	response := execute("/binary", map[string]interface{}{
+		"headers": map[string]interface{}{"Content-Type": "image/png"},
+		"body":    string(png),
+	}).Response
+	data, err := util.Marshal(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, png) {
+		t.Fatalf("binary response should be untouched but is %q", data)
+	}
+	response = execute("/gzip", map[string]interface{}{
+		"headers": map[string]interface{}{"Accept-Encoding": "gzip"},
+	}).Response
+	if body, ok := response.Body.(map[string]interface{}); !ok || body["name"] != "sally" {
+		t.Fatalf("gzip response without a length should be decoded but is %v", response.Body)
+	}
+}
+
+func TestHTTPQueryAndHeaderValues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if tags := query["tag"]; len(tags) != 2 || tags[0] != "a" || tags[1] != "b" {
+			t.Fatalf("tag should be repeated but is %v", tags)
+		}
+		if query.Get("limit") != "10" || query.Get("page") != "2" || query.Get("all") != "true" {
+			t.Fatalf("typed values should be formatted but are %v", query)
+		}
+		if accept := r.Header["Accept"]; len(accept) != 2 || r.Header.Get("X-Count") != "3" {
+			t.Fatalf("headers should be repeated and formatted but are %v", r.Header)
+		}
+	}))
+	defer server.Close()
+
+	instance, err := InitializeHTTP(map[string]interface{}{
+		"url":    server.URL,
+		"method": methodGET,
+		"query":  map[string]string{"limit": "10"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = instance.UpdateRequest(map[string]interface{}{
+		"query": map[string]interface{}{
+			"tag":  []string{"a", "b"},
+			"page": 2.0,
+			"all":  true,
+		},
+		"headers": map[string]interface{}{
+			"Accept":  []string{"application/json", "text/plain"},
+			"X-Count": 3.0,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
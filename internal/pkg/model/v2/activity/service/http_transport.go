@@ -0,0 +1,286 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultMaxRedirects = 10
+
+// httpTransportSettings are the settings of an HTTP service definition that
+// configure the transport shared by its executions.
+type httpTransportSettings struct {
+	dialTimeout         time.Duration
+	keepAlive           time.Duration
+	disableKeepAlives   bool
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     time.Duration
+	tlsHandshakeTimeout time.Duration
+	caFile              string
+	clientCert          string
+	clientKey           string
+	serverName          string
+	insecureSkipVerify  bool
+	proxy               string
+	followRedirects     bool
+	maxRedirects        int
+}
+
+func newHTTPTransportSettings(settings map[string]interface{}) (s *httpTransportSettings, err error) {
+	s = &httpTransportSettings{
+		dialTimeout:         30 * time.Second,
+		keepAlive:           30 * time.Second,
+		maxIdleConns:        100,
+		idleConnTimeout:     90 * time.Second,
+		tlsHandshakeTimeout: 10 * time.Second,
+		followRedirects:     true,
+		maxRedirects:        defaultMaxRedirects,
+	}
+	durations := map[string]*time.Duration{
+		"dialTimeout":         &s.dialTimeout,
+		"keepAlive":           &s.keepAlive,
+		"idleConnTimeout":     &s.idleConnTimeout,
+		"tlsHandshakeTimeout": &s.tlsHandshakeTimeout,
+	}
+	ints := map[string]*int{
+		"maxIdleConns":        &s.maxIdleConns,
+		"maxIdleConnsPerHost": &s.maxIdleConnsPerHost,
+		"maxConnsPerHost":     &s.maxConnsPerHost,
+		"maxRedirects":        &s.maxRedirects,
+	}
+	strs := map[string]*string{
+		"caFile":     &s.caFile,
+		"clientCert": &s.clientCert,
+		"clientKey":  &s.clientKey,
+		"serverName": &s.serverName,
+		"proxy":      &s.proxy,
+	}
+	bools := map[string]*bool{
+		"disableKeepAlives":  &s.disableKeepAlives,
+		"insecureSkipVerify": &s.insecureSkipVerify,
+		"followRedirects":    &s.followRedirects,
+	}
+	for k, v := range settings {
+		if d, ok := durations[k]; ok {
+			str, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid type for %s", k)
+			}
+			if *d, err = time.ParseDuration(str); err != nil || *d < 0 {
+				return nil, fmt.Errorf("%s must be a duration but is %s", k, str)
+			}
+		} else if i, ok := ints[k]; ok {
+			switch n := v.(type) {
+			case float64:
+				*i = int(n)
+			case int:
+				*i = n
+			default:
+				return nil, fmt.Errorf("invalid type for %s", k)
+			}
+			if *i < 0 {
+				return nil, fmt.Errorf("%s must not be negative", k)
+			}
+		} else if str, ok := strs[k]; ok {
+			if *str, ok = v.(string); !ok {
+				return nil, fmt.Errorf("invalid type for %s", k)
+			}
+		} else if b, ok := bools[k]; ok {
+			if *b, ok = v.(bool); !ok {
+				return nil, fmt.Errorf("invalid type for %s", k)
+			}
+		}
+	}
+	if (s.clientCert == "") != (s.clientKey == "") {
+		return nil, errors.New("clientCert and clientKey must be set together")
+	}
+	return s, nil
+}
+
+// tlsConfig creates the TLS configuration used to connect to the backend.
+func (s *httpTransportSettings) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{ServerName: s.serverName, InsecureSkipVerify: s.insecureSkipVerify}
+	if s.caFile != "" {
+		pem, err := ioutil.ReadFile(s.caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", s.caFile)
+		}
+	}
+	if s.clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(s.clientCert, s.clientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// transport creates the transport shared by the executions of a service.
+func (s *httpTransportSettings) transport() (*http.Transport, error) {
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy := http.ProxyFromEnvironment
+	if s.proxy != "" {
+		proxyURL, err := url.Parse(s.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %v", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   s.dialTimeout,
+			KeepAlive: s.keepAlive,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		DisableKeepAlives:     s.disableKeepAlives,
+		MaxIdleConns:          s.maxIdleConns,
+		MaxIdleConnsPerHost:   s.maxIdleConnsPerHost,
+		MaxConnsPerHost:       s.maxConnsPerHost,
+		IdleConnTimeout:       s.idleConnTimeout,
+		TLSHandshakeTimeout:   s.tlsHandshakeTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}, nil
+}
+
+// checkRedirect applies the redirect policy of a service.
+func (s *httpTransportSettings) checkRedirect(req *http.Request, via []*http.Request) error {
+	if !s.followRedirects {
+		return http.ErrUseLastResponse
+	}
+	if len(via) >= s.maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", s.maxRedirects)
+	}
+	return nil
+}
+
+// HTTPMetrics are the connection level metrics of the transport of an HTTP
+// service definition.
+type HTTPMetrics struct {
+	Requests           int64 `json:"requests"`
+	Failures           int64 `json:"failures"`
+	InFlight           int64 `json:"inFlight"`
+	ConnectionsOpened  int64 `json:"connectionsOpened"`
+	ConnectionsReused  int64 `json:"connectionsReused"`
+	ConnectErrors      int64 `json:"connectErrors"`
+	TLSHandshakes      int64 `json:"tlsHandshakes"`
+	TLSHandshakeErrors int64 `json:"tlsHandshakeErrors"`
+}
+
+var httpMetrics = struct {
+	services map[string]*HTTPMetrics
+	sync.Mutex
+}{services: make(map[string]*HTTPMetrics)}
+
+// lookupHTTPMetrics returns the metrics of a service definition, which its
+// factory counts the connection events of the service definition in.
+func lookupHTTPMetrics(name string) *HTTPMetrics {
+	httpMetrics.Lock()
+	defer httpMetrics.Unlock()
+	metrics, ok := httpMetrics.services[name]
+	if !ok {
+		metrics = &HTTPMetrics{}
+		httpMetrics.services[name] = metrics
+	}
+	return metrics
+}
+
+// ResetHTTPMetrics forgets the metrics of every service definition, like
+// those of the service definitions that a reload removed.
+func ResetHTTPMetrics() {
+	httpMetrics.Lock()
+	defer httpMetrics.Unlock()
+	httpMetrics.services = make(map[string]*HTTPMetrics)
+}
+
+// snapshot reads the metrics atomically.
+func (m *HTTPMetrics) snapshot() HTTPMetrics {
+	return HTTPMetrics{
+		Requests:           atomic.LoadInt64(&m.Requests),
+		Failures:           atomic.LoadInt64(&m.Failures),
+		InFlight:           atomic.LoadInt64(&m.InFlight),
+		ConnectionsOpened:  atomic.LoadInt64(&m.ConnectionsOpened),
+		ConnectionsReused:  atomic.LoadInt64(&m.ConnectionsReused),
+		ConnectErrors:      atomic.LoadInt64(&m.ConnectErrors),
+		TLSHandshakes:      atomic.LoadInt64(&m.TLSHandshakes),
+		TLSHandshakeErrors: atomic.LoadInt64(&m.TLSHandshakeErrors),
+	}
+}
+
+// clientTrace counts the connection events of a request.
+func (m *HTTPMetrics) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&m.ConnectionsReused, 1)
+			} else {
+				atomic.AddInt64(&m.ConnectionsOpened, 1)
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				atomic.AddInt64(&m.ConnectErrors, 1)
+			}
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			atomic.AddInt64(&m.TLSHandshakes, 1)
+			if err != nil {
+				atomic.AddInt64(&m.TLSHandshakeErrors, 1)
+			}
+		},
+	}
+}
+
+// do sends a request and counts it.
+func (m *HTTPMetrics) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&m.Requests, 1)
+	atomic.AddInt64(&m.InFlight, 1)
+	defer atomic.AddInt64(&m.InFlight, -1)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), m.clientTrace()))
+	resp, err := client.Do(req)
+	if err != nil {
+		atomic.AddInt64(&m.Failures, 1)
+	}
+	return resp, err
+}
+
+// HTTPTransportMetrics returns the metrics of every HTTP service definition
+// by name.
+func HTTPTransportMetrics() map[string]HTTPMetrics {
+	httpMetrics.Lock()
+	defer httpMetrics.Unlock()
+	metrics := make(map[string]HTTPMetrics, len(httpMetrics.services))
+	for name, m := range httpMetrics.services {
+		metrics[name] = m.snapshot()
+	}
+	return metrics
+}
+
+// HTTPMetricsHandler serves the metrics of the HTTP service definitions.
+func HTTPMetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(HTTPTransportMetrics())
+	})
+}
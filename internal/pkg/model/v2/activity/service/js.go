@@ -1,8 +1,11 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/dop251/goja"
 	"github.com/imdario/mergo"
@@ -18,6 +21,8 @@ type JS struct {
 type JSRequest struct {
 	Script     string                 `json:"script"`
 	Parameters map[string]interface{} `json:"parameters"`
+	Timeout    string                 `json:"timeout"`
+	MaxMemory  uint64                 `json:"maxMemory"`
 }
 
 // JSResponse is a JS service response.
@@ -28,7 +33,7 @@ type JSResponse struct {
 }
 
 // Execute invokes this JS service.
-func (j *JS) Execute() (err error) {
+func (j *JS) Execute(ctx context.Context) (err error) {
 	j.Response = JSResponse{}
 	result := make(map[string]interface{})
 	vm, err := NewVM(nil)
@@ -37,9 +42,22 @@ func (j *JS) Execute() (err error) {
 		j.Response.ErrorMessage = err.Error()
 		return err
 	}
+	if j.Request.Timeout != "" {
+		vm.limits.Timeout, err = time.ParseDuration(j.Request.Timeout)
+		if err != nil {
+			j.Response.Error = true
+			j.Response.ErrorMessage = err.Error()
+			return err
+		}
+	}
+	if j.Request.MaxMemory != 0 {
+		vm.limits.MaxMemory = j.Request.MaxMemory
+	}
 	vm.SetInVM("parameters", j.Request.Parameters)
 	vm.SetInVM("result", result)
-	_, err = vm.vm.RunScript("JSServiceScript", j.Request.Script)
+	_, err = vm.guard(ctx, func() (goja.Value, error) {
+		return vm.vm.RunScript("JSServiceScript", j.Request.Script)
+	})
 	if err != nil {
 		j.Response.Error = true
 		j.Response.ErrorMessage = err.Error()
@@ -87,6 +105,24 @@ func (j *JS) setRequestValues(settings map[string]interface{}) (err error) {
 			if err := mergo.Merge(&j.Request.Parameters, parameters, mergo.WithOverride); err != nil {
 				return errors.New("unable to merge parameters values")
 			}
+		case "timeout":
+			timeout, ok := v.(string)
+			if !ok {
+				return errors.New("invalid type for timeout")
+			}
+			if _, err := time.ParseDuration(timeout); err != nil {
+				return fmt.Errorf("invalid timeout: %v", err)
+			}
+			j.Request.Timeout = timeout
+		case "maxMemory":
+			switch maxMemory := v.(type) {
+			case float64:
+				j.Request.MaxMemory = uint64(maxMemory)
+			case int:
+				j.Request.MaxMemory = uint64(maxMemory)
+			default:
+				return errors.New("invalid type for maxMemory")
+			}
 		default:
 			// ignore and move on.
 		}
@@ -94,15 +130,18 @@ func (j *JS) setRequestValues(settings map[string]interface{}) (err error) {
 	return nil
 }
 
-// VM represents a VM object.
+// VM represents a VM object. Scripts run in a VM without the globals that
+// compile code at runtime and within the default limits.
 type VM struct {
-	vm *goja.Runtime
+	vm     *goja.Runtime
+	limits Limits
 }
 
 // NewVM initializes a new VM with defaults.
 func NewVM(defaults map[string]interface{}) (vm *VM, err error) {
-	vm = &VM{}
+	vm = &VM{limits: DefaultLimits}
 	vm.vm = goja.New()
+	sandbox(vm.vm)
 	for k, v := range defaults {
 		if v != nil {
 			vm.vm.Set(k, v)
@@ -117,10 +156,44 @@ func (vm *VM) EvaluateToBool(condition string) (truthy bool, err error) {
 		return true, nil
 	}
 	var res goja.Value
-	res, err = vm.vm.RunString(condition)
+	res, err = vm.guard(context.Background(), func() (goja.Value, error) {
+		return vm.vm.RunString(condition)
+	})
 	if err != nil {
 		return false, err
 	}
+	return toBool(res)
+}
+
+// Program is a script that has been compiled once and can be run in any VM.
+type Program struct {
+	program *goja.Program
+	err     error
+}
+
+// Compile compiles a script into a Program. A compilation error is retained
+// and returned each time the Program is evaluated.
+func Compile(name, script string) *Program {
+	program, err := goja.Compile(name, script, false)
+	return &Program{program: program, err: err}
+}
+
+// EvaluateProgramToBool evaluates a compiled condition within the context of the VM.
+func (vm *VM) EvaluateProgramToBool(program *Program) (truthy bool, err error) {
+	if program.err != nil {
+		return false, program.err
+	}
+	var res goja.Value
+	res, err = vm.guard(context.Background(), func() (goja.Value, error) {
+		return vm.vm.RunProgram(program.program)
+	})
+	if err != nil {
+		return false, err
+	}
+	return toBool(res)
+}
+
+func toBool(res goja.Value) (truthy bool, err error) {
 	truthy, ok := res.Export().(bool)
 	if !ok {
 		err = errors.New("condition does not evaluate to bool")
@@ -132,7 +205,7 @@ func (vm *VM) EvaluateToBool(condition string) (truthy bool, err error) {
 // SetInVM sets the object name and value in the VM.
 func (vm *VM) SetInVM(name string, object interface{}) (err error) {
 	var valueJSON json.RawMessage
-	var vmObject map[string]interface{}
+	var vmObject interface{}
 	valueJSON, err = json.Marshal(object)
 	if err != nil {
 		return err
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
 )
@@ -21,7 +23,7 @@ func TestJS(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = instance.Execute()
+	err = instance.Execute(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -29,3 +31,88 @@ func TestJS(t *testing.T) {
 		t.Fatal("sum should be 3.0")
 	}
 }
+
+func TestJSTimeout(t *testing.T) {
+	service := types.Service{
+		Type:     "js",
+		Settings: map[string]interface{}{"script": "while (true) {}", "timeout": "50ms"},
+	}
+	instance, err := Initialize(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = instance.Execute(context.Background())
+	if _, ok := err.(*TimeoutError); !ok {
+		t.Fatalf("error should be a timeout error but is %v", err)
+	}
+	if !instance.(*JS).Response.Error {
+		t.Fatal("response should be an error")
+	}
+}
+
+func TestJSMaxMemory(t *testing.T) {
+	service := types.Service{
+		Type: "js",
+		Settings: map[string]interface{}{
+			"script":    "function recurse(n) { return recurse(n + 1) + 1; } recurse(0);",
+			"timeout":   "10s",
+			"maxMemory": float64(16 << 20),
+		},
+	}
+	instance, err := Initialize(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = instance.Execute(context.Background())
+	if _, ok := err.(*MemoryError); !ok {
+		t.Fatalf("error should be a memory error but is %v", err)
+	}
+}
+
+func TestJSCancel(t *testing.T) {
+	service := types.Service{
+		Type:     "js",
+		Settings: map[string]interface{}{"script": "while (true) {}", "timeout": "10s"},
+	}
+	instance, err := Initialize(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = instance.Execute(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("error should be the context error but is %v", err)
+	}
+}
+
+func TestVMSandbox(t *testing.T) {
+	vm, err := NewVM(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, condition := range []string{
+		"eval('true')",
+		"Function('return true')()",
+		"(function () {}).constructor('return true')()",
+	} {
+		if _, err := vm.EvaluateToBool(condition); err == nil {
+			t.Fatalf("%s should not be able to compile code", condition)
+		}
+	}
+}
+
+func TestVMTimeout(t *testing.T) {
+	vm, err := NewVM(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.limits.Timeout = 50 * time.Millisecond
+	if _, err = vm.EvaluateToBool("while (true) {}"); err == nil {
+		t.Fatal("an endless condition should time out")
+	}
+	truthy, err := vm.EvaluateToBool("true")
+	if err != nil || !truthy {
+		t.Fatalf("the VM should be usable after a timeout but got %t, %v", truthy, err)
+	}
+}
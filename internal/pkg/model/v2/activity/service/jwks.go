@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// defaultJWKSRefresh is how often a JWKS document is loaded again.
+	defaultJWKSRefresh = time.Hour
+	jwksFetchTimeout   = 10 * time.Second
+	// maxParsedKeys is the number of parsed PEM keys a JWT service keeps.
+	maxParsedKeys = 100
+)
+
+// jwksMinRefresh is the least time between two loads of a JWKS document
+// caused by tokens with an unknown kid or by a failed load.
+var jwksMinRefresh = time.Minute
+
+// jwtKeys keeps the parsed PEM keys and the JWKS documents of a JWT service
+// definition.
+type jwtKeys struct {
+	parsed *keyCache
+	sets   map[string]*keySet
+	sync.Mutex
+}
+
+func newJWTKeys() *jwtKeys {
+	return &jwtKeys{
+		parsed: newKeyCache(),
+		sets:   make(map[string]*keySet),
+	}
+}
+
+// keySet returns the key set of a JWKS location.
+func (k *jwtKeys) keySet(location string, refresh time.Duration) *keySet {
+	k.Lock()
+	defer k.Unlock()
+	set, ok := k.sets[location]
+	if !ok {
+		set = &keySet{location: location}
+		k.sets[location] = set
+	}
+	set.refresh = refresh
+	return set
+}
+
+// verificationKey returns the key that verifies a token signed with method
+// from a PEM encoded public key or certificate, or an HMAC secret.
+func (k *jwtKeys) verificationKey(method jwt.SigningMethod, key string) (interface{}, error) {
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		parsed, err := k.parsed.load(key, func() (interface{}, error) {
+			return jwt.ParseRSAPublicKeyFromPEM([]byte(key))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA public key: %v", err)
+		}
+		return parsed, nil
+	case *jwt.SigningMethodECDSA:
+		parsed, err := k.parsed.load(key, func() (interface{}, error) {
+			return jwt.ParseECPublicKeyFromPEM([]byte(key))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid ECDSA public key: %v", err)
+		}
+		return parsed, nil
+	}
+	// A public key is no secret, so it must never verify an HMAC signature.
+	if strings.HasPrefix(strings.TrimSpace(key), "-----BEGIN") {
+		return nil, errors.New("a PEM key cannot verify an HMAC signature")
+	}
+	return []byte(key), nil
+}
+
+// keyCache keeps parsed PEM keys so that they are not parsed for every token.
+// It forgets them all once it holds maxParsedKeys of them.
+type keyCache struct {
+	keys map[string]interface{}
+	sync.RWMutex
+}
+
+func newKeyCache() *keyCache {
+	return &keyCache{keys: make(map[string]interface{})}
+}
+
+func (c *keyCache) load(pem string, parse func() (interface{}, error)) (interface{}, error) {
+	c.RLock()
+	key, ok := c.keys[pem]
+	c.RUnlock()
+	if ok {
+		return key, nil
+	}
+	key, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	c.Lock()
+	if len(c.keys) >= maxParsedKeys {
+		c.keys = make(map[string]interface{})
+	}
+	c.keys[pem] = key
+	c.Unlock()
+	return key, nil
+}
+
+// keySet is a JWKS document loaded from a file or a URL.
+type keySet struct {
+	location  string
+	refresh   time.Duration
+	keys      map[string]interface{}
+	err       error
+	loaded    time.Time
+	attempted time.Time
+	loading   chan struct{}
+	sync.Mutex
+}
+
+// key selects the key with the kid, or the only key when the token has no
+// kid. The document is loaded again when it is due for a refresh or when the
+// kid is unknown, but no sooner than jwksMinRefresh after the last attempt.
+// It is loaded without holding the lock, and only the executions without
+// any keys wait for it.
+func (s *keySet) key(ctx context.Context, kid string) (interface{}, error) {
+	s.Lock()
+	_, known := s.keys[kid]
+	due := s.keys == nil || time.Since(s.loaded) > s.refresh || (kid != "" && !known)
+	if loading := s.loading; loading == nil && due && time.Since(s.attempted) > jwksMinRefresh {
+		loading = make(chan struct{})
+		s.loading, s.attempted = loading, time.Now()
+		s.Unlock()
+		keys, err := s.load()
+		s.Lock()
+		if err != nil {
+			log.Errorf("%v", err)
+			s.err = err
+		} else {
+			s.keys, s.err, s.loaded = keys, nil, time.Now()
+		}
+		s.loading = nil
+		close(loading)
+	} else if loading != nil && s.keys == nil {
+		s.Unlock()
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		s.Lock()
+	}
+	defer s.Unlock()
+	if s.keys == nil {
+		return nil, s.err
+	}
+	if kid == "" {
+		if len(s.keys) != 1 {
+			return nil, errors.New("token has no kid to select a key with")
+		}
+		for _, key := range s.keys {
+			return key, nil
+		}
+	}
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("no key with kid %s", kid)
+	}
+	return key, nil
+}
+
+func (s *keySet) load() (map[string]interface{}, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(s.location, "http://") || strings.HasPrefix(s.location, "https://") {
+		data, err = fetchJWKS(s.location)
+	} else {
+		data, err = ioutil.ReadFile(s.location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to load JWKS %s: %v", s.location, err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWKS %s: %v", s.location, err)
+	}
+	return keys, nil
+}
+
+func fetchJWKS(url string) ([]byte, error) {
+	client := &http.Client{Timeout: jwksFetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// jwk is a JSON web key.
+type jwk struct {
+	Kid string   `json:"kid"`
+	Kty string   `json:"kty"`
+	Use string   `json:"use"`
+	Crv string   `json:"crv"`
+	N   string   `json:"n"`
+	E   string   `json:"e"`
+	X   string   `json:"x"`
+	Y   string   `json:"y"`
+	K   string   `json:"k"`
+	X5c []string `json:"x5c"`
+}
+
+// parseJWKS parses the signature keys of a JWKS document by kid.
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(document.Keys))
+	for _, k := range document.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (interface{}, error) {
+	if len(k.X5c) > 0 {
+		der, err := base64.StdEncoding.DecodeString(k.X5c[0])
+		if err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(k.K, "="))
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
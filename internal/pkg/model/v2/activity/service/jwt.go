@@ -1,27 +1,69 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
+// JWTFactory shares the parsed keys and the JWKS documents of a JWT service
+// definition between its executions.
+type JWTFactory struct {
+	settings map[string]interface{}
+	keys     *jwtKeys
+}
+
+// NewJWTFactory creates a JWTFactory with provided settings.
+func NewJWTFactory(settings map[string]interface{}) *JWTFactory {
+	return &JWTFactory{settings: settings}
+}
+
+// Start implements Factory.Start
+func (f *JWTFactory) Start() (err error) {
+	if _, err = InitializeJWT(f.settings); err != nil {
+		return err
+	}
+	f.keys = newJWTKeys()
+	return nil
+}
+
+// New implements Factory.New
+func (f *JWTFactory) New() (service Service, err error) {
+	jwtService, err := InitializeJWT(f.settings)
+	jwtService.keys = f.keys
+	return jwtService, err
+}
+
+// Close implements Factory.Close
+func (f *JWTFactory) Close() (err error) {
+	f.keys = nil
+	return nil
+}
+
 // JWT is a JWT validation service.
 type JWT struct {
 	Request  JWTRequest  `json:"request"`
 	Response JWTResponse `json:"response"`
+	keys     *jwtKeys
 }
 
 // JWTRequest is an JWT validation request.
 type JWTRequest struct {
-	Token         string `json:"token"`
-	Key           string `json:"key"`
-	SigningMethod string `json:"signingMethod"`
-	Issuer        string `json:"iss"`
-	Subject       string `json:"sub"`
-	Audience      string `json:"aud"`
+	Token          string                 `json:"token"`
+	Key            string                 `json:"key"`
+	JWKS           string                 `json:"jwks"`
+	JWKSRefresh    time.Duration          `json:"jwksRefresh"`
+	SigningMethod  string                 `json:"signingMethod"`
+	Issuer         []string               `json:"iss"`
+	Subject        string                 `json:"sub"`
+	Audience       []string               `json:"aud"`
+	Leeway         time.Duration          `json:"leeway"`
+	RequiredClaims map[string]interface{} `json:"requiredClaims"`
 }
 
 // JWTResponse is a parsed JWT response.
@@ -42,9 +84,12 @@ type ParsedToken struct {
 }
 
 // Execute invokes this JWT service.
-func (j *JWT) Execute() error {
+func (j *JWT) Execute(ctx context.Context) error {
 	j.Response = JWTResponse{}
-	token, err := jwt.Parse(j.Request.Token, func(token *jwt.Token) (interface{}, error) {
+	// The standard claims are validated after the signature so that a leeway
+	// can be applied to them.
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(j.Request.Token, func(token *jwt.Token) (interface{}, error) {
 		// Make sure signing alg matches what we expect
 		switch strings.ToLower(j.Request.SigningMethod) {
 		case "hmac":
@@ -68,30 +113,28 @@ func (j *JWT) Execute() error {
 		default:
 			return nil, fmt.Errorf("Unknown signing method expected: %v", j.Request.SigningMethod)
 		}
+		if j.Request.JWKS != "" {
+			kid, _ := token.Header["kid"].(string)
+			return j.keys.keySet(j.Request.JWKS, j.Request.JWKSRefresh).key(ctx, kid)
+		}
+		return j.keys.verificationKey(token.Method, j.Request.Key)
+	})
+	if err == nil {
 		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			if j.Request.Issuer != "" && !claims.VerifyIssuer(j.Request.Issuer, true) {
-				return nil, jwt.NewValidationError("iss claims do not match", jwt.ValidationErrorIssuer)
-			}
-			if j.Request.Audience != "" && !claims.VerifyAudience(j.Request.Audience, true) {
-				return nil, jwt.NewValidationError("aud claims do not match", jwt.ValidationErrorAudience)
-			}
-			subClaim, sok := claims["sub"].(string)
-			if j.Request.Subject != "" && (!sok || strings.Compare(j.Request.Subject, subClaim) != 0) {
-				return nil, jwt.NewValidationError("sub claims do not match", jwt.ValidationErrorClaimsInvalid)
+			if verr := j.validateClaims(claims); verr != nil {
+				err = verr
 			}
 		} else {
-			return nil, jwt.NewValidationError("unable to parse claims", jwt.ValidationErrorClaimsInvalid)
+			err = jwt.NewValidationError("unable to parse claims", jwt.ValidationErrorClaimsInvalid)
 		}
-
-		return []byte(j.Request.Key), nil
-	})
-	if token != nil && token.Valid {
+	}
+	if err == nil && token != nil && token.Valid {
 		j.Response.Valid = true
 		j.Response.Token = ParsedToken{Signature: token.Signature, SigningMethod: token.Method.Alg(), Header: token.Header}
 		if claims, ok := token.Claims.(jwt.MapClaims); ok {
 			j.Response.Token.Claims = claims
 		}
-		return err
+		return nil
 	} else if ve, ok := err.(*jwt.ValidationError); ok {
 		j.Response.Valid = false
 		j.Response.ValidationMessage = ve.Error()
@@ -104,10 +147,82 @@ func (j *JWT) Execute() error {
 	return nil
 }
 
+// validateClaims validates the time based claims with the leeway and the
+// claims the request expects.
+func (j *JWT) validateClaims(claims jwt.MapClaims) *jwt.ValidationError {
+	now := time.Now().Unix()
+	leeway := int64(j.Request.Leeway / time.Second)
+	if !claims.VerifyExpiresAt(now-leeway, false) {
+		return jwt.NewValidationError("Token is expired", jwt.ValidationErrorExpired)
+	}
+	if !claims.VerifyNotBefore(now+leeway, false) {
+		return jwt.NewValidationError("Token is not valid yet", jwt.ValidationErrorNotValidYet)
+	}
+	if !claims.VerifyIssuedAt(now+leeway, false) {
+		return jwt.NewValidationError("Token used before issued", jwt.ValidationErrorIssuedAt)
+	}
+	if len(j.Request.Issuer) > 0 && !containsAny(j.Request.Issuer, claims["iss"]) {
+		return jwt.NewValidationError("iss claims do not match", jwt.ValidationErrorIssuer)
+	}
+	if len(j.Request.Audience) > 0 && !containsAny(j.Request.Audience, claims["aud"]) {
+		return jwt.NewValidationError("aud claims do not match", jwt.ValidationErrorAudience)
+	}
+	subClaim, sok := claims["sub"].(string)
+	if j.Request.Subject != "" && (!sok || strings.Compare(j.Request.Subject, subClaim) != 0) {
+		return jwt.NewValidationError("sub claims do not match", jwt.ValidationErrorClaimsInvalid)
+	}
+	for name, expected := range j.Request.RequiredClaims {
+		claim, ok := claims[name]
+		if !ok {
+			return jwt.NewValidationError(fmt.Sprintf("%s claim is missing", name), jwt.ValidationErrorClaimsInvalid)
+		}
+		if expected != nil && !claimMatches(claim, expected) {
+			return jwt.NewValidationError(fmt.Sprintf("%s claims do not match", name), jwt.ValidationErrorClaimsInvalid)
+		}
+	}
+	return nil
+}
+
+// containsAny checks if a claim, which is a string or an array of strings,
+// has one of the accepted values.
+func containsAny(accepted []string, claim interface{}) bool {
+	var values []interface{}
+	switch c := claim.(type) {
+	case string:
+		values = []interface{}{c}
+	case []interface{}:
+		values = c
+	}
+	for _, value := range values {
+		for _, a := range accepted {
+			if value == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimMatches checks if a claim has the expected value. An array claim, like
+// a list of roles, matches when it has the expected value.
+func claimMatches(claim, expected interface{}) bool {
+	if reflect.DeepEqual(claim, expected) {
+		return true
+	}
+	if array, ok := claim.([]interface{}); ok {
+		for _, element := range array {
+			if reflect.DeepEqual(element, expected) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // InitializeJWT initializes a JWT validation service with provided settings.
 func InitializeJWT(settings map[string]interface{}) (jwtService *JWT, err error) {
-	jwtService = &JWT{}
-	request := JWTRequest{}
+	jwtService = &JWT{keys: newJWTKeys()}
+	request := JWTRequest{JWKSRefresh: defaultJWKSRefresh}
 	jwtService.Request = request
 	err = jwtService.setRequestValues(settings)
 	return jwtService, err
@@ -143,8 +258,8 @@ func (j *JWT) setRequestValues(settings map[string]interface{}) error {
 			}
 			j.Request.SigningMethod = signingMethod
 		case "issuer":
-			issuer, ok := v.(string)
-			if !ok {
+			issuer, err := stringList(v)
+			if err != nil {
 				return errors.New("invalid type for issuer")
 			}
 			j.Request.Issuer = issuer
@@ -155,14 +270,72 @@ func (j *JWT) setRequestValues(settings map[string]interface{}) error {
 			}
 			j.Request.Subject = subject
 		case "audience":
-			audience, ok := v.(string)
-			if !ok {
+			audience, err := stringList(v)
+			if err != nil {
 				return errors.New("invalid type for audience")
 			}
 			j.Request.Audience = audience
+		case "jwks":
+			jwks, ok := v.(string)
+			if !ok {
+				return errors.New("invalid type for jwks")
+			}
+			j.Request.JWKS = jwks
+		case "jwksRefresh", "leeway":
+			str, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("invalid type for %s", k)
+			}
+			duration, err := time.ParseDuration(str)
+			if err != nil || duration < 0 {
+				return fmt.Errorf("%s must be a duration but is %s", k, str)
+			}
+			if k == "leeway" {
+				j.Request.Leeway = duration
+			} else {
+				j.Request.JWKSRefresh = duration
+			}
+		case "requiredClaims":
+			switch claims := v.(type) {
+			case map[string]interface{}:
+				j.Request.RequiredClaims = claims
+			default:
+				names, err := stringList(v)
+				if err != nil {
+					return errors.New("invalid type for requiredClaims")
+				}
+				j.Request.RequiredClaims = make(map[string]interface{}, len(names))
+				for _, name := range names {
+					j.Request.RequiredClaims[name] = nil
+				}
+			}
 		default:
 			// ignore and move on.
 		}
 	}
 	return nil
 }
+
+// stringList converts a string or an array of strings into a list.
+func stringList(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, element := range v {
+			str, ok := element.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a string", element)
+			}
+			list = append(list, str)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("%v is not a string or an array of strings", value)
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const defaultJWTExpiration = 5 * time.Minute
+
+// JWTIssuerFactory shares the signing keys of a JWT signing service
+// definition between its executions, so that a key file is read and a key
+// is parsed only once.
+type JWTIssuerFactory struct {
+	settings map[string]interface{}
+	keys     *signingKeys
+}
+
+// NewJWTIssuerFactory creates a JWTIssuerFactory with provided settings.
+func NewJWTIssuerFactory(settings map[string]interface{}) *JWTIssuerFactory {
+	return &JWTIssuerFactory{settings: settings}
+}
+
+// Start implements Factory.Start
+func (f *JWTIssuerFactory) Start() (err error) {
+	if _, err = InitializeJWTIssuer(f.settings); err != nil {
+		return err
+	}
+	f.keys = newSigningKeys()
+	return nil
+}
+
+// New implements Factory.New
+func (f *JWTIssuerFactory) New() (service Service, err error) {
+	issuer, err := InitializeJWTIssuer(f.settings)
+	issuer.keys = f.keys
+	return issuer, err
+}
+
+// Close implements Factory.Close
+func (f *JWTIssuerFactory) Close() (err error) {
+	f.keys = nil
+	return nil
+}
+
+// signingKeys keeps the key files that were read and the parsed keys of a
+// JWT signing service definition.
+type signingKeys struct {
+	files  map[string]string
+	parsed *keyCache
+	sync.Mutex
+}
+
+func newSigningKeys() *signingKeys {
+	return &signingKeys{files: make(map[string]string), parsed: newKeyCache()}
+}
+
+// file returns the contents of a key file, which is read once.
+func (k *signingKeys) file(name string) (string, error) {
+	k.Lock()
+	defer k.Unlock()
+	if key, ok := k.files[name]; ok {
+		return key, nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	k.files[name] = string(data)
+	return string(data), nil
+}
+
+// JWTIssuer is a service that signs JWT tokens.
+type JWTIssuer struct {
+	Request  JWTIssuerRequest  `json:"request"`
+	Response JWTIssuerResponse `json:"response"`
+	keys     *signingKeys
+}
+
+// JWTIssuerRequest is a JWT signing request. The key is never marshaled.
+type JWTIssuerRequest struct {
+	SigningMethod string                 `json:"signingMethod"`
+	Key           string                 `json:"-"`
+	KeyFile       string                 `json:"-"`
+	KeyEnv        string                 `json:"-"`
+	KeyID         string                 `json:"kid"`
+	Claims        map[string]interface{} `json:"claims"`
+	Headers       map[string]interface{} `json:"headers"`
+	Issuer        string                 `json:"iss"`
+	Subject       string                 `json:"sub"`
+	Audience      []string               `json:"aud"`
+	Expiration    time.Duration          `json:"expiration"`
+	ID            bool                   `json:"jti"`
+}
+
+// JWTIssuerResponse is a signed JWT token.
+type JWTIssuerResponse struct {
+	Token         string                 `json:"token"`
+	Authorization string                 `json:"authorization"`
+	Claims        map[string]interface{} `json:"claims"`
+	ExpiresAt     int64                  `json:"expiresAt"`
+}
+
+// Execute invokes this JWT signing service.
+func (j *JWTIssuer) Execute(ctx context.Context) error {
+	j.Response = JWTIssuerResponse{}
+	method := jwt.GetSigningMethod(j.Request.SigningMethod)
+	if method == nil {
+		return fmt.Errorf("unknown signing method %s", j.Request.SigningMethod)
+	}
+	key, err := j.signingKey(method)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{"iat": now.Unix()}
+	if j.Request.Expiration > 0 {
+		claims["exp"] = now.Add(j.Request.Expiration).Unix()
+	}
+	if j.Request.ID {
+		id := make([]byte, 16)
+		if _, err = rand.Read(id); err != nil {
+			return err
+		}
+		claims["jti"] = hex.EncodeToString(id)
+	}
+	if j.Request.Issuer != "" {
+		claims["iss"] = j.Request.Issuer
+	}
+	if j.Request.Subject != "" {
+		claims["sub"] = j.Request.Subject
+	}
+	switch len(j.Request.Audience) {
+	case 0:
+	case 1:
+		claims["aud"] = j.Request.Audience[0]
+	default:
+		claims["aud"] = j.Request.Audience
+	}
+	// Mapped claims take precedence over the generated ones.
+	for name, value := range j.Request.Claims {
+		claims[name] = value
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	for name, value := range j.Request.Headers {
+		if name == "alg" {
+			continue
+		}
+		token.Header[name] = value
+	}
+	if j.Request.KeyID != "" {
+		token.Header["kid"] = j.Request.KeyID
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return err
+	}
+	j.Response.Token = signed
+	j.Response.Authorization = "Bearer " + signed
+	j.Response.Claims = claims
+	if exp, ok := claims["exp"].(int64); ok {
+		j.Response.ExpiresAt = exp
+	} else if exp, ok := claims["exp"].(float64); ok {
+		j.Response.ExpiresAt = int64(exp)
+	}
+	return nil
+}
+
+// signingKey loads the key from the key setting, the key file or the
+// environment variable, and parses it for the signing method.
+func (j *JWTIssuer) signingKey(method jwt.SigningMethod) (interface{}, error) {
+	key := j.Request.Key
+	switch {
+	case j.Request.KeyFile != "":
+		var err error
+		if key, err = j.keys.file(j.Request.KeyFile); err != nil {
+			return nil, fmt.Errorf("unable to read key file: %v", err)
+		}
+	case j.Request.KeyEnv != "":
+		var ok bool
+		if key, ok = os.LookupEnv(j.Request.KeyEnv); !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", j.Request.KeyEnv)
+		}
+	}
+	if key == "" {
+		return nil, errors.New("no key to sign the token with")
+	}
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		parsed, err := j.keys.parsed.load(key, func() (interface{}, error) {
+			return jwt.ParseRSAPrivateKeyFromPEM([]byte(key))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA private key: %v", err)
+		}
+		return parsed, nil
+	case *jwt.SigningMethodECDSA:
+		parsed, err := j.keys.parsed.load(key, func() (interface{}, error) {
+			return jwt.ParseECPrivateKeyFromPEM([]byte(key))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid ECDSA private key: %v", err)
+		}
+		return parsed, nil
+	}
+	return []byte(key), nil
+}
+
+// InitializeJWTIssuer initializes a JWT signing service with provided settings.
+func InitializeJWTIssuer(settings map[string]interface{}) (issuer *JWTIssuer, err error) {
+	issuer = &JWTIssuer{keys: newSigningKeys()}
+	issuer.Request = JWTIssuerRequest{SigningMethod: "HS256", Expiration: defaultJWTExpiration, ID: true}
+	err = issuer.setRequestValues(settings)
+	return issuer, err
+}
+
+// UpdateRequest updates a JWT signing service with new provided settings.
+func (j *JWTIssuer) UpdateRequest(values map[string]interface{}) (err error) {
+	return j.setRequestValues(values)
+}
+
+func (j *JWTIssuer) setRequestValues(settings map[string]interface{}) error {
+	strs := map[string]*string{
+		"signingMethod": &j.Request.SigningMethod,
+		"key":           &j.Request.Key,
+		"keyFile":       &j.Request.KeyFile,
+		"keyEnv":        &j.Request.KeyEnv,
+		"kid":           &j.Request.KeyID,
+		"issuer":        &j.Request.Issuer,
+		"subject":       &j.Request.Subject,
+	}
+	for k, v := range settings {
+		if str, ok := strs[k]; ok {
+			if *str, ok = v.(string); !ok {
+				return fmt.Errorf("invalid type for %s", k)
+			}
+			continue
+		}
+		switch k {
+		case "audience":
+			audience, err := stringList(v)
+			if err != nil {
+				return errors.New("invalid type for audience")
+			}
+			j.Request.Audience = audience
+		case "claims", "headers":
+			values, ok := v.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("invalid type for %s", k)
+			}
+			if k == "claims" {
+				j.Request.Claims = values
+			} else {
+				j.Request.Headers = values
+			}
+		case "expiration":
+			str, ok := v.(string)
+			if !ok {
+				return errors.New("invalid type for expiration")
+			}
+			expiration, err := time.ParseDuration(str)
+			if err != nil || expiration < 0 {
+				return fmt.Errorf("expiration must be a duration but is %s", str)
+			}
+			j.Request.Expiration = expiration
+		case "jti":
+			id, ok := v.(bool)
+			if !ok {
+				return errors.New("invalid type for jti")
+			}
+			j.Request.ID = id
+		default:
+			// ignore and move on.
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+)
+
+func issueJWT(t *testing.T, settings, values map[string]interface{}) JWTIssuerResponse {
+	instance, err := Initialize(types.Service{Type: "jwtIssuer", Settings: settings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.UpdateRequest(values); err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return instance.(*JWTIssuer).Response
+}
+
+func TestJWTIssuerHMAC(t *testing.T) {
+	os.Setenv("JWT_ISSUER_TEST_KEY", "qwertyuiopasdfghjklzxcvbnm789101")
+	defer os.Unsetenv("JWT_ISSUER_TEST_KEY")
+	settings := map[string]interface{}{
+		"keyEnv":     "JWT_ISSUER_TEST_KEY",
+		"issuer":     "gateway",
+		"audience":   "pets",
+		"expiration": "1m",
+		"headers":    map[string]interface{}{"typ": "JWT", "alg": "none"},
+	}
+	response := issueJWT(t, settings, map[string]interface{}{
+		"claims": map[string]interface{}{"sub": "sally", "plan": "gold"},
+	})
+	if response.Authorization != "Bearer "+response.Token {
+		t.Fatalf("the authorization should carry the token but is %s", response.Authorization)
+	}
+	if expiresAt := time.Unix(response.ExpiresAt, 0); time.Until(expiresAt) > time.Minute || time.Until(expiresAt) < 50*time.Second {
+		t.Fatalf("the token should expire in a minute but expires at %v", expiresAt)
+	}
+	first := response.Claims["jti"]
+	if first == nil || issueJWT(t, settings, nil).Claims["jti"] == first {
+		t.Fatal("every token should have a jti of its own")
+	}
+
+	validated := validateJWT(t, map[string]interface{}{
+		"signingMethod":  "HMAC",
+		"key":            "qwertyuiopasdfghjklzxcvbnm789101",
+		"issuer":         "gateway",
+		"audience":       "pets",
+		"requiredClaims": map[string]interface{}{"sub": "sally", "plan": "gold"},
+	}, response.Authorization)
+	if !validated.Valid || validated.Token.SigningMethod != "HS256" {
+		t.Fatalf("the issued token should be valid but got %+v", validated)
+	}
+
+	instance, _ := Initialize(types.Service{Type: "jwtIssuer", Settings: map[string]interface{}{"keyEnv": "JWT_ISSUER_TEST_UNSET"}})
+	if instance.Execute(context.Background()) == nil {
+		t.Fatal("a key from an unset environment variable should fail")
+	}
+}
+
+func TestJWTIssuerRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key.pem")
+	private := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err = ioutil.WriteFile(keyFile, private, 0600); err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	public := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	response := issueJWT(t, map[string]interface{}{
+		"signingMethod": "RS256",
+		"keyFile":       keyFile,
+		"kid":           "internal",
+		"expiration":    "0s",
+		"jti":           false,
+	}, map[string]interface{}{"claims": map[string]interface{}{"sub": "sally"}})
+	if _, ok := response.Claims["exp"]; ok || response.ExpiresAt != 0 {
+		t.Fatal("a token without an expiration should have no exp claim")
+	}
+	validated := validateJWT(t, map[string]interface{}{"signingMethod": "RSA", "key": public, "subject": "sally"}, response.Token)
+	if !validated.Valid || validated.Token.Header["kid"] != "internal" {
+		t.Fatalf("the issued token should be valid but got %+v", validated)
+	}
+
+	// A factory reads its key file once, and never marshals the key.
+	factory := NewFactory(types.Service{Type: "jwtIssuer", Settings: map[string]interface{}{"signingMethod": "RS256", "keyFile": keyFile}})
+	if err = factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer factory.Close()
+	for i := 0; i < 2; i++ {
+		issuer, _ := factory.New()
+		if err = issuer.Execute(context.Background()); err != nil {
+			t.Fatalf("issue %d should sign with the key file that was read but got %v", i, err)
+		}
+		if data, _ := json.Marshal(issuer); strings.Contains(string(data), keyFile) {
+			t.Fatalf("the key file should not be marshaled but got %s", data)
+		}
+		os.Remove(keyFile)
+	}
+
+	instance, _ := Initialize(types.Service{Type: "jwtIssuer", Settings: map[string]interface{}{"signingMethod": "RS256", "key": "secret"}})
+	if data, _ := json.Marshal(instance); strings.Contains(string(data), "secret") {
+		t.Fatalf("the key should not be marshaled but got %s", data)
+	}
+	if instance.Execute(context.Background()) == nil {
+		t.Fatal("an RSA token should not be signed with a secret")
+	}
+	if _, err = Initialize(types.Service{Type: "jwtIssuer", Settings: map[string]interface{}{"expiration": "soon"}}); err == nil {
+		t.Fatal("an invalid expiration should fail")
+	}
+}
@@ -1,9 +1,23 @@
 package service
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+	"github.com/dgrijalva/jwt-go"
 )
 
 func TestJWT(t *testing.T) {
@@ -26,7 +40,7 @@ func TestJWT(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = instance.Execute()
+	err = instance.Execute(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -35,3 +49,173 @@ func TestJWT(t *testing.T) {
 		t.Fatal("JWT token should be valid")
 	}
 }
+
+func validateJWT(t *testing.T, settings map[string]interface{}, token string) JWTResponse {
+	instance, err := Initialize(types.Service{Type: "jwt", Settings: settings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executeJWT(t, instance, token)
+}
+
+// validateJWTWith validates a token with a service of a started factory,
+// which keeps the key sets between validations.
+func validateJWTWith(t *testing.T, factory Factory, token string) JWTResponse {
+	instance, err := factory.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executeJWT(t, instance, token)
+}
+
+func executeJWT(t *testing.T, instance Service, token string) JWTResponse {
+	var err error
+	if err = instance.UpdateRequest(map[string]interface{}{"token": "Bearer " + token}); err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return instance.(*JWT).Response
+}
+
+func signJWT(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWTPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	settings := map[string]interface{}{"signingMethod": "RSA", "key": public}
+
+	now := time.Now().Unix()
+	token := signJWT(t, jwt.SigningMethodRS256, "", key, jwt.MapClaims{"sub": "sally", "exp": now + 60})
+	if response := validateJWT(t, settings, token); !response.Valid || response.Token.Claims["sub"] != "sally" {
+		t.Fatalf("a token signed with the private key should be valid but got %+v", response)
+	}
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if validateJWT(t, settings, signJWT(t, jwt.SigningMethodRS256, "", other, jwt.MapClaims{})).Valid {
+		t.Fatal("a token signed with another key should be invalid")
+	}
+	// The public key must not be usable as an HMAC secret.
+	forged := signJWT(t, jwt.SigningMethodHS256, "", []byte(public), jwt.MapClaims{})
+	if validateJWT(t, map[string]interface{}{"key": public}, forged).Valid {
+		t.Fatal("an HMAC token signed with the public key should be invalid")
+	}
+
+	expired := signJWT(t, jwt.SigningMethodRS256, "", key, jwt.MapClaims{"exp": now - 30, "nbf": now + 30})
+	if validateJWT(t, settings, expired).Valid {
+		t.Fatal("an expired token should be invalid")
+	}
+	settings["leeway"] = "1m"
+	if response := validateJWT(t, settings, expired); !response.Valid {
+		t.Fatalf("a token within the leeway should be valid but got %+v", response)
+	}
+}
+
+func TestJWTKeySet(t *testing.T) {
+	first, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	second, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ec := func(kid string, key *ecdsa.PrivateKey) map[string]interface{} {
+		return map[string]interface{}{
+			"kid": kid,
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+			"y":   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+		}
+	}
+	keys := []interface{}{ec("first", first)}
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer server.Close()
+	defer func(d time.Duration) { jwksMinRefresh = d }(jwksMinRefresh)
+	jwksMinRefresh = 0
+
+	settings := map[string]interface{}{
+		"signingMethod":  "ECDSA",
+		"jwks":           server.URL,
+		"issuer":         []interface{}{"https://a.example.com", "https://b.example.com"},
+		"audience":       []interface{}{"pets"},
+		"requiredClaims": map[string]interface{}{"roles": "admin"},
+	}
+	factory := NewFactory(types.Service{Type: "jwt", Settings: settings})
+	if err := factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer factory.Close()
+	claims := jwt.MapClaims{"iss": "https://b.example.com", "aud": []interface{}{"stores", "pets"}, "roles": []interface{}{"user", "admin"}}
+	if response := validateJWTWith(t, factory, signJWT(t, jwt.SigningMethodES256, "first", first, claims)); !response.Valid {
+		t.Fatalf("a token signed with a key of the set should be valid but got %+v", response)
+	}
+	if validateJWTWith(t, factory, signJWT(t, jwt.SigningMethodES256, "first", second, claims)).Valid {
+		t.Fatal("a token signed with another key than its kid should be invalid")
+	}
+
+	// A rotated key is found by loading the set again.
+	keys = append(keys, ec("second", second))
+	if response := validateJWTWith(t, factory, signJWT(t, jwt.SigningMethodES256, "second", second, claims)); !response.Valid {
+		t.Fatalf("a token signed with a rotated key should be valid but got %+v", response)
+	}
+	if atomic.LoadInt32(&fetches) != 2 {
+		t.Fatalf("the key set should be loaded twice but was loaded %d times", fetches)
+	}
+
+	for name, claims := range map[string]jwt.MapClaims{
+		"issuer":   {"iss": "https://c.example.com", "aud": "pets", "roles": "admin"},
+		"audience": {"iss": "https://a.example.com", "aud": "stores", "roles": "admin"},
+		"claim":    {"iss": "https://a.example.com", "aud": "pets", "roles": "user"},
+		"missing":  {"iss": "https://a.example.com", "aud": "pets"},
+	} {
+		if validateJWTWith(t, factory, signJWT(t, jwt.SigningMethodES256, "first", first, claims)).Valid {
+			t.Fatalf("a token with an unexpected %s should be invalid", name)
+		}
+	}
+	settings["requiredClaims"] = []interface{}{"roles"}
+	if !validateJWTWith(t, factory, signJWT(t, jwt.SigningMethodES256, "first", first, claims)).Valid {
+		t.Fatal("a token with the required claim should be valid")
+	}
+}
+
+func TestJWTKeySetOutage(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	factory := NewFactory(types.Service{Type: "jwt", Settings: map[string]interface{}{"jwks": server.URL}})
+	if err := factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer factory.Close()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	token := signJWT(t, jwt.SigningMethodES256, "first", key, jwt.MapClaims{})
+	for i := 0; i < 3; i++ {
+		if response := validateJWTWith(t, factory, token); response.Valid || response.ValidationMessage == "" {
+			t.Fatalf("a token should not be valid without a key set but got %+v", response)
+		}
+	}
+	if atomic.LoadInt32(&fetches) != 1 {
+		t.Fatalf("a failed load should back off but the key set was loaded %d times", fetches)
+	}
+}
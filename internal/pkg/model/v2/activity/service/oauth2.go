@@ -0,0 +1,434 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oauth2Introspect         = "introspect"
+	oauth2ClientCredentials  = "clientCredentials"
+	defaultOAuth2Timeout     = 10 * time.Second
+	defaultIntrospectionTTL  = time.Minute
+	defaultOAuth2RefreshSkew = 30 * time.Second
+)
+
+// OAuth2Factory shares the client, the cached introspections and the access
+// tokens of an OAuth2 service definition between its executions.
+type OAuth2Factory struct {
+	name      string
+	settings  map[string]interface{}
+	transport *http.Transport
+	client    *http.Client
+	caches    *oauth2Caches
+}
+
+// NewOAuth2Factory creates an OAuth2Factory with provided settings.
+func NewOAuth2Factory(name string, settings map[string]interface{}) *OAuth2Factory {
+	return &OAuth2Factory{name: name, settings: settings}
+}
+
+// Start implements Factory.Start
+func (f *OAuth2Factory) Start() (err error) {
+	if _, err = InitializeOAuth2(f.name, f.settings); err != nil {
+		return err
+	}
+	settings, err := newHTTPTransportSettings(f.settings)
+	if err != nil {
+		return err
+	}
+	f.transport, err = settings.transport()
+	if err != nil {
+		return err
+	}
+	f.client = &http.Client{Transport: f.transport, CheckRedirect: settings.checkRedirect}
+	f.caches = newOAuth2Caches()
+	return nil
+}
+
+// New implements Factory.New
+func (f *OAuth2Factory) New() (service Service, err error) {
+	oauth2, err := InitializeOAuth2(f.name, f.settings)
+	oauth2.client = f.client
+	oauth2.caches = f.caches
+	return oauth2, err
+}
+
+// Close implements Factory.Close
+func (f *OAuth2Factory) Close() (err error) {
+	if f.transport != nil {
+		f.transport.CloseIdleConnections()
+	}
+	if f.caches != nil {
+		err = f.caches.introspections.Close()
+	}
+	f.caches = nil
+	return err
+}
+
+// OAuth2 is a service that introspects OAuth2 tokens or fetches access tokens
+// with the client credentials grant.
+type OAuth2 struct {
+	Name     string         `json:"name"`
+	Request  OAuth2Request  `json:"request"`
+	Response OAuth2Response `json:"response"`
+	client   *http.Client
+	caches   *oauth2Caches
+}
+
+// OAuth2Request is an OAuth2 request.
+type OAuth2Request struct {
+	Mode             string            `json:"mode"`
+	Token            string            `json:"token"`
+	TokenTypeHint    string            `json:"tokenTypeHint"`
+	IntrospectionURL string            `json:"introspectionURL"`
+	TokenURL         string            `json:"tokenURL"`
+	ClientID         string            `json:"clientId"`
+	ClientSecret     string            `json:"clientSecret"`
+	Scopes           []string          `json:"scopes"`
+	Params           map[string]string `json:"params"`
+	CacheTTL         time.Duration     `json:"cacheTTL"`
+	RefreshSkew      time.Duration     `json:"refreshSkew"`
+	Refresh          bool              `json:"refresh"`
+	Timeout          time.Duration     `json:"timeout"`
+}
+
+// OAuth2Response is the result of an OAuth2 request. Introspection fills in
+// the token details and the client credentials grant the access token.
+type OAuth2Response struct {
+	Valid         bool                   `json:"valid"`
+	Active        bool                   `json:"active"`
+	HasScopes     bool                   `json:"hasScopes"`
+	Scope         string                 `json:"scope"`
+	Scopes        []string               `json:"scopes"`
+	ClientID      string                 `json:"clientId"`
+	Username      string                 `json:"username"`
+	Subject       string                 `json:"sub"`
+	Claims        map[string]interface{} `json:"claims"`
+	Cached        bool                   `json:"cached"`
+	AccessToken   string                 `json:"accessToken"`
+	TokenType     string                 `json:"tokenType"`
+	Authorization string                 `json:"authorization"`
+	ExpiresAt     int64                  `json:"expiresAt"`
+	Error         bool                   `json:"error"`
+	ErrorMessage  string                 `json:"errorMessage"`
+}
+
+// Execute invokes this OAuth2 service.
+func (o *OAuth2) Execute(ctx context.Context) error {
+	o.Response = OAuth2Response{}
+	switch o.Request.Mode {
+	case oauth2Introspect:
+		return o.introspect(ctx)
+	case oauth2ClientCredentials:
+		return o.clientCredentials(ctx)
+	}
+	return fmt.Errorf("unknown mode %s", o.Request.Mode)
+}
+
+// introspect asks the introspection endpoint about the token, see RFC 7662.
+// The answers are cached for cacheTTL, but never beyond the expiry of the
+// token. Failures of the endpoint are reported in the response.
+func (o *OAuth2) introspect(ctx context.Context) error {
+	if o.Request.IntrospectionURL == "" {
+		return errors.New("introspectionURL is required")
+	}
+	if o.Request.Token == "" {
+		return nil
+	}
+	hash := sha256.Sum256([]byte(o.Request.Token))
+	key := hex.EncodeToString(hash[:])
+	claims, cached := o.caches.introspection(key)
+	if !cached {
+		form := url.Values{"token": {o.Request.Token}}
+		if o.Request.TokenTypeHint != "" {
+			form.Set("token_type_hint", o.Request.TokenTypeHint)
+		}
+		var err error
+		if claims, err = o.post(ctx, o.Request.IntrospectionURL, form); err != nil {
+			o.Response.Error = true
+			o.Response.ErrorMessage = err.Error()
+			return nil
+		}
+		if o.Request.CacheTTL > 0 {
+			expires := time.Now().Add(o.Request.CacheTTL)
+			if exp, ok := claims["exp"].(float64); ok && time.Unix(int64(exp), 0).Before(expires) {
+				expires = time.Unix(int64(exp), 0)
+			}
+			o.caches.introspections.Set(ctx, key, &CacheEntry{Response: claims, Expires: expires})
+		}
+	}
+	o.Response.Cached = cached
+	o.Response.Claims = claims
+	o.Response.Active, _ = claims["active"].(bool)
+	if exp, ok := claims["exp"].(float64); ok {
+		o.Response.ExpiresAt = int64(exp)
+		if time.Now().Unix() >= o.Response.ExpiresAt {
+			o.Response.Active = false
+		}
+	}
+	o.Response.Scope, _ = claims["scope"].(string)
+	o.Response.Scopes = strings.Fields(o.Response.Scope)
+	o.Response.ClientID, _ = claims["client_id"].(string)
+	o.Response.Username, _ = claims["username"].(string)
+	o.Response.Subject, _ = claims["sub"].(string)
+	o.Response.HasScopes = hasScopes(o.Response.Scopes, o.Request.Scopes)
+	o.Response.Valid = o.Response.Active && o.Response.HasScopes
+	return nil
+}
+
+func hasScopes(granted, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, g := range granted {
+			if g == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// clientCredentials returns an access token of the client, see RFC 6749
+// section 4.4. The token is shared by the executions of the service and
+// fetched again when it is about to expire or when refresh is requested.
+func (o *OAuth2) clientCredentials(ctx context.Context) error {
+	if o.Request.TokenURL == "" {
+		return errors.New("tokenURL is required")
+	}
+	scope := strings.Join(o.Request.Scopes, " ")
+	cached := o.caches.accessToken(scope)
+	cached.Lock()
+	defer cached.Unlock()
+	expired := !cached.expires.IsZero() && time.Until(cached.expires) < o.Request.RefreshSkew
+	if cached.claims == nil || expired || o.Request.Refresh {
+		form := url.Values{"grant_type": {"client_credentials"}}
+		if scope != "" {
+			form.Set("scope", scope)
+		}
+		for k, v := range o.Request.Params {
+			form.Set(k, v)
+		}
+		claims, err := o.post(ctx, o.Request.TokenURL, form)
+		if err != nil {
+			return err
+		}
+		if _, ok := claims["access_token"].(string); !ok {
+			return errors.New("no access_token in the token response")
+		}
+		cached.claims = claims
+		cached.expires = time.Time{}
+		if expiresIn, ok := claims["expires_in"].(float64); ok {
+			cached.expires = time.Now().Add(time.Duration(expiresIn) * time.Second)
+		}
+	} else {
+		o.Response.Cached = true
+	}
+	o.Response.Claims = cached.claims
+	o.Response.AccessToken, _ = cached.claims["access_token"].(string)
+	o.Response.TokenType, _ = cached.claims["token_type"].(string)
+	if o.Response.TokenType == "" || strings.EqualFold(o.Response.TokenType, "bearer") {
+		o.Response.Authorization = "Bearer " + o.Response.AccessToken
+	} else {
+		o.Response.Authorization = o.Response.TokenType + " " + o.Response.AccessToken
+	}
+	o.Response.Scope, _ = cached.claims["scope"].(string)
+	if o.Response.Scope == "" {
+		o.Response.Scope = scope
+	}
+	o.Response.Scopes = strings.Fields(o.Response.Scope)
+	if !cached.expires.IsZero() {
+		o.Response.ExpiresAt = cached.expires.Unix()
+	}
+	o.Response.Valid = true
+	o.Response.Active = true
+	o.Response.HasScopes = true
+	return nil
+}
+
+// post sends a form authenticated with the client credentials and parses the
+// JSON answer.
+func (o *OAuth2) post(ctx context.Context, endpoint string, form url.Values) (map[string]interface{}, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	if o.Request.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Request.Timeout)
+		defer cancel()
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentTypeForm)
+	req.Header.Set("Accept", "application/json")
+	if o.Request.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(o.Request.ClientID), url.QueryEscape(o.Request.ClientSecret))
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s: %s", endpoint, resp.Status, strings.TrimSpace(string(body)))
+	}
+	claims := make(map[string]interface{})
+	if err = json.Unmarshal(body, &claims); err != nil {
+		return nil, fmt.Errorf("invalid answer from %s: %v", endpoint, err)
+	}
+	return claims, nil
+}
+
+// oauth2Caches keeps the answers of the introspection endpoint by token hash
+// and the access tokens of the client credentials grant by scope.
+type oauth2Caches struct {
+	introspections CacheStore
+	tokens         map[string]*accessToken
+	sync.Mutex
+}
+
+func newOAuth2Caches() *oauth2Caches {
+	store, _ := NewMemoryCacheStore(map[string]interface{}{"maxEntries": 10000.0})
+	return &oauth2Caches{introspections: store, tokens: make(map[string]*accessToken)}
+}
+
+func (c *oauth2Caches) introspection(key string) (map[string]interface{}, bool) {
+	entry, _ := c.introspections.Get(context.Background(), key)
+	if entry == nil {
+		return nil, false
+	}
+	if time.Now().After(entry.Expires) {
+		c.introspections.Delete(context.Background(), key)
+		return nil, false
+	}
+	return entry.Response, true
+}
+
+// accessToken is a cached token response of the client credentials grant.
+type accessToken struct {
+	claims  map[string]interface{}
+	expires time.Time
+	sync.Mutex
+}
+
+func (c *oauth2Caches) accessToken(scope string) *accessToken {
+	c.Lock()
+	defer c.Unlock()
+	token, ok := c.tokens[scope]
+	if !ok {
+		token = &accessToken{}
+		c.tokens[scope] = token
+	}
+	return token
+}
+
+// InitializeOAuth2 initializes an OAuth2 service with provided settings.
+func InitializeOAuth2(name string, settings map[string]interface{}) (oauth2 *OAuth2, err error) {
+	oauth2 = &OAuth2{Name: name, client: &http.Client{}, caches: newOAuth2Caches()}
+	oauth2.Request = OAuth2Request{
+		Mode:        oauth2Introspect,
+		CacheTTL:    defaultIntrospectionTTL,
+		RefreshSkew: defaultOAuth2RefreshSkew,
+		Timeout:     defaultOAuth2Timeout,
+	}
+	err = oauth2.setRequestValues(settings)
+	return oauth2, err
+}
+
+// UpdateRequest updates an OAuth2 service with new provided settings.
+func (o *OAuth2) UpdateRequest(values map[string]interface{}) (err error) {
+	return o.setRequestValues(values)
+}
+
+func (o *OAuth2) setRequestValues(settings map[string]interface{}) (err error) {
+	strs := map[string]*string{
+		"tokenTypeHint":    &o.Request.TokenTypeHint,
+		"introspectionURL": &o.Request.IntrospectionURL,
+		"tokenURL":         &o.Request.TokenURL,
+		"clientId":         &o.Request.ClientID,
+		"clientSecret":     &o.Request.ClientSecret,
+	}
+	durations := map[string]*time.Duration{
+		"cacheTTL":    &o.Request.CacheTTL,
+		"refreshSkew": &o.Request.RefreshSkew,
+		"timeout":     &o.Request.Timeout,
+	}
+	for k, v := range settings {
+		if str, ok := strs[k]; ok {
+			if *str, ok = v.(string); !ok {
+				return fmt.Errorf("invalid type for %s", k)
+			}
+			continue
+		}
+		if d, ok := durations[k]; ok {
+			str, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("invalid type for %s", k)
+			}
+			if *d, err = time.ParseDuration(str); err != nil || *d < 0 {
+				return fmt.Errorf("%s must be a duration but is %s", k, str)
+			}
+			continue
+		}
+		switch k {
+		case "mode":
+			mode, ok := v.(string)
+			if !ok || (mode != oauth2Introspect && mode != oauth2ClientCredentials) {
+				return fmt.Errorf("mode must be %s or %s", oauth2Introspect, oauth2ClientCredentials)
+			}
+			o.Request.Mode = mode
+		case "token":
+			token, ok := v.(string)
+			if !ok {
+				return errors.New("invalid type for token")
+			}
+			// Try to scrub any extra noise from the token string
+			if tokenSplit := strings.Fields(token); len(tokenSplit) > 0 {
+				token = tokenSplit[len(tokenSplit)-1]
+			}
+			o.Request.Token = token
+		case "scopes":
+			if str, ok := v.(string); ok {
+				o.Request.Scopes = strings.Fields(str)
+			} else if o.Request.Scopes, err = stringList(v); err != nil {
+				return errors.New("invalid type for scopes")
+			}
+		case "params":
+			params, ok := v.(map[string]interface{})
+			if !ok {
+				return errors.New("invalid type for params")
+			}
+			o.Request.Params = make(map[string]string, len(params))
+			for name, value := range params {
+				o.Request.Params[name] = fmt.Sprint(value)
+			}
+		case "refresh":
+			refresh, ok := v.(bool)
+			if !ok {
+				return errors.New("invalid type for refresh")
+			}
+			o.Request.Refresh = refresh
+		default:
+			// ignore and move on.
+		}
+	}
+	return nil
+}
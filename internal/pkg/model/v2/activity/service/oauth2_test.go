@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+)
+
+func startOAuth2(t *testing.T, name string, settings map[string]interface{}) Factory {
+	factory := NewFactory(types.Service{Name: name, Type: "oauth2", Settings: settings})
+	if err := factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return factory
+}
+
+func executeOAuth2(t *testing.T, factory Factory, values map[string]interface{}) OAuth2Response {
+	instance, err := factory.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.UpdateRequest(values); err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return instance.(*OAuth2).Response
+}
+
+func TestOAuth2Introspection(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if id, secret, _ := r.BasicAuth(); id != "gateway" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		answer := map[string]interface{}{"active": false}
+		switch r.PostFormValue("token") {
+		case "reader":
+			answer = map[string]interface{}{"active": true, "scope": "pets:read", "client_id": "app", "sub": "sally", "exp": time.Now().Add(time.Hour).Unix()}
+		case "expired":
+			answer = map[string]interface{}{"active": true, "exp": time.Now().Add(-time.Second).Unix()}
+		}
+		json.NewEncoder(w).Encode(answer)
+	}))
+	defer server.Close()
+
+	settings := map[string]interface{}{
+		"introspectionURL": server.URL,
+		"clientId":         "gateway",
+		"clientSecret":     "s3cret",
+		"scopes":           "pets:read",
+	}
+	factory := startOAuth2(t, "introspection", settings)
+	defer factory.Close()
+	response := executeOAuth2(t, factory, map[string]interface{}{"token": "Bearer reader"})
+	if !response.Valid || !response.HasScopes || response.Cached || response.Subject != "sally" || response.ClientID != "app" {
+		t.Fatalf("an active token with the scope should be valid but got %+v", response)
+	}
+	if response = executeOAuth2(t, factory, map[string]interface{}{"token": "reader"}); !response.Valid || !response.Cached {
+		t.Fatalf("the answer should be cached but got %+v", response)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("the endpoint should be called once but was called %d times", calls)
+	}
+
+	settings["scopes"] = []interface{}{"pets:read", "pets:write"}
+	if response = executeOAuth2(t, factory, map[string]interface{}{"token": "reader"}); response.Valid || response.HasScopes || !response.Active {
+		t.Fatalf("an active token without the scopes should be invalid but got %+v", response)
+	}
+	for _, token := range []string{"unknown", "expired", ""} {
+		if response = executeOAuth2(t, factory, map[string]interface{}{"token": token}); response.Valid || response.Active {
+			t.Fatalf("token %q should be inactive but got %+v", token, response)
+		}
+	}
+
+	settings["clientSecret"] = "wrong"
+	unauthorized := startOAuth2(t, "unauthorized", settings)
+	defer unauthorized.Close()
+	response = executeOAuth2(t, unauthorized, map[string]interface{}{"token": "reader"})
+	if response.Valid || !response.Error || response.ErrorMessage == "" {
+		t.Fatalf("a failed introspection should be an error but got %+v", response)
+	}
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("grant_type") != "client_credentials" || r.PostFormValue("audience") != "pets" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"token_type":   "bearer",
+			"expires_in":   60,
+			"scope":        r.PostFormValue("scope"),
+		})
+	}))
+	defer server.Close()
+
+	settings := map[string]interface{}{
+		"mode":         "clientCredentials",
+		"tokenURL":     server.URL,
+		"clientId":     "gateway",
+		"clientSecret": "s3cret",
+		"scopes":       "pets:read",
+		"params":       map[string]interface{}{"audience": "pets"},
+	}
+	factory := startOAuth2(t, "credentials", settings)
+	defer factory.Close()
+	response := executeOAuth2(t, factory, nil)
+	if response.Authorization != "Bearer token-1" || response.Scope != "pets:read" || response.ExpiresAt == 0 {
+		t.Fatalf("an access token should be fetched but got %+v", response)
+	}
+	if response = executeOAuth2(t, factory, nil); response.AccessToken != "token-1" || !response.Cached {
+		t.Fatalf("the access token should be cached but got %+v", response)
+	}
+	if response = executeOAuth2(t, factory, map[string]interface{}{"refresh": true}); response.AccessToken != "token-2" {
+		t.Fatalf("a refresh should fetch a new access token but got %+v", response)
+	}
+	// A token that expires within the refresh skew is fetched again.
+	settings["refreshSkew"] = "2m"
+	if response = executeOAuth2(t, factory, nil); response.AccessToken != "token-3" {
+		t.Fatalf("an expiring access token should be fetched again but got %+v", response)
+	}
+	// A restarted factory, like after a reload, does not keep the old token.
+	settings["refreshSkew"] = "0s"
+	factory.Close()
+	if err := factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if response = executeOAuth2(t, factory, nil); response.AccessToken != "token-4" || response.Cached {
+		t.Fatalf("a restarted factory should fetch a new access token but got %+v", response)
+	}
+
+	delete(settings, "params")
+	instance, _ := Initialize(types.Service{Name: "rejected", Type: "oauth2", Settings: settings})
+	if instance.Execute(context.Background()) == nil {
+		t.Fatal("a rejected token request should fail")
+	}
+	if _, err := Initialize(types.Service{Type: "oauth2", Settings: map[string]interface{}{"mode": "password"}}); err == nil {
+		t.Fatal("an unknown mode should be invalid")
+	}
+}
@@ -4,53 +4,140 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"sync"
-
-	"github.com/ulule/limiter/drivers/store/memory"
+	"time"
 
 	"github.com/ulule/limiter"
 )
 
 // NewLimiter creates new limiter with specified limit
-func NewLimiter(limit string) *limiter.Limiter {
+func NewLimiter(limit string, store limiter.Store) (*limiter.Limiter, error) {
 	//create rate
 	rate, err := limiter.NewRateFromFormatted(limit)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("invalid limit: %v", err)
 	}
-	//create store
-	store := memory.NewStore()
 	//create limiter
 	limiter := limiter.New(store, rate)
-	return limiter
+	return limiter, nil
 }
 
-// Limiters is set of rate limiters
+// Limiters is set of rate limiters sharing a store
 type Limiters struct {
+	store    limiter.Store
 	limiters map[string]*limiter.Limiter
+	local    map[string]*localLimiter
 	sync.RWMutex
 }
 
-// Lookup looks up limiter with specified name
-func (l *Limiters) Lookup(name string, limit string) *limiter.Limiter {
+// Lookup looks up limiter with specified limit
+func (l *Limiters) Lookup(limit string) (*limiter.Limiter, error) {
 	l.RLock()
-	limiter := l.limiters[name]
+	limiter := l.limiters[limit]
 	l.RUnlock()
 
 	if limiter != nil {
-		return limiter
+		return limiter, nil
 	}
 
-	limiter = NewLimiter(limit)
+	limiter, err := NewLimiter(limit, l.store)
+	if err != nil {
+		return nil, err
+	}
 	l.Lock()
-	l.limiters[name] = limiter
+	l.limiters[limit] = limiter
 	l.Unlock()
 
-	return limiter
+	return limiter, nil
+}
+
+// lookupLocal looks up the limiter of an algorithm other than the fixed
+// window with specified limit and burst
+func (l *Limiters) lookupLocal(algorithm, limit string, burst int64) (*localLimiter, error) {
+	id := fmt.Sprintf("%s:%s:%d", algorithm, limit, burst)
+	l.Lock()
+	defer l.Unlock()
+	if local, ok := l.local[id]; ok {
+		return local, nil
+	}
+	rate, err := parseRate(algorithm, limit)
+	if err != nil {
+		return nil, err
+	}
+	local := newLocalLimiter(algorithm, rate, burst)
+	l.local[id] = local
+	return local, nil
 }
 
-var limiters = Limiters{
-	limiters: make(map[string]*limiter.Limiter),
+// NewLimiters creates an empty set of rate limiters with a store
+func NewLimiters(store limiter.Store) *Limiters {
+	return &Limiters{
+		store:    store,
+		limiters: make(map[string]*limiter.Limiter),
+		local:    make(map[string]*localLimiter),
+	}
+}
+
+// ValidateRateLimiter checks the settings of a RateLimiter service definition.
+func ValidateRateLimiter(settings map[string]interface{}) error {
+	if _, err := limiterStoreFactory(settings); err != nil {
+		return err
+	}
+	rl := &RateLimiter{}
+	if err := rl.setRequestValues(settings); err != nil {
+		return err
+	}
+	if store, ok := settings["store"]; ok && store != "memory" && rl.Algorithm != AlgorithmFixedWindow {
+		return fmt.Errorf("the %s algorithm only supports the memory store", rl.Algorithm)
+	}
+	return nil
+}
+
+// RateLimiterFactory shares a set of rate limiters between the executions of
+// a RateLimiter service definition.
+type RateLimiterFactory struct {
+	name     string
+	settings map[string]interface{}
+	limiters *Limiters
+}
+
+// NewRateLimiterFactory creates a RateLimiterFactory with provided settings.
+func NewRateLimiterFactory(name string, settings map[string]interface{}) *RateLimiterFactory {
+	return &RateLimiterFactory{
+		name:     name,
+		settings: settings,
+	}
+}
+
+// Start implements Factory.Start
+func (f *RateLimiterFactory) Start() (err error) {
+	if err = ValidateRateLimiter(f.settings); err != nil {
+		return err
+	}
+	store, err := newLimiterStore(f.settings)
+	if err != nil {
+		return err
+	}
+	f.limiters = NewLimiters(store)
+	return nil
+}
+
+// New implements Factory.New
+func (f *RateLimiterFactory) New() (service Service, err error) {
+	rl := &RateLimiter{Name: f.name, limiters: f.limiters}
+	err = rl.setRequestValues(f.settings)
+	return rl, err
+}
+
+// Close implements Factory.Close
+func (f *RateLimiterFactory) Close() (err error) {
+	if f.limiters == nil {
+		return nil
+	}
+	err = closeLimiterStore(f.limiters.store)
+	f.limiters = nil
+	return err
 }
 
 // RateLimiter is a rate limiter service
@@ -65,22 +152,38 @@ var limiters = Limiters{
 // * 5 requests / second : "5-S"
 // * 5 requests / minute : "5-M"
 // * 5 requests / hour : "5-H"
+//
+// The algorithm is a fixed window by default. A token bucket refills burst
+// tokens at the rate of the limit, a sliding window weighs the count of the
+// previous window, a sliding log remembers the time of every request, and a
+// concurrency limit is a plain number of requests in flight, like "5", that
+// are released when their route finishes.
 type RateLimiter struct {
-	Name string
+	Name     string
+	limiters *Limiters
+	release  func()
 
 	// inputs
-	Limit string `json:"limit"`
-	Token string `json:"token"`
+	Limit     string `json:"limit"`
+	Token     string `json:"token"`
+	Algorithm string `json:"algorithm"`
+	Burst     int64  `json:"burst"`
 
 	// outputs
 	LimitReached   bool   `json:"limitReached"`
 	LimitAvailable int64  `json:"limitAvailable"`
+	LimitTotal     int64  `json:"limitTotal"`
+	LimitReset     int64  `json:"limitReset"`
+	RetryAfter     int64  `json:"retryAfter"`
 	Error          bool   `json:"error"`
 	ErrorMessage   string `json:"errorMessage"`
 }
 
 // Execute invokes this service
-func (rl *RateLimiter) Execute() (err error) {
+func (rl *RateLimiter) Execute(ctx context.Context) (err error) {
+	// a retried execution gives back its request in flight first
+	rl.Release()
+
 	// check for request token
 	if rl.Token == "" {
 		rl.Error = true
@@ -89,25 +192,76 @@ func (rl *RateLimiter) Execute() (err error) {
 	}
 
 	limiterID := fmt.Sprintf("%s:%s:%s", rl.Name, rl.Limit, rl.Token)
-	limiter := limiters.Lookup(limiterID, rl.Limit)
-
-	// consume limit
-	limiterContext, err := limiter.Get(context.TODO(), rl.Token)
+	var result limitResult
+	if rl.Algorithm == AlgorithmFixedWindow {
+		result, err = rl.takeFixedWindow(ctx, limiterID)
+	} else {
+		result, err = rl.takeLocal(limiterID)
+	}
 	if err != nil {
+		rl.Error = true
+		rl.ErrorMessage = err.Error()
 		return nil
 	}
 
 	// check the ratelimit
-	rl.LimitAvailable = limiterContext.Remaining
-	if limiterContext.Reached {
-		rl.LimitReached = true
-	} else {
-		rl.LimitReached = false
+	rl.LimitReached = result.reached
+	rl.LimitAvailable = result.remaining
+	rl.LimitTotal = result.limit
+	rl.LimitReset = result.reset.Unix()
+	rl.RetryAfter = 0
+	if result.reached {
+		rl.RetryAfter = int64(math.Ceil(result.retryAfter.Seconds()))
 	}
 
 	return nil
 }
 
+func (rl *RateLimiter) takeFixedWindow(ctx context.Context, limiterID string) (limitResult, error) {
+	limiter, err := rl.limiters.Lookup(rl.Limit)
+	if err != nil {
+		return limitResult{}, err
+	}
+
+	// consume limit
+	limiterContext, err := limiter.Get(ctx, limiterID)
+	if err != nil {
+		return limitResult{}, err
+	}
+	reset := time.Unix(limiterContext.Reset, 0)
+	return limitResult{
+		limit:      limiterContext.Limit,
+		remaining:  limiterContext.Remaining,
+		reached:    limiterContext.Reached,
+		reset:      reset,
+		retryAfter: time.Until(reset),
+	}, nil
+}
+
+func (rl *RateLimiter) takeLocal(limiterID string) (limitResult, error) {
+	local, err := rl.limiters.lookupLocal(rl.Algorithm, rl.Limit, rl.Burst)
+	if err != nil {
+		return limitResult{}, err
+	}
+	result := local.take(limiterID, time.Now())
+	if rl.Algorithm == AlgorithmConcurrency && !result.reached {
+		var once sync.Once
+		rl.release = func() {
+			once.Do(func() { local.release(limiterID) })
+		}
+	}
+	return result, nil
+}
+
+// Release implements Releaser.Release and gives back the request in flight
+// of a concurrency limit.
+func (rl *RateLimiter) Release() {
+	if rl.release != nil {
+		rl.release()
+		rl.release = nil
+	}
+}
+
 // UpdateRequest updates a request on an existing RateLimiter service instance with new values.
 func (rl *RateLimiter) UpdateRequest(values map[string]interface{}) (err error) {
 	err = rl.setRequestValues(values)
@@ -116,14 +270,22 @@ func (rl *RateLimiter) UpdateRequest(values map[string]interface{}) (err error)
 
 // InitializeRateLimiter initializes a RateLimiter services with provided settings.
 func InitializeRateLimiter(name string, settings map[string]interface{}) (rl *RateLimiter, err error) {
+	store, err := newLimiterStore(settings)
+	if err != nil {
+		return nil, err
+	}
 	rl = &RateLimiter{
-		Name: name,
+		Name:     name,
+		limiters: NewLimiters(store),
 	}
 	err = rl.setRequestValues(settings)
 	return
 }
 
 func (rl *RateLimiter) setRequestValues(settings map[string]interface{}) (err error) {
+	if rl.Algorithm == "" {
+		rl.Algorithm = AlgorithmFixedWindow
+	}
 	for k, v := range settings {
 		switch k {
 		case "limit":
@@ -132,6 +294,18 @@ func (rl *RateLimiter) setRequestValues(settings map[string]interface{}) (err er
 				return errors.New("Invalid type for limit")
 			}
 			rl.Limit = limit
+		case "algorithm":
+			algorithm, ok := v.(string)
+			if !ok || !algorithms[algorithm] {
+				return fmt.Errorf("Invalid algorithm: %v", v)
+			}
+			rl.Algorithm = algorithm
+		case "burst":
+			burst, ok := v.(float64)
+			if !ok || burst < 0 {
+				return errors.New("Invalid burst")
+			}
+			rl.Burst = int64(burst)
 		case "token":
 			token, ok := v.(string)
 			if !ok {
@@ -142,5 +316,10 @@ func (rl *RateLimiter) setRequestValues(settings map[string]interface{}) (err er
 			//ignore the seting
 		}
 	}
+	if rl.Limit != "" {
+		if _, err = parseRate(rl.Algorithm, rl.Limit); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ulule/limiter"
+)
+
+// The algorithms of a RateLimiter. Only the fixed window uses the store of
+// the service, the others keep their state in the gateway.
+const (
+	AlgorithmFixedWindow   = "fixedWindow"
+	AlgorithmTokenBucket   = "tokenBucket"
+	AlgorithmSlidingWindow = "slidingWindow"
+	AlgorithmSlidingLog    = "slidingLog"
+	AlgorithmConcurrency   = "concurrency"
+)
+
+var algorithms = map[string]bool{
+	AlgorithmFixedWindow:   true,
+	AlgorithmTokenBucket:   true,
+	AlgorithmSlidingWindow: true,
+	AlgorithmSlidingLog:    true,
+	AlgorithmConcurrency:   true,
+}
+
+// limitResult is the outcome of taking from a limit.
+type limitResult struct {
+	limit      int64
+	remaining  int64
+	reached    bool
+	reset      time.Time
+	retryAfter time.Duration
+}
+
+// parseRate parses the limit of an algorithm. The concurrency limit is a
+// plain number of requests in flight.
+func parseRate(algorithm, limit string) (limiter.Rate, error) {
+	if algorithm == AlgorithmConcurrency {
+		if n, err := strconv.ParseInt(limit, 10, 64); err == nil && n > 0 {
+			return limiter.Rate{Formatted: limit, Limit: n}, nil
+		}
+	}
+	rate, err := limiter.NewRateFromFormatted(limit)
+	if err != nil {
+		return rate, fmt.Errorf("invalid limit: %v", err)
+	}
+	if rate.Limit <= 0 {
+		return rate, fmt.Errorf("invalid limit: %s must allow requests", limit)
+	}
+	return rate, nil
+}
+
+// localLimiter applies an algorithm other than the fixed window to the keys
+// of a RateLimiter service definition.
+type localLimiter struct {
+	algorithm string
+	rate      limiter.Rate
+	burst     int64
+	states    map[string]interface{}
+	swept     time.Time
+	sync.Mutex
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type slidingWindow struct {
+	start    time.Time
+	previous int64
+	current  int64
+}
+
+type slidingLog struct {
+	times []time.Time
+}
+
+type inFlight struct {
+	count int64
+}
+
+func newLocalLimiter(algorithm string, rate limiter.Rate, burst int64) *localLimiter {
+	if burst <= 0 {
+		burst = rate.Limit
+	}
+	return &localLimiter{
+		algorithm: algorithm,
+		rate:      rate,
+		burst:     burst,
+		states:    make(map[string]interface{}),
+		swept:     time.Now(),
+	}
+}
+
+// take takes a request of the key from the limit.
+func (l *localLimiter) take(key string, now time.Time) limitResult {
+	l.Lock()
+	defer l.Unlock()
+	l.sweep(now)
+	state := l.states[key]
+	switch l.algorithm {
+	case AlgorithmTokenBucket:
+		bucket, ok := state.(*tokenBucket)
+		if !ok {
+			bucket = &tokenBucket{tokens: float64(l.burst), last: now}
+			l.states[key] = bucket
+		}
+		return l.takeToken(bucket, now)
+	case AlgorithmSlidingWindow:
+		window, ok := state.(*slidingWindow)
+		if !ok {
+			window = &slidingWindow{start: now.Truncate(l.rate.Period)}
+			l.states[key] = window
+		}
+		return l.takeWindow(window, now)
+	case AlgorithmSlidingLog:
+		history, ok := state.(*slidingLog)
+		if !ok {
+			history = &slidingLog{}
+			l.states[key] = history
+		}
+		return l.takeLog(history, now)
+	}
+	flight, ok := state.(*inFlight)
+	if !ok {
+		flight = &inFlight{}
+		l.states[key] = flight
+	}
+	result := limitResult{limit: l.rate.Limit, reset: now}
+	if flight.count >= l.rate.Limit {
+		// There is no telling when a request finishes, so a second is a hint.
+		result.reached = true
+		result.retryAfter = time.Second
+		return result
+	}
+	flight.count++
+	result.remaining = l.rate.Limit - flight.count
+	return result
+}
+
+// release gives back a request in flight of the key.
+func (l *localLimiter) release(key string) {
+	l.Lock()
+	defer l.Unlock()
+	if flight, ok := l.states[key].(*inFlight); ok && flight.count > 0 {
+		flight.count--
+	}
+}
+
+// perSecond is the rate at which the tokens of a bucket are refilled.
+func (l *localLimiter) perSecond() float64 {
+	return float64(l.rate.Limit) / l.rate.Period.Seconds()
+}
+
+func (l *localLimiter) takeToken(bucket *tokenBucket, now time.Time) limitResult {
+	bucket.tokens = math.Min(float64(l.burst), bucket.tokens+now.Sub(bucket.last).Seconds()*l.perSecond())
+	bucket.last = now
+	result := limitResult{limit: l.burst}
+	if bucket.tokens < 1 {
+		result.reached = true
+		result.retryAfter = seconds((1 - bucket.tokens) / l.perSecond())
+	} else {
+		bucket.tokens--
+	}
+	result.remaining = int64(bucket.tokens)
+	result.reset = now.Add(seconds((float64(l.burst) - bucket.tokens) / l.perSecond()))
+	return result
+}
+
+// takeWindow weighs the count of the previous window by how much of it still
+// overlaps the sliding window.
+func (l *localLimiter) takeWindow(window *slidingWindow, now time.Time) limitResult {
+	period := l.rate.Period
+	if start := now.Truncate(period); !start.Equal(window.start) {
+		window.previous = 0
+		if start.Sub(window.start) == period {
+			window.previous = window.current
+		}
+		window.start, window.current = start, 0
+	}
+	elapsed := now.Sub(window.start)
+	estimate := float64(window.previous)*(1-elapsed.Seconds()/period.Seconds()) + float64(window.current)
+	limit := float64(l.rate.Limit)
+	result := limitResult{limit: l.rate.Limit, reset: window.start.Add(period)}
+	if estimate+1 > limit {
+		result.reached = true
+		result.retryAfter = window.start.Add(period).Sub(now)
+		if window.current+1 <= l.rate.Limit && window.previous > 0 {
+			// The previous window has to slide out until the request fits.
+			fits := period.Seconds() * (1 - (limit-float64(window.current)-1)/float64(window.previous))
+			result.retryAfter = seconds(fits - elapsed.Seconds())
+		}
+		return result
+	}
+	window.current++
+	result.remaining = int64(limit - (estimate + 1))
+	return result
+}
+
+func (l *localLimiter) takeLog(history *slidingLog, now time.Time) limitResult {
+	since := now.Add(-l.rate.Period)
+	kept := history.times[:0]
+	for _, t := range history.times {
+		if t.After(since) {
+			kept = append(kept, t)
+		}
+	}
+	history.times = kept
+	result := limitResult{limit: l.rate.Limit, reset: now.Add(l.rate.Period)}
+	if int64(len(history.times)) >= l.rate.Limit {
+		result.reached = true
+		result.reset = history.times[0].Add(l.rate.Period)
+		result.retryAfter = result.reset.Sub(now)
+		return result
+	}
+	history.times = append(history.times, now)
+	result.remaining = l.rate.Limit - int64(len(history.times))
+	result.reset = history.times[0].Add(l.rate.Period)
+	return result
+}
+
+// sweep forgets the keys that have been idle for a while.
+func (l *localLimiter) sweep(now time.Time) {
+	interval := l.rate.Period * 2
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	if now.Sub(l.swept) < interval {
+		return
+	}
+	l.swept = now
+	for key, state := range l.states {
+		idle := false
+		switch s := state.(type) {
+		case *tokenBucket:
+			idle = s.tokens+now.Sub(s.last).Seconds()*l.perSecond() >= float64(l.burst)
+		case *slidingWindow:
+			idle = now.Sub(s.start) > interval
+		case *slidingLog:
+			idle = len(s.times) == 0 || now.Sub(s.times[len(s.times)-1]) > l.rate.Period
+		case *inFlight:
+			idle = s.count == 0
+		}
+		if idle {
+			delete(l.states, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
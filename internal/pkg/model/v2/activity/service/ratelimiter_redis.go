@@ -0,0 +1,276 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/ulule/limiter"
+	"github.com/ulule/limiter/drivers/store/common"
+)
+
+const (
+	defaultRedisAddress = "localhost:6379"
+	defaultRedisTimeout = 5 * time.Second
+	redisMaxIdle        = 16
+)
+
+// RedisLimiterStore is a limiter.Store that keeps its counters in a server
+// speaking the Redis protocol, so that the replicas of a gateway share them.
+type RedisLimiterStore struct {
+	prefix   string
+	address  string
+	password string
+	db       int
+	timeout  time.Duration
+	idle     chan *redisConn
+}
+
+// NewRedisLimiterStore creates a RedisLimiterStore from the redisAddress,
+// redisPassword, redisDB and redisTimeout settings.
+func NewRedisLimiterStore(settings map[string]interface{}) (limiter.Store, error) {
+	prefix, err := limiterPrefix(settings)
+	if err != nil {
+		return nil, err
+	}
+	store := &RedisLimiterStore{
+		prefix:  prefix,
+		address: defaultRedisAddress,
+		timeout: defaultRedisTimeout,
+		idle:    make(chan *redisConn, redisMaxIdle),
+	}
+	for k, v := range settings {
+		switch k {
+		case "redisAddress", "redisPassword":
+			str, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid type for %s", k)
+			}
+			if k == "redisAddress" {
+				store.address = str
+			} else {
+				store.password = str
+			}
+		case "redisDB":
+			db, ok := v.(float64)
+			if !ok || db < 0 {
+				return nil, errors.New("redisDB must be a database number")
+			}
+			store.db = int(db)
+		case "redisTimeout":
+			str, ok := v.(string)
+			if !ok {
+				return nil, errors.New("invalid type for redisTimeout")
+			}
+			if store.timeout, err = time.ParseDuration(str); err != nil || store.timeout <= 0 {
+				return nil, fmt.Errorf("redisTimeout must be a positive duration but is %s", str)
+			}
+		}
+	}
+	return store, nil
+}
+
+// Get implements limiter.Store.Get
+func (s *RedisLimiterStore) Get(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	return s.update(ctx, key, rate, "INCR")
+}
+
+// Peek implements limiter.Store.Peek
+func (s *RedisLimiterStore) Peek(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	return s.update(ctx, key, rate, "GET")
+}
+
+func (s *RedisLimiterStore) update(ctx context.Context, key string, rate limiter.Rate, command string) (limiter.Context, error) {
+	key = s.prefix + ":" + key
+	period := strconv.FormatInt(int64(rate.Period/time.Millisecond), 10)
+	now := time.Now()
+	commands := [][]string{{command, key}, {"PTTL", key}}
+	if command == "INCR" {
+		// The counter of a new period is created together with its expiry, so
+		// that a counter never outlives its period when a gateway fails.
+		commands = append([][]string{{"SET", key, "0", "PX", period, "NX"}}, commands...)
+	}
+	replies, err := s.do(ctx, commands...)
+	if err != nil {
+		return limiter.Context{}, err
+	}
+	replies = replies[len(replies)-2:]
+	var count int64
+	switch c := replies[0].(type) {
+	case int64:
+		count = c
+	case string:
+		if count, err = strconv.ParseInt(c, 10, 64); err != nil {
+			return limiter.Context{}, fmt.Errorf("invalid counter %s", c)
+		}
+	}
+	ttl, _ := replies[1].(int64)
+	if ttl < 0 {
+		// A missing counter, or one that an older gateway left without an
+		// expiry, starts a new period.
+		ttl = int64(rate.Period / time.Millisecond)
+		if count > 0 {
+			if _, err = s.do(ctx, []string{"PEXPIRE", key, period}); err != nil {
+				return limiter.Context{}, err
+			}
+		}
+	}
+	expiration := now.Add(time.Duration(ttl) * time.Millisecond)
+	return common.GetContextFromState(now, rate, expiration, count), nil
+}
+
+// do sends the commands in a pipeline and returns their replies.
+func (s *RedisLimiterStore) do(ctx context.Context, commands ...[]string) ([]interface{}, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	replies, err := conn.pipeline(commands...)
+	if err != nil {
+		if _, isReply := err.(redisError); !isReply {
+			conn.Close()
+			return nil, err
+		}
+	}
+	select {
+	case s.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return replies, err
+}
+
+func (s *RedisLimiterStore) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	default:
+	}
+	dialer := &net.Dialer{Timeout: s.timeout}
+	c, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: c, reader: bufio.NewReader(c), writer: bufio.NewWriter(c)}
+	conn.SetDeadline(time.Now().Add(s.timeout))
+	var setup [][]string
+	if s.password != "" {
+		setup = append(setup, []string{"AUTH", s.password})
+	}
+	if s.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+	if len(setup) > 0 {
+		if _, err = conn.pipeline(setup...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Close implements io.Closer
+func (s *RedisLimiterStore) Close() error {
+	for {
+		select {
+		case conn := <-s.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// redisError is an error reply.
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// redisConn is a connection speaking the Redis serialization protocol.
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// pipeline writes the commands and reads a reply for each. The first error
+// reply is returned after all replies are read.
+func (c *redisConn) pipeline(commands ...[]string) ([]interface{}, error) {
+	for _, args := range commands {
+		fmt.Fprintf(c.writer, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(c.writer, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(commands))
+	var replyErr error
+	for i := range commands {
+		reply, err := c.read()
+		if e, ok := err.(redisError); ok {
+			if replyErr == nil {
+				replyErr = e
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, replyErr
+}
+
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("invalid reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		array := make([]interface{}, n)
+		for i := range array {
+			if array[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	}
+	return nil, fmt.Errorf("invalid reply %q", line)
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ulule/limiter"
+	"github.com/ulule/limiter/drivers/store/common"
+	"github.com/ulule/limiter/drivers/store/memory"
+)
+
+// LimiterStoreFactory creates a limiter.Store from the settings of a
+// ratelimiter service. A store that is an io.Closer is closed with its
+// service.
+type LimiterStoreFactory func(settings map[string]interface{}) (store limiter.Store, err error)
+
+var limiterStoreFactories = map[string]LimiterStoreFactory{
+	"memory": func(settings map[string]interface{}) (limiter.Store, error) {
+		return memory.NewStore(), nil
+	},
+	"redis": NewRedisLimiterStore,
+	"file":  NewFileLimiterStore,
+}
+
+// RegisterLimiterStore makes a limiter.Store available to the store setting
+// of ratelimiter services.
+func RegisterLimiterStore(name string, factory LimiterStoreFactory) {
+	limiterStoreFactories[name] = factory
+}
+
+func limiterStoreFactory(settings map[string]interface{}) (LimiterStoreFactory, error) {
+	name := "memory"
+	if v, ok := settings["store"]; ok {
+		if name, ok = v.(string); !ok {
+			return nil, errors.New("invalid type for store")
+		}
+	}
+	factory, ok := limiterStoreFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown store %s", name)
+	}
+	return factory, nil
+}
+
+func newLimiterStore(settings map[string]interface{}) (limiter.Store, error) {
+	factory, err := limiterStoreFactory(settings)
+	if err != nil {
+		return nil, err
+	}
+	return factory(settings)
+}
+
+func closeLimiterStore(store limiter.Store) error {
+	if closer, ok := store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// limiterPrefix returns the prefix of the keys a store keeps.
+func limiterPrefix(settings map[string]interface{}) (string, error) {
+	v, ok := settings["prefix"]
+	if !ok {
+		return limiter.DefaultPrefix, nil
+	}
+	prefix, ok := v.(string)
+	if !ok {
+		return "", errors.New("invalid type for prefix")
+	}
+	return prefix, nil
+}
+
+// FileLimiterStore is a limiter.Store that keeps its counters in a file, so
+// that the gateway processes of a host share them. The file is guarded by a
+// lock file that is taken over once it is older than staleLock.
+type FileLimiterStore struct {
+	file      string
+	prefix    string
+	staleLock time.Duration
+	sync.Mutex
+}
+
+type fileLimiterEntry struct {
+	Count   int64 `json:"count"`
+	Expires int64 `json:"expires"`
+}
+
+// NewFileLimiterStore creates a FileLimiterStore for the storeFile setting.
+func NewFileLimiterStore(settings map[string]interface{}) (limiter.Store, error) {
+	file, ok := settings["storeFile"].(string)
+	if !ok || file == "" {
+		return nil, errors.New("the file store needs a storeFile")
+	}
+	prefix, err := limiterPrefix(settings)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLimiterStore{file: file, prefix: prefix, staleLock: 10 * time.Second}, nil
+}
+
+// Get implements limiter.Store.Get
+func (s *FileLimiterStore) Get(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	return s.update(ctx, key, rate, 1)
+}
+
+// Peek implements limiter.Store.Peek
+func (s *FileLimiterStore) Peek(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	return s.update(ctx, key, rate, 0)
+}
+
+func (s *FileLimiterStore) update(ctx context.Context, key string, rate limiter.Rate, increment int64) (limiter.Context, error) {
+	s.Lock()
+	defer s.Unlock()
+	if err := s.lock(ctx); err != nil {
+		return limiter.Context{}, err
+	}
+	defer os.Remove(s.file + ".lock")
+
+	entries := make(map[string]fileLimiterEntry)
+	data, err := ioutil.ReadFile(s.file)
+	if err != nil && !os.IsNotExist(err) {
+		return limiter.Context{}, err
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &entries); err != nil {
+			return limiter.Context{}, fmt.Errorf("invalid store file %s: %v", s.file, err)
+		}
+	}
+	now := time.Now()
+	for k, entry := range entries {
+		if entry.Expires <= now.UnixNano() {
+			delete(entries, k)
+		}
+	}
+	key = s.prefix + ":" + key
+	entry, ok := entries[key]
+	if !ok {
+		entry.Expires = now.Add(rate.Period).UnixNano()
+	}
+	if increment > 0 {
+		entry.Count += increment
+		entries[key] = entry
+		if data, err = json.Marshal(entries); err != nil {
+			return limiter.Context{}, err
+		}
+		tmp := s.file + ".tmp"
+		if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+			return limiter.Context{}, err
+		}
+		if err = os.Rename(tmp, s.file); err != nil {
+			return limiter.Context{}, err
+		}
+	}
+	return common.GetContextFromState(now, rate, time.Unix(0, entry.Expires), entry.Count), nil
+}
+
+// lock creates the lock file, waiting for another process to remove it.
+func (s *FileLimiterStore) lock(ctx context.Context) error {
+	path := s.file + ".lock"
+	deadline := time.Now().Add(s.staleLock)
+	for {
+		lock, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			return lock.Close()
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > s.staleLock {
+			// The process holding the lock is gone.
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("unable to lock %s", s.file)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+)
+
+// fakeRedis is an in-process stand-in for the commands of a Redis server
+// used by the RedisLimiterStore.
+type fakeRedis struct {
+	listener net.Listener
+	values   map[string]int64
+	expires  map[string]time.Time
+	sync.Mutex
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{listener: listener, values: make(map[string]int64), expires: make(map[string]time.Time)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			reader.ReadString('\n')
+			arg, _ := reader.ReadString('\n')
+			args[i] = strings.TrimSpace(arg)
+		}
+		fmt.Fprint(conn, r.execute(args))
+	}
+}
+
+func (r *fakeRedis) execute(args []string) string {
+	r.Lock()
+	defer r.Unlock()
+	key := ""
+	if len(args) > 1 {
+		key = args[1]
+		if expires, ok := r.expires[key]; ok && time.Now().After(expires) {
+			delete(r.values, key)
+			delete(r.expires, key)
+		}
+	}
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		if args[1] != "s3cret" {
+			return "-ERR invalid password\r\n"
+		}
+		return "+OK\r\n"
+	case "SET":
+		if _, ok := r.values[key]; ok {
+			return "$-1\r\n"
+		}
+		r.values[key], _ = strconv.ParseInt(args[2], 10, 64)
+		ms, _ := strconv.Atoi(args[4])
+		r.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return "+OK\r\n"
+	case "INCR":
+		r.values[key]++
+		return fmt.Sprintf(":%d\r\n", r.values[key])
+	case "GET":
+		value, ok := r.values[key]
+		if !ok {
+			return "$-1\r\n"
+		}
+		s := strconv.FormatInt(value, 10)
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+	case "PEXPIRE":
+		ms, _ := strconv.Atoi(args[2])
+		r.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return ":1\r\n"
+	case "PTTL":
+		if _, ok := r.values[key]; !ok {
+			return ":-2\r\n"
+		}
+		expires, ok := r.expires[key]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", time.Until(expires)/time.Millisecond)
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func executeRateLimiter(t *testing.T, factory Factory, token string) *RateLimiter {
+	instance, err := factory.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.UpdateRequest(map[string]interface{}{"token": token}); err != nil {
+		t.Fatal(err)
+	}
+	if err = instance.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return instance.(*RateLimiter)
+}
+
+func TestRateLimiterStores(t *testing.T) {
+	redis := newFakeRedis(t)
+	defer redis.listener.Close()
+	dir, err := ioutil.TempDir("", "ratelimiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		settings map[string]interface{}
+		shared   bool
+	}{
+		{map[string]interface{}{}, false},
+		{map[string]interface{}{"store": "memory"}, false},
+		{map[string]interface{}{"store": "file", "storeFile": filepath.Join(dir, "limits.json")}, true},
+		{map[string]interface{}{"store": "redis", "redisAddress": redis.listener.Addr().String(), "redisPassword": "s3cret"}, true},
+	} {
+		test.settings["limit"] = "2-M"
+		// Two factories stand in for two replicas of a gateway.
+		var replicas []Factory
+		for i := 0; i < 2; i++ {
+			factory := NewFactory(types.Service{Name: "limited", Type: "ratelimiter", Settings: test.settings})
+			if err = factory.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer factory.Close()
+			replicas = append(replicas, factory)
+		}
+		first := executeRateLimiter(t, replicas[0], "sally")
+		second := executeRateLimiter(t, replicas[1], "sally")
+		if first.Error || second.Error {
+			t.Fatalf("store %v should work but got %+v and %+v", test.settings["store"], first, second)
+		}
+		if first.LimitAvailable != 1 {
+			t.Fatalf("store %v should have 1 call available but got %d", test.settings["store"], first.LimitAvailable)
+		}
+		if shared := second.LimitAvailable == 0; shared != test.shared {
+			t.Fatalf("store %v should share the limit %v but has %d calls available", test.settings["store"], test.shared, second.LimitAvailable)
+		}
+		third := executeRateLimiter(t, replicas[0], "sally")
+		if third.LimitReached != test.shared {
+			t.Fatalf("store %v should reach the limit %v on the third call", test.settings["store"], test.shared)
+		}
+		if executeRateLimiter(t, replicas[0], "bob").LimitReached {
+			t.Fatalf("store %v should limit every token on its own", test.settings["store"])
+		}
+	}
+	redis.Lock()
+	for key := range redis.values {
+		if _, ok := redis.expires[key]; !ok {
+			t.Fatalf("counter %s should expire", key)
+		}
+	}
+	redis.Unlock()
+
+	factory := NewFactory(types.Service{Name: "unauthorized", Type: "ratelimiter", Settings: map[string]interface{}{
+		"limit":         "2-M",
+		"store":         "redis",
+		"redisAddress":  redis.listener.Addr().String(),
+		"redisPassword": "wrong",
+	}})
+	if err = factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer factory.Close()
+	if rl := executeRateLimiter(t, factory, "sally"); !rl.Error || rl.LimitReached {
+		t.Fatalf("a failing store should be an error but got %+v", rl)
+	}
+}
+
+func TestRateLimiterValidation(t *testing.T) {
+	for _, settings := range []map[string]interface{}{
+		{"limit": "2-X"},
+		{"limit": "many-M"},
+		{"limit": "2-M", "store": "cassandra"},
+		{"limit": "2-M", "store": "file"},
+		{"limit": "2-M", "store": "redis", "redisDB": "one"},
+		{"limit": "2-M", "algorithm": "leakyBucket"},
+		{"limit": "2-M", "algorithm": "tokenBucket", "burst": float64(-1)},
+		{"limit": "2-M", "algorithm": "slidingLog", "store": "redis"},
+		{"limit": "2", "algorithm": "slidingWindow"},
+	} {
+		if NewFactory(types.Service{Name: "invalid", Type: "ratelimiter", Settings: settings}).Start() == nil {
+			t.Fatalf("settings %v should be invalid", settings)
+		}
+	}
+	if err := ValidateRateLimiter(map[string]interface{}{"limit": "2-X"}); err == nil {
+		t.Fatal("an invalid limit should not validate")
+	}
+	if err := ValidateRateLimiter(map[string]interface{}{"limit": "2", "algorithm": "concurrency"}); err != nil {
+		t.Fatalf("a concurrency limit should validate but got %v", err)
+	}
+
+	factory := NewFactory(types.Service{Name: "valid", Type: "ratelimiter", Settings: map[string]interface{}{"limit": "2-M"}})
+	if err := factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer factory.Close()
+	instance, _ := factory.New()
+	if instance.UpdateRequest(map[string]interface{}{"limit": "2-X"}) == nil {
+		t.Fatal("an invalid limit input should be an error")
+	}
+}
+
+func TestRateLimiterAlgorithms(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	take := func(l *localLimiter, at time.Duration) limitResult {
+		return l.take("sally", now.Add(at))
+	}
+
+	rate, _ := parseRate(AlgorithmTokenBucket, "1-S")
+	bucket := newLocalLimiter(AlgorithmTokenBucket, rate, 3)
+	for i := 0; i < 3; i++ {
+		if result := take(bucket, 0); result.reached || result.remaining != int64(2-i) {
+			t.Fatalf("the burst should allow request %d but got %+v", i, result)
+		}
+	}
+	if result := take(bucket, 0); !result.reached || result.retryAfter != time.Second || result.limit != 3 {
+		t.Fatalf("an empty bucket should be retried after a second but got %+v", result)
+	}
+	if result := take(bucket, 1500*time.Millisecond); result.reached {
+		t.Fatalf("a refilled token should be taken but got %+v", result)
+	}
+	if result := take(bucket, 1500*time.Millisecond); !result.reached || result.retryAfter != 500*time.Millisecond {
+		t.Fatalf("half a token should be retried after half a second but got %+v", result)
+	}
+
+	rate, _ = parseRate(AlgorithmSlidingWindow, "4-M")
+	window := newLocalLimiter(AlgorithmSlidingWindow, rate, 0)
+	for i := 0; i < 4; i++ {
+		take(window, 30*time.Second)
+	}
+	if result := take(window, 45*time.Second); !result.reached || !result.reset.Equal(now.Add(time.Minute)) {
+		t.Fatalf("a full window should be reached but got %+v", result)
+	}
+	// A quarter into the next window three quarters of the previous count
+	// still weigh in.
+	if result := take(window, 75*time.Second); result.reached || result.remaining != 0 {
+		t.Fatalf("a quarter of the previous window should have slid out but got %+v", result)
+	}
+	if result := take(window, 75*time.Second); !result.reached || result.retryAfter != 15*time.Second {
+		t.Fatalf("the previous window should slide out but got %+v", result)
+	}
+	if result := take(window, 90*time.Second); result.reached || result.remaining != 0 {
+		t.Fatalf("half the previous window should leave room for a request but got %+v", result)
+	}
+
+	rate, _ = parseRate(AlgorithmSlidingLog, "2-M")
+	history := newLocalLimiter(AlgorithmSlidingLog, rate, 0)
+	take(history, 0)
+	take(history, 20*time.Second)
+	if result := take(history, 40*time.Second); !result.reached || result.retryAfter != 20*time.Second || !result.reset.Equal(now.Add(time.Minute)) {
+		t.Fatalf("a full log should reset when its first request expires but got %+v", result)
+	}
+	if result := take(history, 61*time.Second); result.reached || result.remaining != 0 {
+		t.Fatalf("an expired request should leave the log but got %+v", result)
+	}
+
+	rate, _ = parseRate(AlgorithmConcurrency, "2")
+	flight := newLocalLimiter(AlgorithmConcurrency, rate, 0)
+	take(flight, 0)
+	take(flight, 0)
+	if result := take(flight, 0); !result.reached || result.retryAfter <= 0 {
+		t.Fatalf("the requests in flight should reach the limit but got %+v", result)
+	}
+	flight.release("sally")
+	if result := take(flight, 0); result.reached {
+		t.Fatalf("a released request should leave room but got %+v", result)
+	}
+}
+
+func TestRateLimiterOutputs(t *testing.T) {
+	for _, test := range []struct {
+		settings map[string]interface{}
+		limit    int64
+	}{
+		{map[string]interface{}{"limit": "2-M"}, 2},
+		{map[string]interface{}{"limit": "2-M", "algorithm": "tokenBucket", "burst": float64(3)}, 3},
+		{map[string]interface{}{"limit": "2-M", "algorithm": "slidingWindow"}, 2},
+		{map[string]interface{}{"limit": "2-M", "algorithm": "slidingLog"}, 2},
+	} {
+		factory := NewFactory(types.Service{Name: "limited", Type: "ratelimiter", Settings: test.settings})
+		if err := factory.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer factory.Close()
+		var rl *RateLimiter
+		for i := int64(0); i <= test.limit; i++ {
+			rl = executeRateLimiter(t, factory, "sally")
+		}
+		if !rl.LimitReached || rl.LimitTotal != test.limit || rl.LimitAvailable != 0 {
+			t.Fatalf("algorithm %v should reach a limit of %d but got %+v", test.settings["algorithm"], test.limit, rl)
+		}
+		if rl.RetryAfter < 1 || rl.LimitReset < time.Now().Unix() {
+			t.Fatalf("algorithm %v should tell when to retry but got %+v", test.settings["algorithm"], rl)
+		}
+	}
+
+	factory := NewFactory(types.Service{Name: "concurrent", Type: "ratelimiter", Settings: map[string]interface{}{
+		"limit":     "1",
+		"algorithm": "concurrency",
+	}})
+	if err := factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer factory.Close()
+	first := executeRateLimiter(t, factory, "sally")
+	if first.LimitReached || !executeRateLimiter(t, factory, "sally").LimitReached {
+		t.Fatal("a second request in flight should reach the limit")
+	}
+	first.Release()
+	first.Release()
+	if executeRateLimiter(t, factory, "sally").LimitReached {
+		t.Fatal("a released request should leave room")
+	}
+	if !executeRateLimiter(t, factory, "sally").LimitReached {
+		t.Fatal("a request should only be released once")
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	defaultHTTPFailureStatusCodes = []int{500, 502, 503, 504}
+	defaultGRPCFailureStatusCodes = []int{int(codes.Internal), int(codes.ResourceExhausted)}
+)
+
+// CircuitOpenError is the error of a call to an upstream that failed fast
+// because the circuit breaker of the upstream is open.
+type CircuitOpenError struct {
+	Service  string
+	Upstream string
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker of service %s for upstream %s is open", e.Service, e.Upstream)
+}
+
+// upstreamStatus is the status code of an HTTP response, which is a failure
+// of the upstream if it is one of the failure status codes.
+type upstreamStatus int
+
+func (s upstreamStatus) Error() string {
+	return fmt.Sprintf("status code %d", int(s))
+}
+
+// Resilience breaks the circuit to each upstream of an http or grpc service
+// definition on its own, as configured by its resilience setting. The circuit
+// breakers of the upstreams are circuit breaker contexts named
+// <service>:<upstream> with the contiguous errors mode.
+type Resilience struct {
+	name        string
+	policy      breakerPolicy
+	statusCodes map[int]bool
+	network     bool
+	stateFile   string
+}
+
+// NewResilience creates the Resilience of a service definition from its
+// resilience setting, or nil if there is none.
+func NewResilience(name, serviceType string, settings map[string]interface{}) (r *Resilience, err error) {
+	v, ok := settings["resilience"]
+	if !ok {
+		return nil, nil
+	}
+	values, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid type for resilience")
+	}
+	r = &Resilience{
+		name: name,
+		policy: breakerPolicy{
+			mode:             CircuitBreakerModeA,
+			threshold:        5,
+			halfOpenRequests: 1,
+			timeout:          60 * time.Second,
+		},
+		statusCodes: make(map[int]bool),
+		network:     true,
+	}
+	statusCodes := defaultHTTPFailureStatusCodes
+	if serviceType == "grpc" {
+		statusCodes = defaultGRPCFailureStatusCodes
+	}
+	ints := map[string]*int{
+		"threshold":        &r.policy.threshold,
+		"halfOpenRequests": &r.policy.halfOpenRequests,
+	}
+	for k, v := range values {
+		switch k {
+		case "threshold", "halfOpenRequests":
+			n, ok := v.(float64)
+			if !ok || n < 1 {
+				return nil, fmt.Errorf("resilience %s must be a positive number", k)
+			}
+			*ints[k] = int(n)
+		case "timeout":
+			str, ok := v.(string)
+			if !ok {
+				return nil, errors.New("invalid type for resilience timeout")
+			}
+			if r.policy.timeout, err = time.ParseDuration(str); err != nil || r.policy.timeout <= 0 {
+				return nil, fmt.Errorf("resilience timeout must be a positive duration but is %s", str)
+			}
+		case "failureStatusCodes":
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, errors.New("resilience failureStatusCodes must be an array of status codes")
+			}
+			statusCodes = nil
+			for _, code := range list {
+				n, ok := code.(float64)
+				if !ok {
+					return nil, fmt.Errorf("invalid resilience status code %v", code)
+				}
+				statusCodes = append(statusCodes, int(n))
+			}
+		case "networkErrors":
+			if r.network, ok = v.(bool); !ok {
+				return nil, errors.New("invalid type for resilience networkErrors")
+			}
+		case "stateFile":
+			if r.stateFile, ok = v.(string); !ok {
+				return nil, errors.New("invalid type for resilience stateFile")
+			}
+		default:
+			return nil, fmt.Errorf("unknown resilience setting %s", k)
+		}
+	}
+	for _, code := range statusCodes {
+		r.statusCodes[code] = true
+	}
+	return r, nil
+}
+
+// ValidateResilience checks the resilience setting of an http or grpc service
+// definition.
+func ValidateResilience(serviceType string, settings map[string]interface{}) error {
+	_, err := NewResilience("", serviceType, settings)
+	return err
+}
+
+// Allow returns a CircuitOpenError when the circuit breaker of the upstream
+// is open, or a function that reports the error of the call to the upstream.
+func (r *Resilience) Allow(upstream string) (done func(err error), err error) {
+	at := now()
+	breaker := circuitBreakerContexts.lookup(r.name+":"+upstream, r.policy.threshold, r.policy.mode, r.stateFile, at)
+	if !breaker.allow(at, r.policy) {
+		return nil, &CircuitOpenError{Service: r.name, Upstream: upstream}
+	}
+	return func(err error) {
+		failure, counted := r.failure(err)
+		switch {
+		case !counted:
+		case failure:
+			breaker.failure(now(), r.policy)
+		default:
+			breaker.success(now(), r.policy)
+		}
+	}, nil
+}
+
+// failure reports whether the error of a call is a failure of the upstream,
+// and whether it counts at all. A call cancelled by the gateway says nothing
+// about the upstream.
+func (r *Resilience) failure(err error) (failure, counted bool) {
+	if err == nil {
+		return false, true
+	}
+	if err == context.Canceled {
+		return false, false
+	}
+	if code, ok := err.(upstreamStatus); ok {
+		return r.statusCodes[int(code)], true
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Canceled:
+			return false, false
+		case codes.Unavailable, codes.DeadlineExceeded:
+			return r.network, r.network
+		}
+		return r.statusCodes[int(s.Code())], true
+	}
+	if _, ok := err.(net.Error); ok || err == context.DeadlineExceeded {
+		return r.network, r.network
+	}
+	// Any other error is an error of the gateway.
+	return false, false
+}
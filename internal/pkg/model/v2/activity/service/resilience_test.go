@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	g "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service/grpc"
+	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
+	pb "github.com/TIBCOSoftware/mashling/test/gen/grpc/petstore"
+)
+
+func TestResilienceHTTP(t *testing.T) {
+	clock := time.Now()
+	now = func() time.Time {
+		return clock
+	}
+	defer func() {
+		now = time.Now
+	}()
+
+	var calls, code int32 = 0, http.StatusServiceUnavailable
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&code)))
+	}))
+	defer backend.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	factory := NewFactory(types.Service{Name: "resilientHTTP", Type: "http", Settings: map[string]interface{}{
+		"url":    backend.URL,
+		"method": "GET",
+		"resilience": map[string]interface{}{
+			"threshold": 2.0,
+			"timeout":   "30s",
+		},
+	}})
+	if err := factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer factory.Close()
+	execute := func(values map[string]interface{}) error {
+		instance, err := factory.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = instance.UpdateRequest(values); err != nil {
+			t.Fatal(err)
+		}
+		return instance.Execute(context.Background())
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := execute(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := execute(nil)
+	if openErr, ok := err.(*CircuitOpenError); !ok || openErr.Upstream != backend.Listener.Addr().String() {
+		t.Fatalf("the circuit of the upstream should be open but got %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("an open circuit should fail fast but the upstream was called %d times", calls)
+	}
+	if err = execute(map[string]interface{}{"url": other.URL}); err != nil {
+		t.Fatalf("the circuit of another upstream should be closed but got %v", err)
+	}
+
+	// A probe is let through after the timeout, and closes the circuit.
+	clock = clock.Add(30 * time.Second)
+	atomic.StoreInt32(&code, http.StatusNotFound)
+	if err = execute(nil); err != nil {
+		t.Fatalf("a probe should be let through but got %v", err)
+	}
+	statuses := circuitBreakerContexts.Statuses("resilientHTTP:" + backend.Listener.Addr().String())
+	if len(statuses) != 1 || statuses[0].State != CircuitBreakerClosed {
+		t.Fatalf("a status code that is not a failure should close the circuit but it is %+v", statuses)
+	}
+}
+
+func TestResilienceNetworkErrors(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := backend.URL
+	backend.Close()
+
+	for _, networkErrors := range []bool{true, false} {
+		factory := NewFactory(types.Service{Name: "network" + strconv.FormatBool(networkErrors), Type: "http", Settings: map[string]interface{}{
+			"url":      url,
+			"method":   "GET",
+			"netError": true,
+			"resilience": map[string]interface{}{
+				"threshold":     1.0,
+				"networkErrors": networkErrors,
+			},
+		}})
+		if err := factory.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer factory.Close()
+		for i := 0; i < 2; i++ {
+			instance, _ := factory.New()
+			err := instance.Execute(context.Background())
+			if _, open := err.(*CircuitOpenError); open != (networkErrors && i == 1) {
+				t.Fatalf("call %d with networkErrors %v should open the circuit %v but got %v", i, networkErrors, networkErrors && i == 1, err)
+			}
+		}
+	}
+}
+
+func TestResilienceGRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	factory := NewFactory(types.Service{Name: "resilientGRPC", Type: "grpc", Settings: map[string]interface{}{
+		"hosturl":    address,
+		"resilience": map[string]interface{}{"threshold": 1.0},
+	}})
+	if err = factory.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer factory.Close()
+	execute := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		instance, _ := factory.New()
+		err := instance.UpdateRequest(map[string]interface{}{
+			"grpcMthdParamtrs": map[string]interface{}{
+				"methodName":  "PetById",
+				"contextdata": ctx,
+				"reqdata":     &pb.PetByIdRequest{Id: 2},
+				"serviceName": "PetStoreService",
+				"protoName":   "petstore",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := instance.(*g.GRPC); !ok {
+			t.Fatal("should be a grpc service")
+		}
+		return instance.Execute(ctx)
+	}
+	if err = execute(); err != nil {
+		t.Fatal(err)
+	}
+	if err = execute(); err == nil {
+		t.Fatal("an unavailable upstream should open the circuit")
+	} else if _, ok := err.(*CircuitOpenError); !ok {
+		t.Fatalf("the circuit should be open but got %v", err)
+	}
+}
+
+func TestResilienceValidation(t *testing.T) {
+	for _, resilience := range []interface{}{
+		"on",
+		map[string]interface{}{"threshold": 0.0},
+		map[string]interface{}{"timeout": "soon"},
+		map[string]interface{}{"failureStatusCodes": []interface{}{"5xx"}},
+		map[string]interface{}{"networkErrors": "yes"},
+		map[string]interface{}{"retries": 3.0},
+	} {
+		settings := map[string]interface{}{"url": "http://localhost", "resilience": resilience}
+		if ValidateResilience("http", settings) == nil {
+			t.Fatalf("resilience %v should be invalid", resilience)
+		}
+		if NewFactory(types.Service{Name: "invalid", Type: "http", Settings: settings}).Start() == nil {
+			t.Fatalf("resilience %v should not start", resilience)
+		}
+	}
+	if err := ValidateResilience("grpc", map[string]interface{}{"resilience": map[string]interface{}{"failureStatusCodes": []interface{}{13.0}}}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	// EnvJSTimeout overrides the default time limit of a JavaScript evaluation.
+	EnvJSTimeout = "MASHLING_JS_TIMEOUT"
+	// EnvJSMaxMemory overrides the default memory limit of a JavaScript evaluation in bytes.
+	EnvJSMaxMemory = "MASHLING_JS_MAX_MEMORY"
+	// memorySampleInterval is how often the heap is sampled while a
+	// JavaScript evaluation with a memory limit runs.
+	memorySampleInterval = 10 * time.Millisecond
+)
+
+// Limits bound a JavaScript evaluation. A zero limit is unbounded.
+type Limits struct {
+	// Timeout is the time an evaluation may run for.
+	Timeout time.Duration
+	// MaxMemory is the number of bytes the heap may grow by while an
+	// evaluation runs. It also bounds runaway recursion, which goja keeps on
+	// the heap rather than on the Go stack. The heap is shared by all
+	// evaluations and sampled every memorySampleInterval, so the limit is
+	// approximate and the allocations of one evaluation can fail another.
+	MaxMemory uint64
+}
+
+// DefaultLimits are the limits of conditions and of js services that do not
+// configure their own.
+var DefaultLimits = defaultLimits()
+
+func defaultLimits() Limits {
+	limits := Limits{Timeout: time.Second}
+	if value, ok := os.LookupEnv(EnvJSTimeout); ok {
+		if timeout, err := time.ParseDuration(value); err == nil {
+			limits.Timeout = timeout
+		}
+	}
+	if value, ok := os.LookupEnv(EnvJSMaxMemory); ok {
+		if maxMemory, err := strconv.ParseUint(value, 10, 64); err == nil {
+			limits.MaxMemory = maxMemory
+		}
+	}
+	return limits
+}
+
+// TimeoutError is the error of a JavaScript evaluation that exceeded its time limit.
+type TimeoutError struct {
+	Limit time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("javascript evaluation exceeded time limit of %s", e.Limit)
+}
+
+// MemoryError is the error of a JavaScript evaluation that exceeded its memory limit.
+type MemoryError struct {
+	Limit uint64
+}
+
+func (e *MemoryError) Error() string {
+	return fmt.Sprintf("javascript evaluation exceeded memory limit of %d bytes", e.Limit)
+}
+
+// sandbox disables the globals that compile code at runtime, so that only the
+// scripts of the configuration can run.
+func sandbox(vm *goja.Runtime) {
+	vm.Set("eval", goja.Undefined())
+	if function, ok := vm.Get("Function").(*goja.Object); ok {
+		if prototype, ok := function.Get("prototype").(*goja.Object); ok {
+			prototype.Set("constructor", goja.Undefined())
+		}
+	}
+	vm.Set("Function", goja.Undefined())
+}
+
+// guard runs a script within the limits of the VM, interrupting it when a
+// limit is exceeded or ctx is done.
+func (vm *VM) guard(ctx context.Context, run func() (goja.Value, error)) (goja.Value, error) {
+	limits := vm.limits
+	if limits.Timeout <= 0 && limits.MaxMemory == 0 && ctx.Done() == nil {
+		return run()
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	interrupted := false
+	go func() {
+		defer close(stopped)
+		var timeout <-chan time.Time
+		if limits.Timeout > 0 {
+			timer := time.NewTimer(limits.Timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		var baseline uint64
+		var heaps <-chan uint64
+		if limits.MaxMemory > 0 {
+			var stop func()
+			heaps, baseline, stop = heapSampler.watch()
+			defer stop()
+		}
+		for {
+			var reason interface{}
+			select {
+			case <-done:
+				return
+			case <-timeout:
+				reason = &TimeoutError{Limit: limits.Timeout}
+			case <-ctx.Done():
+				reason = ctx.Err()
+			case heap := <-heaps:
+				if heap <= baseline || heap-baseline <= limits.MaxMemory {
+					continue
+				}
+				reason = &MemoryError{Limit: limits.MaxMemory}
+			}
+			vm.vm.Interrupt(reason)
+			interrupted = true
+			return
+		}
+	}()
+	value, err := run()
+	close(done)
+	<-stopped
+	if intErr, ok := err.(*goja.InterruptedError); ok {
+		if reason, ok := intErr.Value().(error); ok {
+			return nil, reason
+		}
+		return nil, err
+	}
+	if interrupted {
+		// The script finished before it noticed the interrupt, which would
+		// otherwise stop the next script run in this VM.
+		vm.vm.RunString("")
+	}
+	return value, err
+}
+
+// heapSampler samples the heap for every evaluation with a memory limit.
+var heapSampler = &sampler{watchers: make(map[chan uint64]bool)}
+
+// sampler samples the heap from a single ticker while there are watchers,
+// because reading the memory statistics stops the world.
+type sampler struct {
+	watchers map[chan uint64]bool
+	heap     uint64
+	done     chan struct{}
+	sync.Mutex
+}
+
+// watch returns a channel of heap samples along with the current heap, and
+// a function that stops the watch.
+func (s *sampler) watch() (heaps <-chan uint64, heap uint64, stop func()) {
+	ch := make(chan uint64, 1)
+	s.Lock()
+	if s.done == nil {
+		s.heap = heapAlloc()
+		s.done = make(chan struct{})
+		go s.run(s.done)
+	}
+	s.watchers[ch] = true
+	heap = s.heap
+	s.Unlock()
+	return ch, heap, func() {
+		s.Lock()
+		defer s.Unlock()
+		delete(s.watchers, ch)
+		if len(s.watchers) == 0 && s.done != nil {
+			close(s.done)
+			s.done = nil
+		}
+	}
+}
+
+func (s *sampler) run(done chan struct{}) {
+	ticker := time.NewTicker(memorySampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		heap := heapAlloc()
+		s.Lock()
+		s.heap = heap
+		for ch := range s.watchers {
+			// A watcher that is behind skips the sample.
+			select {
+			case ch <- heap:
+			default:
+			}
+		}
+		s.Unlock()
+	}
+}
+
+func heapAlloc() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
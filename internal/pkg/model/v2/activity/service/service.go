@@ -1,20 +1,125 @@
 package service
 
 import (
+	"context"
 	"errors"
 
+	"github.com/TIBCOSoftware/flogo-lib/logger"
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service/grpc"
 
 	wsproxy "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service/wsproxy"
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
 )
 
+// log is the default package logger
+var log = logger.GetLogger("service")
+
 // Service encapsulates everything necessary to execute a step against a target.
+// Execute stops early once its context is done.
 type Service interface {
-	Execute() (err error)
+	Execute(ctx context.Context) (err error)
 	UpdateRequest(values map[string]interface{}) (err error)
 }
 
+// Releaser is a Service that holds a resource, like a request in flight of a
+// concurrency limit, until the route that executed it finishes.
+type Releaser interface {
+	Release()
+}
+
+// Factory is a long lived service created once per gateway. It holds the
+// resources shared by every execution of a service definition and produces
+// cheap per-request Service instances.
+type Factory interface {
+	// Start acquires the resources shared by the service executions.
+	Start() (err error)
+	// New creates a Service for a single execution.
+	New() (service Service, err error)
+	// Close releases the resources acquired by Start.
+	Close() (err error)
+}
+
+// NewFactory sets up the Factory based off of the service definition.
+func NewFactory(serviceDef types.Service) (factory Factory) {
+	switch sType := serviceDef.Type; sType {
+	case "http":
+		return NewHTTPFactory(serviceDef.Name, serviceDef.Settings)
+	case "grpc":
+		return grpcFactory{grpc.NewGRPCFactory(serviceDef.Settings), serviceDef.Name, serviceDef.Settings}
+	case "ws":
+		return wsProxyFactory{wsproxy.NewWSProxyFactory(serviceDef.Name, serviceDef.Settings)}
+	case "ratelimiter":
+		return NewRateLimiterFactory(serviceDef.Name, serviceDef.Settings)
+	case "cache":
+		return NewCacheFactory(serviceDef.Name, serviceDef.Settings)
+	case "apikey":
+		return NewAPIKeyFactory(serviceDef.Name, serviceDef.Settings)
+	case "jwt":
+		return NewJWTFactory(serviceDef.Settings)
+	case "jwtIssuer":
+		return NewJWTIssuerFactory(serviceDef.Settings)
+	case "oauth2":
+		return NewOAuth2Factory(serviceDef.Name, serviceDef.Settings)
+	default:
+		return &InitializeFactory{definition: serviceDef}
+	}
+}
+
+// InitializeFactory is a Factory for services without shared resources. Each
+// execution is initialized from the service definition.
+type InitializeFactory struct {
+	definition types.Service
+}
+
+// Start implements Factory.Start
+func (f *InitializeFactory) Start() (err error) {
+	return nil
+}
+
+// New implements Factory.New
+func (f *InitializeFactory) New() (service Service, err error) {
+	return Initialize(f.definition)
+}
+
+// Close implements Factory.Close
+func (f *InitializeFactory) Close() (err error) {
+	return nil
+}
+
+// grpcFactory adapts a grpc.GRPCFactory to Factory.
+type grpcFactory struct {
+	*grpc.GRPCFactory
+	name     string
+	settings map[string]interface{}
+}
+
+// Start implements Factory.Start
+func (f grpcFactory) Start() (err error) {
+	resilience, err := NewResilience(f.name, "grpc", f.settings)
+	if err != nil {
+		return err
+	}
+	if resilience != nil {
+		f.Breaker = resilience
+	}
+	return f.GRPCFactory.Start()
+}
+
+// New implements Factory.New
+func (f grpcFactory) New() (service Service, err error) {
+	return f.GRPCFactory.New()
+}
+
+// wsProxyFactory adapts a wsproxy.WSProxyFactory to Factory.
+type wsProxyFactory struct {
+	*wsproxy.WSProxyFactory
+}
+
+// New implements Factory.New
+func (f wsProxyFactory) New() (service Service, err error) {
+	return f.WSProxyFactory.New()
+}
+
 // Initialize sets up the service based off of the service definition.
 func Initialize(serviceDef types.Service) (service Service, err error) {
 	switch sType := serviceDef.Type; sType {
@@ -36,10 +141,18 @@ func Initialize(serviceDef types.Service) (service Service, err error) {
 		return InitializeAnomaly(serviceDef.Settings)
 	case "jwt":
 		return InitializeJWT(serviceDef.Settings)
+	case "jwtIssuer":
+		return InitializeJWTIssuer(serviceDef.Settings)
+	case "oauth2":
+		return InitializeOAuth2(serviceDef.Name, serviceDef.Settings)
 	case "ws":
 		return wsproxy.InitializeWSProxy(serviceDef.Name, serviceDef.Settings)
 	case "ratelimiter":
 		return InitializeRateLimiter(serviceDef.Name, serviceDef.Settings)
+	case "cache":
+		return InitializeCache(serviceDef.Name, serviceDef.Settings)
+	case "apikey":
+		return InitializeAPIKey(serviceDef.Name, serviceDef.Settings)
 	default:
 		return nil, errors.New("unknown service type")
 	}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -36,7 +37,7 @@ func InitializeSQLD(settings map[string]interface{}) (service *SQLD, err error)
 }
 
 // Execute executes the SQLD service
-func (s *SQLD) Execute() (err error) {
+func (s *SQLD) Execute(ctx context.Context) (err error) {
 	var detector *gru.Detector
 	if s.Maker != nil {
 		detector = s.Maker.Make()
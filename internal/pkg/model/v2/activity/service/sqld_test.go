@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"testing"
 
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
@@ -28,7 +29,7 @@ func TestSQLD(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		err = instance.Execute()
+		err = instance.Execute(context.Background())
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -23,7 +23,6 @@ type ProxyClient struct {
 type ProxyService struct {
 	name           string
 	proxyclients   map[string]*ProxyClient
-	backendURL     string
 	maxConnections int
 	sync.RWMutex
 }
@@ -64,42 +63,23 @@ func (p *ProxyService) ReleaseProxyClient(pc *ProxyClient) {
 	delete(p.proxyclients, pc.name)
 }
 
-// ProxyServices holds multiple ProxyService instances
-type ProxyServices struct {
-	services map[string]*ProxyService
-	sync.RWMutex
-}
-
-// proxyServices holds ProxyService instances created accross gateway
-var proxyServices = ProxyServices{
-	services: make(map[string]*ProxyService),
-}
-
-// GetService returns proxy service corresponding to supplied name
-// it creates new service it doesn't exist already
-func (p *ProxyServices) GetService(name string, backendURL string, maxConnections int) *ProxyService {
-	p.Lock()
-	defer p.Unlock()
-	pService := p.services[name]
-	if pService == nil {
-		pService = &ProxyService{
-			name:           name,
-			proxyclients:   make(map[string]*ProxyClient),
-			backendURL:     backendURL,
-			maxConnections: maxConnections,
-		}
-		p.services[name] = pService
+// NewProxyService creates a ProxyService that accepts up to maxConnections proxy clients
+func NewProxyService(name string, maxConnections int) *ProxyService {
+	return &ProxyService{
+		name:           name,
+		proxyclients:   make(map[string]*ProxyClient),
+		maxConnections: maxConnections,
 	}
-	return pService
 }
 
-// ReleaseService delete the service it doesn't hold any proxy clients
-func (p *ProxyServices) ReleaseService(name string) {
+// Close closes the connections of all ongoing proxy clients
+func (p *ProxyService) Close() {
 	p.Lock()
 	defer p.Unlock()
-	if pService, ok := p.services[name]; ok {
-		if len(pService.proxyclients) <= 0 {
-			delete(p.services, name)
+	for _, pClient := range p.proxyclients {
+		pClient.clientConn.Close()
+		if pClient.serverConn != nil {
+			pClient.serverConn.Close()
 		}
 	}
 }
@@ -107,9 +87,7 @@ func (p *ProxyServices) ReleaseService(name string) {
 // start creates new ProxyClient instance and handles upstream & downstream flow
 func startProxyClient(wsp *WSProxy) error {
 	log.Debugf("starting proxy between the connection:%p & backendURL:%s ...", wsp.clientConn, wsp.backendURL)
-	// get proxy service
-	pService := proxyServices.GetService(wsp.serviceName, wsp.backendURL, wsp.maxConnections)
-	defer proxyServices.ReleaseService(wsp.serviceName)
+	pService := wsp.proxyService
 
 	// create proxy client
 	clientName := fmt.Sprintf("%s-%p-%s", wsp.serviceName, wsp.clientConn, wsp.clientConn.RemoteAddr())
@@ -122,16 +100,18 @@ func startProxyClient(wsp *WSProxy) error {
 	defer pClient.clientConn.Close()
 
 	// establish backend connection
-	log.Debugf("connecting to %s ", pService.backendURL)
-	conn, _, err := websocket.DefaultDialer.Dial(pService.backendURL, nil)
+	log.Debugf("connecting to %s ", wsp.backendURL)
+	conn, _, err := websocket.DefaultDialer.Dial(wsp.backendURL, nil)
 	if err != nil {
 		log.Errorf("connection error: %s", err)
-		m := fmt.Sprintf("failed to connect backend url[%s]", pService.backendURL)
+		m := fmt.Sprintf("failed to connect backend url[%s]", wsp.backendURL)
 		closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, m)
 		pClient.clientConn.WriteMessage(websocket.CloseMessage, closeMessage)
 		return nil
 	}
+	pService.Lock()
 	pClient.serverConn = conn
+	pService.Unlock()
 	defer pClient.serverConn.Close()
 	log.Infof("proxy[%s] started", clientName)
 
@@ -1,6 +1,7 @@
 package wsproxy
 
 import (
+	"context"
 	"errors"
 
 	"github.com/TIBCOSoftware/flogo-lib/logger"
@@ -17,6 +18,50 @@ type WSProxy struct {
 	backendURL     string
 	maxConnections int
 	clientConn     *websocket.Conn
+	proxyService   *ProxyService
+}
+
+// WSProxyFactory shares a ProxyService between the executions of a WSProxy
+// service definition so that maxConnections applies across them.
+type WSProxyFactory struct {
+	name         string
+	settings     map[string]interface{}
+	proxyService *ProxyService
+}
+
+// NewWSProxyFactory creates a WSProxyFactory with provided settings.
+func NewWSProxyFactory(name string, settings map[string]interface{}) *WSProxyFactory {
+	return &WSProxyFactory{
+		name:     name,
+		settings: settings,
+	}
+}
+
+// Start implements service.Factory.Start
+func (f *WSProxyFactory) Start() (err error) {
+	wspService, err := InitializeWSProxy(f.name, f.settings)
+	if err != nil {
+		return err
+	}
+	f.proxyService = wspService.proxyService
+	return nil
+}
+
+// New implements service.Factory.New
+func (f *WSProxyFactory) New() (wspService *WSProxy, err error) {
+	wspService, err = InitializeWSProxy(f.name, f.settings)
+	if f.proxyService != nil {
+		wspService.proxyService = f.proxyService
+	}
+	return wspService, err
+}
+
+// Close implements service.Factory.Close
+func (f *WSProxyFactory) Close() (err error) {
+	if f.proxyService != nil {
+		f.proxyService.Close()
+	}
+	return nil
 }
 
 // InitializeWSProxy initializes an WSProxy service with provided settings.
@@ -26,11 +71,12 @@ func InitializeWSProxy(name string, settings map[string]interface{}) (wspService
 		maxConnections: defaultMaxConnections,
 	}
 	err = wspService.setRequestValues(settings)
+	wspService.proxyService = NewProxyService(name, wspService.maxConnections)
 	return wspService, err
 }
 
 // Execute invokes this WSProxy service.
-func (wsp *WSProxy) Execute() (err error) {
+func (wsp *WSProxy) Execute(ctx context.Context) (err error) {
 
 	// start proxy client as a goroutine
 	go startProxyClient(wsp)
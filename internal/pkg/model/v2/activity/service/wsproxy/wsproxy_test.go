@@ -1,6 +1,7 @@
 package wsproxy
 
 import (
+	"context"
 	"net/http"
 	"testing"
 	"time"
@@ -79,7 +80,7 @@ func TestWSProxy(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = instance.Execute()
+	err = instance.Execute(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"time"
 
 	"github.com/TIBCOSoftware/flogo-lib/app"
 	"github.com/TIBCOSoftware/flogo-lib/engine"
@@ -12,6 +13,8 @@ import (
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/cache"
 	gwerrors "github.com/TIBCOSoftware/mashling/internal/pkg/model/errors"
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v1"
+	core "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/core"
+	mservice "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service"
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/schema"
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
 	"github.com/TIBCOSoftware/mashling/pkg/files"
@@ -145,6 +148,19 @@ func validateConfigurationContents(gateway *types.Schema) ([]gwerrors.Error, err
 	if deps != nil {
 		gerrs = append(gerrs, &gwerrors.MissingDependency{MissingDependencies: deps})
 	}
+	// Check service settings that are only used once the gateway runs
+	for _, service := range gateway.Gateway.Services {
+		switch service.Type {
+		case "ratelimiter":
+			if err := mservice.ValidateRateLimiter(service.Settings); err != nil {
+				gerrs = append(gerrs, &gwerrors.InvalidDefinition{DefinitionType: "Service", DefinedIn: service.Name, Reason: err.Error()})
+			}
+		case "http", "grpc":
+			if err := mservice.ValidateResilience(service.Type, service.Settings); err != nil {
+				gerrs = append(gerrs, &gwerrors.InvalidDefinition{DefinitionType: "Service", DefinedIn: service.Name, Reason: err.Error()})
+			}
+		}
+	}
 	// Check for undefined dispatch references in Trigger Handlers
 	for _, trigger := range gateway.Gateway.Triggers {
 		for _, handler := range trigger.Handlers {
@@ -153,15 +169,88 @@ func validateConfigurationContents(gateway *types.Schema) ([]gwerrors.Error, err
 			}
 		}
 	}
-	// Check for undefined service references in steps
+	// Check route timeouts and dead letter sinks
 	for _, dispatch := range gateway.Gateway.Dispatches {
 		for _, route := range dispatch.Routes {
-			for _, step := range route.Steps {
-				if _, defined := services[step.Service]; !defined {
-					gerrs = append(gerrs, &gwerrors.UndefinedReference{Reference: step.Service, ReferenceType: "Service", ReferencedFrom: dispatch.Name})
+			if route.DeadLetter != nil {
+				if err := core.ValidateDeadLetter(route); err != nil {
+					gerrs = append(gerrs, &gwerrors.InvalidDefinition{DefinitionType: "DeadLetter", DefinedIn: dispatch.Name, Reason: err.Error()})
+				} else if _, defined := services[route.DeadLetter.Service]; route.DeadLetter.Service != "" && !defined {
+					gerrs = append(gerrs, &gwerrors.UndefinedReference{Reference: route.DeadLetter.Service, ReferenceType: "Service", ReferencedFrom: dispatch.Name})
 				}
 			}
+			if route.Timeout == "" {
+				continue
+			}
+			if timeout, err := time.ParseDuration(route.Timeout); err != nil || timeout <= 0 {
+				gerrs = append(gerrs, &gwerrors.InvalidDefinition{DefinitionType: "Route", DefinedIn: dispatch.Name, Reason: "timeout must be a positive duration but is " + route.Timeout})
+			}
+		}
+	}
+	// Check steps for undefined service and fallback references, invalid parallel groups, retries, loops and names
+	for _, dispatch := range gateway.Gateway.Dispatches {
+		for _, route := range dispatch.Routes {
+			names := make(map[string]bool)
+			walkSteps(route.Steps, func(step types.Step) {
+				if step.Name == "" && step.Service != "" {
+					names[step.Service] = true
+				}
+			})
+			walkSteps(route.Steps, func(step types.Step) {
+				if step.Name != "" {
+					switch {
+					case step.Service == "":
+						gerrs = append(gerrs, &gwerrors.InvalidDefinition{DefinitionType: "Step", DefinedIn: dispatch.Name, Reason: "only a step with a service can be named"})
+					case core.IsReserved(step.Name):
+						gerrs = append(gerrs, &gwerrors.InvalidDefinition{DefinitionType: "Step", DefinedIn: dispatch.Name, Reason: "step name " + step.Name + " is reserved"})
+					case names[step.Name]:
+						gerrs = append(gerrs, &gwerrors.InvalidDefinition{DefinitionType: "Step", DefinedIn: dispatch.Name, Reason: "step name " + step.Name + " is not unique"})
+					}
+					names[step.Name] = true
+				}
+				switch {
+				case step.Parallel != nil && step.Service != "":
+					gerrs = append(gerrs, &gwerrors.InvalidDefinition{DefinitionType: "Step", DefinedIn: dispatch.Name, Reason: "a step cannot have both a service and a parallel group"})
+				case step.Parallel != nil:
+					if wait := step.Parallel.Wait; wait != "" && wait != core.WaitAll && wait != core.WaitFirst {
+						gerrs = append(gerrs, &gwerrors.InvalidDefinition{DefinitionType: "Parallel", DefinedIn: dispatch.Name, Reason: "wait must be either all or first but is " + wait})
+					}
+				default:
+					if _, defined := services[step.Service]; !defined {
+						gerrs = append(gerrs, &gwerrors.UndefinedReference{Reference: step.Service, ReferenceType: "Service", ReferencedFrom: dispatch.Name})
+					}
+				}
+				if step.Foreach != nil {
+					if err := core.ValidateForeach(step); err != nil {
+						gerrs = append(gerrs, &gwerrors.InvalidDefinition{DefinitionType: "Foreach", DefinedIn: dispatch.Name, Reason: err.Error()})
+					}
+				}
+				if step.Retry != nil {
+					if step.Service == "" {
+						gerrs = append(gerrs, &gwerrors.InvalidDefinition{DefinitionType: "Retry", DefinedIn: dispatch.Name, Reason: "only a step with a service can be retried"})
+					} else if err := core.ValidateRetry(step.Retry); err != nil {
+						gerrs = append(gerrs, &gwerrors.InvalidDefinition{DefinitionType: "Retry", DefinedIn: dispatch.Name, Reason: err.Error()})
+					}
+				}
+				if step.OnError != nil && step.OnError.Service != "" {
+					if _, defined := services[step.OnError.Service]; !defined {
+						gerrs = append(gerrs, &gwerrors.UndefinedReference{Reference: step.OnError.Service, ReferenceType: "Service", ReferencedFrom: dispatch.Name})
+					}
+				}
+			})
 		}
 	}
 	return gerrs, nil
 }
+
+// walkSteps calls fn for each step including the steps nested in parallel groups.
+func walkSteps(steps []types.Step, fn func(step types.Step)) {
+	for _, step := range steps {
+		fn(step)
+		if step.Parallel != nil {
+			for _, parallelStep := range step.Parallel.Steps {
+				fn(types.Step{ParallelStep: parallelStep})
+			}
+		}
+	}
+}
@@ -2,11 +2,14 @@ package v2
 
 import (
 	"log"
+	"net/http"
 
 	"github.com/TIBCOSoftware/flogo-lib/app"
 	"github.com/TIBCOSoftware/flogo-lib/engine"
 	"github.com/TIBCOSoftware/mashling/internal/pkg/consul"
 	gwerrors "github.com/TIBCOSoftware/mashling/internal/pkg/model/errors"
+	core "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/core"
+	mservice "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/service"
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
 	"github.com/TIBCOSoftware/mashling/internal/pkg/services"
 	"github.com/TIBCOSoftware/mashling/internal/pkg/swagger"
@@ -38,6 +41,24 @@ func (g *Gateway) Init(pingEnabled bool, pingPort string) error {
 
 		g.PingService = services.GetPingService()
 		g.PingService.Init(pingPort, pingResponse)
+		// Serve the traces of requests next to the ping endpoints.
+		g.PingService.Handle("/traces", core.TraceHandler("/traces"))
+		g.PingService.Handle("/traces/", core.TraceHandler("/traces"))
+		// And the status of async route executions.
+		g.PingService.Handle("/executions/", core.AsyncHandler("/executions"))
+		// And the connection metrics of the http services.
+		g.PingService.Handle("/metrics/http", mservice.HTTPMetricsHandler())
+		// And the state of the circuit breakers, which can be reset with the
+		// trace secret.
+		circuitBreakers := core.RequireTraceSecret(mservice.CircuitBreakerHandler("/circuitBreakers"), http.MethodPost)
+		g.PingService.Handle("/circuitBreakers", circuitBreakers)
+		g.PingService.Handle("/circuitBreakers/", circuitBreakers)
+	}
+
+	// Precompile dispatch plans so requests do not have to parse them.
+	err := compileDispatches(g.FlogoApp.Actions)
+	if err != nil {
+		return err
 	}
 
 	return g.FlogoEngine.Init(true)
@@ -70,7 +91,12 @@ func (g *Gateway) Stop() error {
 		log.Println("[mashling] Stoppping Ping service...")
 		g.PingService.Stop()
 	}
-	return g.FlogoEngine.Stop()
+	err := g.FlogoEngine.Stop()
+	if werr := core.WaitAsync(core.DefaultShutdownTimeout); werr != nil {
+		log.Println("[mashling]", werr)
+	}
+	core.Reset()
+	return err
 }
 
 // Version returns the current schema version used to configure the Gateway.
@@ -68,7 +68,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _schemaJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xec\x59\xcd\x6e\x9c\x30\x10\xbe\xe7\x29\x90\xd3\x53\xd5\x84\x56\xea\x69\xcf\x95\xd2\x9e\x1a\x65\x7b\xab\xa2\xc8\x81\x59\xd6\x11\xd8\xc4\x1e\x52\xad\xaa\xbc\x7b\xc5\x6f\x60\xb1\xf9\x59\xbc\x29\x48\xec\x61\x0f\xcc\x30\x1e\x8f\xbf\x6f\x3c\x33\xfc\xbd\x70\x1c\xc7\x21\x1f\x94\xb7\x87\x88\x92\x8d\x43\xf6\x88\xf1\xc6\x75\x9f\x94\xe0\x57\xf9\xd3\x6b\x21\x03\xd7\x97\x74\x87\x57\x9f\xbf\xba\xf9\xb3\x4b\xf2\xa9\x78\x53\xc2\x2e\x7d\xed\xd2\xf5\x61\xc7\x38\x43\x26\xb8\x72\xb7\xb9\xb9\x42\xa7\x26\x21\x1b\x27\x5f\x32\x13\x7c\x63\x2a\xa6\xe8\xed\x1b\x4f\x33\x89\x84\xe7\x84\x49\xf0\xc9\xc6\xf9\xdd\x90\x64\x52\x4e\x23\x28\x8c\x37\xdf\x12\x09\x82\x22\x0d\xc1\x7d\x53\x8f\xc4\x52\xc4\x20\x91\x81\x6a\xad\xfa\x66\x5b\x27\xc9\xa4\x78\x88\x53\x29\x51\x28\x19\x0f\x48\x4b\xe9\xd5\xec\x95\xd1\x26\x43\x88\xcc\x62\x67\xd2\xf9\xe8\xad\x69\xcf\xec\x2e\x75\xb3\xbd\x23\xc3\xae\x32\x43\x11\xe3\x3f\x0a\xe7\xbf\x18\x54\x12\xce\x9e\x13\x28\xb5\x50\x26\x60\x50\x2c\x23\x4b\xa5\xa4\x07\x4d\x60\x2f\x3a\x1c\x22\xd4\xf7\xb3\x5d\xd0\xf0\xb6\x7e\xbc\x3b\x1a\xaa\xa3\xf5\xaa\x75\xc4\xe3\x13\x78\xf8\xb6\x50\xcd\x24\xb9\xa1\x08\x7f\xe8\xc1\x16\x2c\x5f\x40\x2a\x26\xb8\x4e\x84\x92\x05\x01\x48\xa5\x93\xf9\x05\x3b\xa6\x22\xda\x07\xe5\x49\x16\xa7\xf1\xb1\x0b\xec\x9a\x83\x73\x07\x77\x95\x69\x66\x8b\x6f\x43\x7c\x43\x7a\x78\x60\x11\x0d\x2c\xe7\xa4\xd2\xb4\xfd\x6c\x67\xdf\xa2\x02\xf9\xc2\xbc\x05\x80\x6c\x9b\x3b\xba\x28\x8c\x55\x09\x68\xee\xc1\xfd\x95\x3b\xba\xa8\xe0\x96\x89\xff\x74\x3a\xbc\xe7\xad\xf7\x9d\x72\x3f\x04\x39\xf6\xd6\xf3\xb5\xa9\x75\xf4\x25\x65\x2a\x05\x87\xc7\x4a\x9b\x3a\x10\x19\x0f\x3a\xd0\x1d\x53\x44\x90\xfc\xb6\xdb\xbd\x4a\xfd\xfa\x63\xa7\xdc\xe9\x38\x16\x33\xb4\x8e\xb7\xd8\x0e\x72\x7b\x8d\x0c\x84\xdd\xe6\x32\xc5\x47\x21\x42\xa0\xba\xda\xa3\xa5\xca\x38\x42\xca\xb0\x01\xaa\x3c\x89\x1e\x87\x6a\x86\xe1\x10\xbd\x02\x98\x03\x34\x4d\xe7\x5f\xff\xdd\x1b\xa5\xaf\xa3\xf2\x87\x89\x36\x7a\x6b\x67\xe6\xe7\xcf\x04\xe3\x04\x47\xd3\x93\x22\x9d\x46\x4d\x4f\xf8\x03\x6e\xf4\x12\x3d\xc3\xca\x8f\xd4\x29\xa3\xc9\xd1\x04\xea\x27\x4e\x2f\x61\x06\x10\x65\x00\x41\xfa\x89\xd1\x47\x88\x7e\x22\x74\x12\xa0\x0d\xfc\x77\x85\xe8\x1d\xa8\x58\x70\xd5\x86\x4b\x0f\x48\x41\x4a\x21\xa7\xa1\x34\x37\xd1\x0b\xd3\xf2\x98\x07\xc1\x94\xed\xec\x5e\x47\x42\xcf\xe0\x4a\x6e\xad\x8e\x32\xd4\x50\x45\x06\xf9\xcf\x18\xc9\xe6\x0c\x23\x01\xa2\x10\xe2\x89\x6d\x30\x55\x07\xee\xcd\x1c\x20\xb2\xe0\xcf\xfc\xcb\xf1\x8a\xe9\x27\xdd\xa7\x23\x6a\xe8\xfc\xe4\xe7\x1e\x8e\x2d\x42\x6c\xbd\x35\x99\xd3\x48\x6c\x5b\xc6\x70\x14\x6d\x23\xaa\xf6\x21\xe3\xc1\x83\xaa\x0f\x84\x1b\x2a\x41\x31\x6b\x9b\xc4\xed\xc0\x30\xb0\xab\x14\xce\x9d\x59\x6f\x74\xbb\x70\x0c\x90\x3e\x8e\xca\x32\xda\xc3\x72\xba\x61\x69\x28\x9a\x2d\x39\xad\x65\x3c\xd7\x5c\xf3\x1c\x23\xac\xb5\x0f\x5d\xfb\xd0\xfa\xcf\x72\x1f\x6a\x22\xd8\x42\x52\x4b\x7a\x7b\x8e\xad\x08\x75\xc3\xd6\xb1\x29\xc4\x76\xfd\xc6\x78\x67\x7d\xbf\x92\xbc\x52\x5d\x49\xde\x5a\xeb\x14\x92\x2b\xc3\xa5\xdc\x32\x3a\x0b\x9e\x97\x33\x7c\x9b\x25\x84\xe6\xf9\x3e\x1f\x64\xcf\xf5\xb3\x69\xe5\xde\xdc\x9b\x9a\xf2\x83\x80\xed\xbe\xe6\x9c\x9f\x5c\xd6\xda\x6d\x4d\xeb\xcb\x4f\xeb\x73\xaf\xdd\x2e\xf2\xff\xd7\x7f\x01\x00\x00\xff\xff\xc1\x1e\x88\x10\x3f\x26\x00\x00")
+var _schemaJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xec\x5b\x5f\x6f\x9c\x38\x10\x7f\xe7\x53\x20\xf7\x9e\x4e\xb4\x7b\x27\xdd\x53\x9e\x73\xff\xa4\x93\x5a\x25\x79\x3b\x55\x95\x17\x06\xd6\x09\xd8\xc4\x36\xcd\xad\xaa\xfd\xee\x27\x16\xbc\x6d\x16\xdb\x98\xc5\x14\xb6\x22\xcb\x13\x1e\x8f\xc7\xe3\x99\xdf\x78\x86\xc9\x97\x20\x0c\xc3\x10\xfd\x24\xe2\x1d\x14\x18\xdd\x84\x68\x27\x65\x79\xb3\xd9\x3c\x0a\x46\xdf\x36\x6f\xdf\x31\x9e\x6d\x12\x8e\x53\xf9\xf6\x97\xdf\x36\xcd\xbb\x37\x28\x6a\x67\x72\x48\xeb\x69\x6f\x36\x09\xa4\x84\x12\x49\x18\x15\x9b\xfb\x23\x91\xa2\xf9\x66\x04\xdd\x84\xcd\x92\xf5\x0f\xdd\x02\x4e\xfe\x01\x29\x81\xbf\x7a\x5f\x3f\xa8\xe4\xac\x04\x2e\x09\x88\xce\x58\xfd\xa0\x94\xe4\xa0\x1d\xa9\x1f\x24\xf7\x65\x3d\x8a\x84\xe4\x84\x66\xa8\x43\x74\x88\x3a\xaf\x10\xa1\x65\x25\xcd\x2c\x4b\x5c\x0b\x4a\x3f\xd8\xe5\x52\x7f\xe8\xdd\xcf\xd6\xf1\xfa\x41\x38\x49\x8e\x0a\xc3\xf9\x2b\xae\x92\x57\x10\x05\x86\x49\xaf\xf6\xf7\xaf\x95\xaa\x7e\x10\xe6\x1c\xef\xdb\x93\xb0\xfd\xd0\x96\xb1\x1c\x30\x75\x21\x25\x54\x42\x06\xdc\x85\x94\x56\xc5\xd6\x95\x32\xcf\x5d\xe8\xd8\xf6\x11\x62\xe9\x42\x69\x3a\xfc\x6f\xff\x3e\x1a\x47\x0f\xda\x91\x43\x64\x37\xb8\x56\xba\xc0\x61\x1e\x7a\xc2\xe9\x13\x36\x5a\xc9\xe5\x4e\x79\xfe\x67\x70\xd2\xaf\xde\xf7\xc0\x4a\x12\xbb\x39\x49\xf1\x2c\x2d\x3e\xe2\x71\x21\x01\xfc\x33\x89\xc7\xb8\x78\x60\x59\xc2\xe4\x7a\x29\xce\xc5\x99\xef\x19\x8f\xf6\x10\xe9\x90\xac\xd9\xe2\xb9\xd4\x88\xc3\x73\x45\x38\x24\x5a\xa7\x45\x5b\xce\x9e\x80\x0b\xcd\xf9\x21\xd9\x55\xd9\xc7\x68\x18\x54\x2a\xee\x97\xab\x52\x23\x57\x89\x85\x78\x61\x3c\xf1\xcb\x55\x6a\xb5\x37\x8a\x65\x25\x34\xe1\xc5\x9d\x63\x60\xe1\xef\xdd\x8a\x88\x28\xb1\x8c\x77\x43\xcd\x87\xe2\x02\x74\xb6\xc3\x59\x25\x41\x8c\x33\x9e\x23\xef\xcb\xd5\x67\x96\xca\xc8\x93\x48\x28\xcc\xc3\x7e\xa1\xd1\x82\x5a\x77\xb5\x98\xdd\x1d\x19\x76\x55\x3f\xa8\x20\xf4\xef\x56\xf8\x5f\x0d\x24\x15\x25\xcf\x15\x28\x2a\x73\xa4\x3f\x69\xb6\x89\xdf\xf3\xda\xe5\x1f\x8c\x03\x1e\x6e\x96\x84\x8e\x33\x3d\x6c\xb6\x82\x8b\x0c\x2f\x66\x34\xae\x38\x07\x1a\xef\xfb\x19\xab\x3b\x8e\x13\x67\x42\x47\x48\x1a\x58\xb8\xfb\x3e\xc9\x3f\xb1\x84\x17\xbc\x1f\x7a\x92\x26\x80\xf9\x0c\x5c\x10\xa6\xbb\x33\x22\xc9\x49\x96\x19\x62\x5a\xd2\xe2\xdc\x58\x6c\x4a\x40\xc4\x9c\x94\xf5\x2d\x63\x84\xfe\xed\x02\x2e\x1d\xa6\x6e\x5b\x51\xbb\x1b\x5b\x0a\x52\x75\xa7\x1d\xf5\x9b\xe3\xfd\x27\x52\xe0\xcc\x73\x74\x51\xac\xfd\xc7\x2d\xff\x1c\xdb\x3b\xee\xf2\x8d\xec\xbe\xbd\x8c\x6b\xe7\x2d\xd4\xc6\x4e\x00\xb4\x74\xe5\x3e\x34\x82\x5e\x95\x72\x15\xf0\x1b\x75\xdb\xeb\x0e\x81\x65\x09\xdf\x51\xef\x2f\x4c\x93\x1c\xf8\xd0\xa8\xa7\xa2\xc0\xc8\x20\xa5\xb8\x5c\xae\x2b\x2d\x74\x48\x49\x68\x26\xd6\x7a\xd5\x5a\xaf\x9a\xa4\x5e\x15\x58\xb8\xf8\xf6\xcf\xf7\xf4\x77\xce\x99\xc6\x3f\xfb\x7c\x2b\x66\x54\x12\x5a\x39\x84\x65\x65\x2d\x1d\x2a\xfd\x75\x7e\xad\x04\xaf\x95\xe0\xef\x58\x09\xe6\x20\x4a\x46\x85\xc5\x8e\xbd\x5d\x44\x0c\x97\x90\x3b\x25\x81\x93\xbc\xd7\x55\x9c\x7d\x5f\x49\x9d\x3f\xf7\x45\x7f\x2c\xf1\xb8\xc8\x1f\xb3\xc4\x41\x45\xca\x85\x3a\x54\x87\x48\xc7\x92\x4a\xa0\xf2\x61\x5f\x3a\x70\x36\x2a\x5f\xc3\xf8\xb8\x5b\x23\xc7\xc1\xf0\xd4\x0f\x4b\xbd\x70\xe4\x00\x43\x0e\xf0\xd3\x0f\x3b\x7d\x70\xa3\x4c\xcb\x42\x61\x52\xb4\x1e\x56\x74\xe7\xba\x03\x9c\x00\x5f\x6f\x73\xeb\x6d\xee\xfa\x6f\x73\x1f\x30\xc7\x79\x0e\xf9\x50\xc0\x15\x12\xca\x91\x05\xc1\x86\xc5\xd2\x13\x7e\xa5\xa0\x7b\x09\x25\x0a\x34\xf3\xce\x4f\x68\x48\xd6\x7f\x41\x32\xff\x82\x89\xe5\xb6\xab\x18\x9a\xec\x79\x16\xdb\x3a\xaa\xee\x5c\xe4\x5e\xf3\x48\x0d\xdf\x31\x7a\xce\x4b\x7d\xfe\xe8\xcc\x39\xdb\x6c\xfd\x20\x92\x8e\x50\xe5\x9a\x8b\xac\xb9\xc8\xdc\xb9\x88\xff\x32\x37\x33\xa4\xf7\x3d\x6e\xa7\xaa\x02\x4e\x6b\x70\x90\x7c\x3f\x74\x85\xbb\xe3\x24\x27\xfe\xd7\x95\xf1\x9c\xb2\xb9\x81\x21\x18\xba\x0a\x1f\x1a\x82\xc1\x7e\xd4\x4a\x7a\xe5\xd7\x1d\xaa\xef\x81\xa9\x4c\x9f\x10\xfa\xbf\x04\x98\x2c\xbb\x59\x7f\x6e\x1b\xd1\x79\x4c\xef\xf9\xd6\x79\x48\x51\x4a\xd1\x7f\x22\x0a\x8f\x3b\x54\x67\x1b\xab\x1f\xb4\xc5\xf1\x13\x4b\x3d\x9f\x73\x02\xb9\xe6\x5b\xf7\x28\x96\x8f\x44\xdb\xae\xda\xe1\xd9\x46\x18\x27\x9e\x05\xfe\xef\xd6\xbf\xa4\x57\xf3\x75\xa6\x69\xb4\x19\x88\x54\x1e\x92\x05\x2c\xf6\x34\xf6\x8c\x54\xc9\xa9\x0f\x70\x3e\x74\xf9\xda\x8b\x38\x13\xba\xd2\x07\x52\x00\xb3\x02\xac\x87\x1a\xa4\xaa\x99\x8e\xcc\xf7\x06\x4a\x62\x90\xe6\xd2\xd4\xeb\x3a\x12\xd6\xa5\x24\xaa\xb2\xcf\xae\x7a\xcd\x35\xb0\x2c\xe1\x1b\xd7\xda\x7f\x82\x18\x08\x6c\x05\x16\xbb\x9c\xd0\xec\x53\x7b\xae\xaf\x17\xae\x7f\x28\x6b\x9b\xb8\x46\xa1\x9f\x62\x32\x1b\x4c\xa9\x56\xb4\xce\x9c\x43\xd4\xaf\x95\x2b\xb1\x00\x43\xd2\x70\x61\xb7\xdd\x71\xc9\x51\x87\x3e\x59\xc3\xdc\x14\xbd\x51\x6b\x83\xc3\xda\xe0\x30\x61\x83\x43\x14\x98\xe6\x7c\xb1\x73\x34\x5a\x71\x60\x91\xcb\x3b\xb4\x4c\x54\x00\x9d\x18\xf4\xd7\x52\xea\x5a\x4a\x5d\x4b\xa9\x53\x96\x52\x27\x76\xe0\x41\x45\xd9\xb2\xfd\x5a\x33\x9f\xb8\xea\x7b\x91\x9f\x22\xf2\xc4\xc2\xfe\xb0\xe5\x68\xd5\xe1\xec\xf3\x1e\xac\x79\xbf\x6b\xda\x7c\xc5\x42\xef\xc8\x27\xf1\x96\x9e\xee\xab\x76\x69\xed\xbc\x11\x19\xff\x94\x0d\xe9\x6b\x02\xb2\x26\x20\x6b\x02\x32\x75\x02\x12\x84\x61\x18\x1e\x82\xc3\xff\x03\x00\x79\xb6\x8e\x39\x37\x44\x00\x00")
 
 func schemaJsonBytes() ([]byte, error) {
 	return bindataRead(
@@ -83,7 +83,7 @@ func schemaJson() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "schema.json", size: 9791, mode: os.FileMode(420), modTime: time.Unix(1540362003, 0)}
+	info := bindataFileInfo{name: "schema.json", size: 17463, mode: os.FileMode(420), modTime: time.Unix(1792309311, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -0,0 +1,101 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+const config = `{
+  "mashling_schema": "1.0",
+  "gateway": {
+    "name": "MyProxy",
+    "version": "1.0.0",
+    "triggers": [
+      {
+        "name": "MyProxy",
+        "type": "github.com/TIBCOSoftware/mashling/ext/flogo/trigger/gorillamuxtrigger",
+        "settings": {
+          "port": "9096"
+        },
+        "handlers": [
+          {
+            "dispatch": "Pets",
+            "settings": {
+              "method": "GET",
+              "path": "/pets/{petId}"
+            }
+          }
+        ]
+      }
+    ],
+    "dispatches": [
+      {
+        "name": "Pets",
+        "routes": [
+          {
+            "steps": [
+              {
+                "parallel": {
+                  "wait": "all",
+                  "steps": [
+                    {
+                      "service": "PetStorePets",
+                      "input": {
+                        "pathParams.id": "${payload.pathParams.petId}"
+                      }
+                    },
+                    %s
+                  ]
+                }
+              }
+            ],
+            "responses": [
+              {
+                "error": false,
+                "output": {
+                  "code": 200,
+                  "data": {
+                    "pet": "${PetStorePets.response.body}",
+                    "inventory": "${PetStoreInventory.response.body}"
+                  }
+                }
+              }
+            ]
+          }
+        ]
+      }
+    ],
+    "services": [
+      {
+        "name": "PetStorePets",
+        "type": "http",
+        "settings": {
+          "url": "http://petstore.swagger.io/v2/pet/:id"
+        }
+      },
+      {
+        "name": "PetStoreInventory",
+        "type": "http",
+        "settings": {
+          "url": "http://petstore.swagger.io/v2/store/inventory"
+        }
+      }
+    ]
+  }
+}`
+
+func TestValidate(t *testing.T) {
+	step := `{"service": "PetStoreInventory", "retry": {"attempts": 2}}`
+	err := Validate([]byte(strings.Replace(config, "%s", step, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateNestedParallel(t *testing.T) {
+	step := `{"parallel": {"steps": [{"service": "PetStoreInventory"}]}}`
+	err := Validate([]byte(strings.Replace(config, "%s", step, 1)))
+	if err == nil {
+		t.Fatal("a parallel group nested in a parallel group should be invalid")
+	}
+}
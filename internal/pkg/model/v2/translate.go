@@ -9,6 +9,7 @@ import (
 	faction "github.com/TIBCOSoftware/flogo-lib/core/action"
 	ftrigger "github.com/TIBCOSoftware/flogo-lib/core/trigger"
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v1"
+	core "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/core"
 	"github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/types"
 )
 
@@ -18,6 +19,24 @@ type mapping struct {
 	MapTo string                 `json:"mapTo"`
 }
 
+// coreTask mirrors the mashling-core task rendered by actionTemplate.
+type coreTask struct {
+	ActivityRef string `json:"activityRef"`
+	Attributes  []struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	} `json:"attributes"`
+}
+
+// coreAction mirrors the Flogo action rendered by actionTemplate.
+type coreAction struct {
+	Flow struct {
+		RootTask struct {
+			Tasks []coreTask `json:"tasks"`
+		} `json:"rootTask"`
+	} `json:"flow"`
+}
+
 // Translate translates a v2 mashling gateway JSON config to a Flogo app.
 func Translate(gateway *types.Schema) ([]byte, error) {
 	flogoTriggers := []*ftrigger.Config{}
@@ -109,6 +128,40 @@ func Translate(gateway *types.Schema) ([]byte, error) {
 	return flogoJSON, nil
 }
 
+// compileDispatches precompiles the dispatch plan of every mashling-core task
+// found in the translated Flogo actions.
+func compileDispatches(actions []*faction.Config) error {
+	for _, action := range actions {
+		var flowAction coreAction
+		if err := json.Unmarshal(action.Data, &flowAction); err != nil {
+			return err
+		}
+		for _, task := range flowAction.Flow.RootTask.Tasks {
+			if task.ActivityRef != coreRef {
+				continue
+			}
+			var identifier string
+			var routes, services []interface{}
+			for _, attribute := range task.Attributes {
+				switch attribute.Name {
+				case "identifier":
+					identifier, _ = attribute.Value.(string)
+				case "routes":
+					routes, _ = attribute.Value.([]interface{})
+				case "services":
+					services, _ = attribute.Value.([]interface{})
+				}
+			}
+			if err := core.Register(identifier, routes, services); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+const coreRef = "github.com/TIBCOSoftware/mashling/internal/pkg/model/v2/activity/core"
+
 var actionTemplate = template.Must(template.New("").Parse(`{
     "flow": {
 			"explicitReply": true,
@@ -33,19 +33,95 @@ type Dispatch struct {
 	Routes []Route `json:"routes" jsonschema:"required,minItems=1,uniqueItems=true"`
 }
 
-// Route conditionally defines an execution flow.
+// Route conditionally defines an execution flow. A route that exceeds its
+// timeout returns the on timeout response. A failed async route is handed to
+// its dead letter sink.
 type Route struct {
-	Condition string     `json:"if,omitempty"`
-	Async     bool       `json:"async,omitempty"`
-	Steps     []Step     `json:"steps" jsonschema:"required,minItems=1"`
-	Responses []Response `json:"responses,omitempty"`
+	Condition  string      `json:"if,omitempty"`
+	Async      bool        `json:"async,omitempty"`
+	Timeout    string      `json:"timeout,omitempty"`
+	Steps      []Step      `json:"steps" jsonschema:"required,minItems=1"`
+	Responses  []Response  `json:"responses,omitempty"`
+	OnTimeout  *Response   `json:"onTimeout,omitempty"`
+	DeadLetter *DeadLetter `json:"deadLetter,omitempty"`
 }
 
-// Step conditionally defines a step in a route's execution flow.
+// DeadLetter defines where failed async executions go: either a service,
+// invoked with input that can map the error, a file that a JSON record is
+// appended to, or a Kafka or MQTT topic that the record is published to.
+type DeadLetter struct {
+	Service string                 `json:"service,omitempty"`
+	Input   map[string]interface{} `json:"input,omitempty" jsonschema:"additionalProperties"`
+	File    string                 `json:"file,omitempty"`
+	Kafka   *DeadLetterTopic       `json:"kafka,omitempty"`
+	MQTT    *DeadLetterTopic       `json:"mqtt,omitempty"`
+}
+
+// DeadLetterTopic defines the topic of a Kafka or MQTT broker. The brokers are
+// a comma separated list of host:port Kafka brokers or a single MQTT broker
+// URL, like tcp://host:1883.
+type DeadLetterTopic struct {
+	Brokers  string `json:"brokers" jsonschema:"required"`
+	Topic    string `json:"topic" jsonschema:"required"`
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Step conditionally defines a step in a route's execution flow. A step either
+// invokes a service, optionally once per element of an array, or runs a parallel
+// group of steps. The results of a service are kept under the name of the step,
+// which defaults to the service name.
 type Step struct {
+	ParallelStep
+	Parallel *Parallel `json:"parallel,omitempty"`
+}
+
+// ParallelStep defines a step in a parallel group. It is a step that cannot
+// nest another parallel group.
+type ParallelStep struct {
 	Condition string                 `json:"if,omitempty"`
-	Service   string                 `json:"service" jsonschema:"required"`
+	Name      string                 `json:"name,omitempty"`
+	Service   string                 `json:"service,omitempty"`
 	Input     map[string]interface{} `json:"input,omitempty" jsonschema:"additionalProperties"`
+	OnError   *OnError               `json:"onError,omitempty"`
+	Retry     *Retry                 `json:"retry,omitempty"`
+	Foreach   *Foreach               `json:"foreach,omitempty"`
+}
+
+// Foreach defines an array the service of a step is invoked for. Each element
+// is available to the step input under the as name.
+type Foreach struct {
+	In          string `json:"in" jsonschema:"required"`
+	As          string `json:"as,omitempty"`
+	Concurrency int    `json:"concurrency,omitempty"`
+}
+
+// Retry defines how often and when the service of a step is retried. The
+// retry-on condition is evaluated after each failed attempt.
+type Retry struct {
+	Attempts int     `json:"attempts,omitempty"`
+	Backoff  string  `json:"backoff,omitempty"`
+	Delay    string  `json:"delay,omitempty"`
+	MaxDelay string  `json:"maxDelay,omitempty"`
+	Jitter   float64 `json:"jitter,omitempty"`
+	On       string  `json:"on,omitempty"`
+}
+
+// OnError defines how a step failure is handled. A fallback service is tried
+// first, then the dedicated response is returned or the route continues. When
+// none apply the route is aborted.
+type OnError struct {
+	Continue bool                   `json:"continue,omitempty"`
+	Service  string                 `json:"service,omitempty"`
+	Input    map[string]interface{} `json:"input,omitempty" jsonschema:"additionalProperties"`
+	Response *Response              `json:"response,omitempty"`
+}
+
+// Parallel defines a group of steps that are executed concurrently. The route
+// continues once all of them, or the first successful one, have completed.
+type Parallel struct {
+	Wait  string         `json:"wait,omitempty"`
+	Steps []ParallelStep `json:"steps" jsonschema:"required,minItems=1"`
 }
 
 // Response defines response handling rules.
@@ -57,8 +133,10 @@ type Response struct {
 
 // Output defines response output values back to a trigger event.
 type Output struct {
-	Code int         `json:"code,omitempty"`
-	Data interface{} `json:"data" jsonschema:"additionalProperties"`
+	Code        int                    `json:"code,omitempty"`
+	Data        interface{}            `json:"data" jsonschema:"additionalProperties"`
+	Headers     map[string]interface{} `json:"headers,omitempty" jsonschema:"additionalProperties"`
+	ContentType string                 `json:"contentType,omitempty"`
 }
 
 // Service defines a functional target that may be invoked by a step in an execution flow.
@@ -14,6 +14,7 @@ const DefaultPort = "9090"
 //PingService interface for ping services
 type PingService interface {
 	Init(string, PingResponse) error
+	Handle(string, http.Handler)
 	Start() error
 	Stop() error
 }
@@ -28,6 +29,7 @@ func GetPingService() PingService {
 type PingServiceConfig struct {
 	*http.Server
 	pingResVal string
+	mux        *http.ServeMux
 }
 
 //PingResponse is to hold ping response
@@ -50,7 +52,8 @@ func (p *PingServiceConfig) Init(port string, pingRes PingResponse) error {
 
 	p.pingResVal = string(pingDataBytes)
 
-	p.Server = &http.Server{Addr: ":" + port}
+	p.mux = http.NewServeMux()
+	p.Server = &http.Server{Addr: ":" + port, Handler: p.mux}
 
 	return nil
 }
@@ -58,8 +61,8 @@ func (p *PingServiceConfig) Init(port string, pingRes PingResponse) error {
 //Start starts ping  server on configured port
 func (p *PingServiceConfig) Start() error {
 	log.Println("[mashling-ping-service] Ping service starting...")
-	http.HandleFunc("/ping", p.PingResponseHandlerShort)
-	http.HandleFunc("/ping/details", p.PingResponseHandlerDetail)
+	p.mux.HandleFunc("/ping", p.PingResponseHandlerShort)
+	p.mux.HandleFunc("/ping/details", p.PingResponseHandlerDetail)
 
 	listener, err := net.Listen("tcp", p.Server.Addr)
 	if err != nil {
@@ -83,6 +86,11 @@ func (p *PingServiceConfig) Start() error {
 	return nil
 }
 
+//Handle serves additional gateway endpoints next to the ping endpoints
+func (p *PingServiceConfig) Handle(pattern string, handler http.Handler) {
+	p.mux.Handle(pattern, handler)
+}
+
 //PingResponseHandlerShort handles simple response
 func (p *PingServiceConfig) PingResponseHandlerShort(w http.ResponseWriter, req *http.Request) {
 	io.WriteString(w, "{\"response\":\"Ping successful\"}\n")
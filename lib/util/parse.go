@@ -59,6 +59,10 @@ const (
 	MetaMIME = "___mime___"
 	// MetaCopy the meta copy key
 	MetaCopy = "___copy___"
+	// MetaHeaders the meta reply headers key
+	MetaHeaders = "___headers___"
+	// MetaBody the meta reply body key
+	MetaBody = "___body___"
 
 	// XMLKeyType is the key for the XML type
 	XMLKeyType = "_type"
@@ -359,7 +363,9 @@ func Unmarshal(mime string, data []byte, v interface{}) error {
 			parsed = true
 			break
 		}
-		mime = MIMEUnknown
+		if mime == "" {
+			mime = MIMEUnknown
+		}
 		fallthrough
 	default:
 		output.Elem().Set(reflect.ValueOf(make(map[string]interface{})))
@@ -382,7 +388,7 @@ func Clean(input map[string]interface{}) map[string]interface{} {
 	output := make(map[string]interface{})
 	for key, value := range input {
 		switch key {
-		case MetaMIME, MetaCopy:
+		case MetaMIME, MetaCopy, MetaHeaders, MetaBody:
 		default:
 			output[key] = value
 		}
@@ -403,6 +409,9 @@ func Marshal(v interface{}) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if body, ok := input[MetaBody]; ok {
+		return marshalBody(mime, body)
+	}
 	switch mime {
 	case MIMEApplicationJSON, MIMEApplicationJSONUTF8, "":
 		return json.MarshalIndent(Clean(input), "", " ")
@@ -416,3 +425,48 @@ func Marshal(v interface{}) ([]byte, error) {
 	}
 	return []byte(cp), nil
 }
+
+// marshalBody generates the reply body with the given MIME type. Strings,
+// bytes and the copy of a body that was not parsed are copied as is.
+func marshalBody(mime string, body interface{}) ([]byte, error) {
+	switch b := body.(type) {
+	case string:
+		return []byte(b), nil
+	case []byte:
+		return b, nil
+	case map[string]interface{}:
+		if cp, ok := b[MetaCopy].(string); ok {
+			return []byte(cp), nil
+		}
+		body = Clean(b)
+	}
+	switch mime {
+	case MIMETextXML, MIMEApplicationXML:
+		return XMLMarshal(body)
+	}
+	return json.MarshalIndent(body, "", " ")
+}
+
+// ReplyHeaders extracts the reply headers from the meta headers key. A header
+// value is either a single value or an array of values.
+func ReplyHeaders(input map[string]interface{}) map[string][]string {
+	headers, ok := input[MetaHeaders].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	output := make(map[string][]string, len(headers))
+	for key, value := range headers {
+		switch v := value.(type) {
+		case nil:
+		case []string:
+			output[key] = v
+		case []interface{}:
+			for _, element := range v {
+				output[key] = append(output[key], fmt.Sprint(element))
+			}
+		default:
+			output[key] = []string{fmt.Sprint(v)}
+		}
+	}
+	return output
+}
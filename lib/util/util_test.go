@@ -145,3 +145,54 @@ func TestXMLMarshal(t *testing.T) {
 		t.Fatal("length of input is not same as the length of output")
 	}
 }
+
+func TestMarshalReplyBody(t *testing.T) {
+	data, err := Marshal(map[string]interface{}{
+		MetaBody:    []interface{}{"a", "b"},
+		MetaHeaders: map[string]interface{}{"Location": "/pets/1", "Set-Cookie": []interface{}{"a=1", "b=2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "[\n \"a\",\n \"b\"\n]" {
+		t.Fatal("array body should be marshaled as JSON but is", string(data))
+	}
+	data, err = Marshal(map[string]interface{}{MetaBody: "<p>hi</p>", MetaMIME: "text/html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "<p>hi</p>" {
+		t.Fatal("string body should be copied but is", string(data))
+	}
+	data, err = Marshal(map[string]interface{}{MetaBody: map[string]interface{}{MetaMIME: "image/png", MetaCopy: "\x89PNG"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "\x89PNG" {
+		t.Fatal("copy of a body should be copied but is", string(data))
+	}
+	headers := ReplyHeaders(map[string]interface{}{
+		MetaHeaders: map[string]interface{}{"Location": "/pets/1", "Set-Cookie": []interface{}{"a=1", "b=2"}, "Max-Age": 60},
+	})
+	if len(headers["Set-Cookie"]) != 2 || headers["Location"][0] != "/pets/1" || headers["Max-Age"][0] != "60" {
+		t.Fatal("invalid reply headers", headers)
+	}
+}
+
+func TestUnmarshalKeepsMIME(t *testing.T) {
+	var form interface{}
+	if err := Unmarshal(MIMEForm, []byte("a=1&b=2"), &form); err != nil {
+		t.Fatal(err)
+	}
+	object := form.(map[string]interface{})
+	if object[MetaMIME] != MIMEForm || object[MetaCopy] != "a=1&b=2" {
+		t.Fatal("form should be copied with its MIME type but is", object)
+	}
+	var unknown interface{}
+	if err := Unmarshal("", []byte{0xff, 0x00}, &unknown); err != nil {
+		t.Fatal(err)
+	}
+	if unknown.(map[string]interface{})[MetaMIME] != MIMEUnknown {
+		t.Fatal("content without a MIME type should be unknown but is", unknown)
+	}
+}